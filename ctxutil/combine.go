@@ -3,6 +3,8 @@ package ctxutil
 import (
 	"context"
 	"net/http"
+
+	"github.com/pomerium/sdk-go"
 )
 
 func Combine(
@@ -15,3 +17,22 @@ func Combine(
 		return ctx
 	}
 }
+
+// WithoutCredentials returns a new context without the authorization token and identity of ctx,
+// for them to be extracted from another request
+func WithoutCredentials(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, authKey{}, nil)
+	return context.WithValue(ctx, identityKey{}, nil)
+}
+
+// WithCredentials returns a new context with the authorization token and identity of from, and only them,
+// for work that outlives the request of from on behalf of the same caller
+func WithCredentials(ctx, from context.Context) context.Context {
+	if token, ok := from.Value(authKey{}).(string); ok {
+		ctx = context.WithValue(ctx, authKey{}, token)
+	}
+	if identity, ok := from.Value(identityKey{}).(*sdk.Identity); ok {
+		ctx = context.WithValue(ctx, identityKey{}, identity)
+	}
+	return ctx
+}
@@ -3,58 +3,150 @@ package drutil
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/google/jsonschema-go/jsonschema"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
 )
 
 func BuildMCPServer(
 	name string,
 	p Provider,
+	opts Options,
 ) *mcp.Server {
+	serverOpts := opts.Server
+	var resources *documentResources
+	if opts.Resources {
+		template := opts.ResourceTemplate
+		if template == "" {
+			template = strings.ToLower(name) + "://document/{id}"
+		}
+		resources = newDocumentResources(p, template, opts.PollInterval)
+		serverOpts = withSubscriptions(serverOpts, resources)
+		// clients only complete the arguments of prompts and resource templates, so IDs
+		// can only be completed in the document resource template
+		if c, ok := p.(DocumentCompleter); ok {
+			serverOpts = withDocumentCompletion(serverOpts, c, template)
+		}
+	}
 	server := mcp.NewServer(
 		&mcp.Implementation{
 			Name:    name,
 			Version: "0.0.1",
 		},
-		nil,
+		serverOpts,
 	)
+	if resources != nil {
+		resources.register(server, name)
+	}
 
-	// Define search tool input/output types
-	type searchArgs struct {
-		Query string `json:"query" jsonschema:"The search query to execute"`
+	addSearchTool(server, p, opts)
+
+	// Add fetch tool
+	fetchTool := &mcp.Tool{
+		Name: "fetch",
+		Description: "Fetch a document by ID. To read a long document in parts, pass an offset, length or section: " +
+			"the result metadata then holds its total_length, the next_offset to continue from, relative to the section if one is selected, " +
+			"the anchor of the section the part starts in, and the outline of the document sections",
+		Annotations: toolAnnotations(p, "fetch", mcputil.ReadOnlyTool("Fetch document", true)),
+		InputSchema: fetchSchema(p, opts),
 	}
-	type searchResult struct {
-		Results []Document `json:"results"`
+	subtree, _ := p.(SubtreeFetcher)
+	if subtree != nil {
+		fetchTool.Description += ". Pass a depth to also inline the child documents, with a heading for each"
 	}
-
-	// Define fetch tool input/output types
-	type fetchArgs struct {
-		ID string `json:"id" jsonschema:"The ID of the document to fetch"`
+	if opts.Sampling {
+		fetchTool.Description += ". Long documents are condensed, pass a question to only get the relevant parts"
 	}
-
-	// Add search tool
-	mcp.AddTool(server, &mcp.Tool{
-		Name:        "search",
-		Description: p.GetSearchSyntax(),
-	}, func(ctx context.Context, _ *mcp.CallToolRequest, args searchArgs) (*mcp.CallToolResult, searchResult, error) {
-		documents, err := p.Search(ctx, args.Query)
-		if err != nil {
-			return nil, searchResult{}, fmt.Errorf("search: %w", err)
+	mcp.AddTool(server, fetchTool, func(ctx context.Context, req *mcp.CallToolRequest, args fetchArgs) (*mcp.CallToolResult, *Document, error) {
+		ctx = mcputil.WithProgress(ctx, req)
+		ctx, warnings := withWarnings(ctx)
+		var document *Document
+		var err error
+		if args.Depth > 0 && subtree != nil {
+			if args.Depth > subtree.MaxFetchDepth() {
+				return nil, nil, fmt.Errorf("depth cannot exceed %d", subtree.MaxFetchDepth())
+			}
+			document, err = subtree.FetchSubtree(ctx, args.ID, args.Depth)
+		} else {
+			document, err = p.Fetch(ctx, args.ID)
 		}
-		return nil, searchResult{Results: documents}, nil
-	})
-
-	// Add fetch tool
-	mcp.AddTool(server, &mcp.Tool{
-		Name:        "fetch",
-		Description: "Fetch a document by ID",
-	}, func(ctx context.Context, _ *mcp.CallToolRequest, args fetchArgs) (*mcp.CallToolResult, *Document, error) {
-		document, err := p.Fetch(ctx, args.ID)
 		if err != nil {
+			mcputil.Logger(ctx).Error("fetch failed", "id", args.ID, "error", err)
 			return nil, nil, fmt.Errorf("fetch: %w", err)
 		}
-		return nil, document, nil
+		part := chunkArgs{Offset: args.Offset, Length: args.Length, Section: args.Section}
+		if !part.isZero() {
+			if document, err = chunk(document, part); err != nil {
+				return nil, nil, err
+			}
+		}
+		if opts.Sampling {
+			document = newCondenser(req.Session, opts).condense(ctx, document, args.Question)
+		}
+		return warnings.result(), document, nil
 	})
 
 	return server
 }
+
+type fetchArgs struct {
+	ID       string `json:"id" jsonschema:"The ID of the document to fetch"`
+	Offset   int    `json:"offset,omitempty" jsonschema:"Byte offset to start from, such as the next_offset metadata of a previous fetch. Relative to the section if one is selected"`
+	Length   int    `json:"length,omitempty" jsonschema:"Maximum number of bytes to return"`
+	Section  string `json:"section,omitempty" jsonschema:"Anchor or heading of the section to return, from the outline metadata"`
+	Depth    int    `json:"depth,omitempty" jsonschema:"Number of levels of child documents to inline, defaults to none"`
+	Question string `json:"question,omitempty" jsonschema:"Optional question, only the parts of the document relevant to it are returned"`
+}
+
+// fetchSchema returns the input schema of the fetch tool, without the arguments the provider and options do not support
+func fetchSchema(p Provider, opts Options) *jsonschema.Schema {
+	schema, err := jsonschema.For[fetchArgs](nil)
+	if err != nil {
+		panic(fmt.Errorf("fetch tool schema: %w", err))
+	}
+	if subtree, ok := p.(SubtreeFetcher); ok {
+		minDepth, maxDepth := 0.0, float64(subtree.MaxFetchDepth())
+		schema.Properties["depth"].Minimum = &minDepth
+		schema.Properties["depth"].Maximum = &maxDepth
+	} else {
+		delete(schema.Properties, "depth")
+	}
+	if !opts.Sampling {
+		delete(schema.Properties, "question")
+	}
+	return schema
+}
+
+// toolAnnotations returns the annotations declared by the provider for the tool, or the defaults
+func toolAnnotations(p Provider, tool string, defaults *mcp.ToolAnnotations) *mcp.ToolAnnotations {
+	if a, ok := p.(ToolAnnotator); ok {
+		if annotations := a.ToolAnnotations(tool); annotations != nil {
+			return annotations
+		}
+	}
+	return defaults
+}
+
+// withDocumentCompletion returns a copy of opts that completes the id variable of the resource template
+// using the provider
+func withDocumentCompletion(opts *mcp.ServerOptions, c DocumentCompleter, template string) *mcp.ServerOptions {
+	var o mcp.ServerOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.CompletionHandler = func(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+		ref := req.Params.Ref
+		if ref == nil || ref.Type != "ref/resource" || ref.URI != template || req.Params.Argument.Name != "id" {
+			return mcputil.CompletionResult(nil), nil
+		}
+		ids, err := c.CompleteDocumentID(ctx, req.Params.Argument.Value)
+		if err != nil {
+			return nil, fmt.Errorf("complete document id: %w", err)
+		}
+		return mcputil.CompletionResult(ids), nil
+	}
+	return &o
+}
@@ -0,0 +1,60 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+type subtreeProvider struct {
+	staticProvider
+}
+
+func (p *subtreeProvider) MaxFetchDepth() int { return 2 }
+
+func (p *subtreeProvider) FetchSubtree(_ context.Context, id string, depth int) (*Document, error) {
+	return &Document{ID: id, Text: fmt.Sprintf("%s at depth %d", id, depth)}, nil
+}
+
+func TestFetchSubtree(t *testing.T) {
+	ctx := context.Background()
+	provider := &subtreeProvider{staticProvider{documents: map[string]*Document{"a": {ID: "a", Text: "a alone"}}}}
+	server := BuildMCPServer("test", provider, Options{})
+
+	if doc := fetchDocument(ctx, t, server, nil, map[string]any{"id": "a"}); doc.Text != "a alone" {
+		t.Errorf("expected a plain fetch without a depth, got %q", doc.Text)
+	}
+	if doc := fetchDocument(ctx, t, server, nil, map[string]any{"id": "a", "depth": 2}); doc.Text != "a at depth 2" {
+		t.Errorf("expected a subtree fetch, got %q", doc.Text)
+	}
+
+	// the depth argument is bounded by the provider, and only offered by subtree fetchers
+	for _, tc := range []struct {
+		provider Provider
+		maximum  any
+	}{
+		{provider, 2.0},
+		{&provider.staticProvider, nil},
+	} {
+		session := mcputiltest.Connect(ctx, t, BuildMCPServer("test", tc.provider, Options{}), nil)
+		tools, err := session.ListTools(ctx, nil)
+		if err != nil {
+			t.Fatalf("list tools: %v", err)
+		}
+		for _, tool := range tools.Tools {
+			if tool.Name != "fetch" {
+				continue
+			}
+			props := tool.InputSchema.(map[string]any)["properties"].(map[string]any)
+			depth, ok := props["depth"].(map[string]any)
+			if ok != (tc.maximum != nil) || ok && depth["maximum"] != tc.maximum {
+				t.Errorf("unexpected depth argument %v", props["depth"])
+			}
+			if _, ok := props["question"]; ok {
+				t.Error("unexpected question argument without sampling")
+			}
+		}
+	}
+}
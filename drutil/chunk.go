@@ -0,0 +1,186 @@
+package drutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultChunkLength is the length of a chunk when only an offset or section is requested
+const defaultChunkLength = 10000
+
+// Metadata keys of a fetched chunk
+const (
+	MetadataTotalLength = "total_length"
+	MetadataOffset      = "offset"
+	MetadataNextOffset  = "next_offset"
+	MetadataSection     = "section"
+	MetadataOutline     = "outline"
+)
+
+// Section is a part of a document that starts with a Markdown heading
+type Section struct {
+	Heading string
+	Level   int
+	// Anchor identifies the section by its heading, it is stable as long as the headings before it do not change
+	Anchor string
+	// Start is the byte offset of the heading and End the offset of the next heading of the same or a higher level
+	Start int
+	End   int
+}
+
+// Outline returns the sections of a Markdown text, ignoring headings in code blocks
+func Outline(text string) []Section {
+	var sections []Section
+	anchors := make(map[string]int)
+	var fenced bool
+	for offset := 0; offset < len(text); {
+		line, _, _ := strings.Cut(text[offset:], "\n")
+		start := offset
+		offset += len(line) + 1
+
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if fenced || level == 0 || level > 6 || !strings.HasPrefix(line[level:], " ") {
+			continue
+		}
+
+		heading := strings.TrimSpace(line[level:])
+		anchor := slug(heading)
+		if n := anchors[anchor]; n > 0 {
+			anchors[anchor] = n + 1
+			anchor += "-" + strconv.Itoa(n)
+		} else {
+			anchors[anchor] = 1
+		}
+		sections = append(sections, Section{Heading: heading, Level: level, Anchor: anchor, Start: start, End: len(text)})
+	}
+
+	for i := range sections {
+		for _, next := range sections[i+1:] {
+			if next.Level <= sections[i].Level {
+				sections[i].End = next.Start
+				break
+			}
+		}
+	}
+	return sections
+}
+
+// slug returns the GitHub style anchor of a heading
+func slug(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// chunkArgs select a part of a document
+type chunkArgs struct {
+	Offset  int
+	Length  int
+	Section string
+}
+
+func (a chunkArgs) isZero() bool {
+	return a == chunkArgs{}
+}
+
+// chunk returns the part of the document selected by args, with its position and the document outline in the metadata.
+// A section is selected by its anchor or heading, and args.Offset and the offset metadata are then relative to
+// the section, so that the next_offset metadata continues in the same section.
+func chunk(doc *Document, args chunkArgs) (*Document, error) {
+	if args.Offset < 0 || args.Length < 0 {
+		return nil, fmt.Errorf("offset and length must not be negative")
+	}
+	sections := Outline(doc.Text)
+
+	base, limit := 0, len(doc.Text)
+	if args.Section != "" {
+		s, ok := findSection(sections, args.Section)
+		if !ok {
+			return nil, fmt.Errorf("section %q not found, see the %s metadata for the available sections", args.Section, MetadataOutline)
+		}
+		base, limit = s.Start, s.End
+	}
+	start, end := min(base+args.Offset, limit), limit
+	length := args.Length
+	if length == 0 {
+		length = defaultChunkLength
+	}
+	// do not start in the middle of a UTF-8 sequence
+	for start < end && !utf8.RuneStart(doc.Text[start]) {
+		start++
+	}
+	if start+length < end {
+		end = start + len(truncate(doc.Text[start:], length))
+		if end == start {
+			// a length shorter than the rune at start still returns it, so that next_offset always advances
+			_, size := utf8.DecodeRuneInString(doc.Text[start:])
+			end = start + size
+		}
+	}
+
+	c := withText(doc, doc.Text[start:end], MetadataTotalLength, strconv.Itoa(len(doc.Text)))
+	c.Metadata[MetadataOffset] = strconv.Itoa(start - base)
+	if end < limit {
+		c.Metadata[MetadataNextOffset] = strconv.Itoa(end - base)
+	}
+	if s, ok := sectionAt(sections, start); ok {
+		c.Metadata[MetadataSection] = s.Anchor
+	}
+	if len(sections) > 0 {
+		c.Metadata[MetadataOutline] = formatOutline(sections)
+	}
+	return c, nil
+}
+
+func findSection(sections []Section, name string) (Section, bool) {
+	name = strings.TrimPrefix(name, "#")
+	for _, s := range sections {
+		if s.Anchor == name {
+			return s, true
+		}
+	}
+	for _, s := range sections {
+		if strings.EqualFold(s.Heading, name) {
+			return s, true
+		}
+	}
+	return Section{}, false
+}
+
+// sectionAt returns the innermost section that contains offset
+func sectionAt(sections []Section, offset int) (Section, bool) {
+	var found Section
+	var ok bool
+	for _, s := range sections {
+		if s.Start > offset {
+			break
+		}
+		if offset < s.End {
+			found, ok = s, true
+		}
+	}
+	return found, ok
+}
+
+// formatOutline renders sections as a nested Markdown list with their anchor and offset
+func formatOutline(sections []Section) string {
+	var b strings.Builder
+	for _, s := range sections {
+		fmt.Fprintf(&b, "%s- %s (#%s, offset %d)\n", strings.Repeat("  ", s.Level-1), s.Heading, s.Anchor, s.Start)
+	}
+	return b.String()
+}
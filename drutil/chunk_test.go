@@ -0,0 +1,135 @@
+package drutil
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const chunkText = `# Guide
+intro
+## Setup
+install it
+` + "```" + `
+# not a heading
+` + "```" + `
+## Usage
+run it
+## Setup
+again
+# Appendix
+end
+`
+
+func TestOutline(t *testing.T) {
+	sections := Outline(chunkText)
+
+	expected := []struct {
+		anchor string
+		level  int
+		text   string
+	}{
+		{"guide", 1, "# Guide\nintro\n## Setup\ninstall it\n```\n# not a heading\n```\n## Usage\nrun it\n## Setup\nagain\n"},
+		{"setup", 2, "## Setup\ninstall it\n```\n# not a heading\n```\n"},
+		{"usage", 2, "## Usage\nrun it\n"},
+		{"setup-1", 2, "## Setup\nagain\n"},
+		{"appendix", 1, "# Appendix\nend\n"},
+	}
+	if len(sections) != len(expected) {
+		t.Fatalf("got %d sections, expected %d: %+v", len(sections), len(expected), sections)
+	}
+	for i, e := range expected {
+		s := sections[i]
+		if s.Anchor != e.anchor || s.Level != e.level || chunkText[s.Start:s.End] != e.text {
+			t.Errorf("section %d: got %s level %d %q, expected %s level %d %q",
+				i, s.Anchor, s.Level, chunkText[s.Start:s.End], e.anchor, e.level, e.text)
+		}
+	}
+}
+
+func TestChunk(t *testing.T) {
+	doc := &Document{ID: "a", Title: "A", Text: chunkText}
+
+	c, err := chunk(doc, chunkArgs{Offset: 8, Length: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "intro\n## Setup" {
+		t.Errorf("got text %q", c.Text)
+	}
+	if c.Metadata[MetadataOffset] != "8" || c.Metadata[MetadataNextOffset] != "22" || c.Metadata[MetadataSection] != "guide" ||
+		c.Metadata[MetadataTotalLength] != "104" || !strings.Contains(c.Metadata[MetadataOutline], "  - Usage (#usage, offset 58)\n") {
+		t.Errorf("unexpected metadata %v", c.Metadata)
+	}
+	if doc.Metadata != nil || doc.Text != chunkText {
+		t.Error("chunk modified the document")
+	}
+
+	c, err = chunk(doc, chunkArgs{Section: "#setup-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "## Setup\nagain\n" || c.Metadata[MetadataSection] != "setup-1" || c.Metadata[MetadataNextOffset] != "" {
+		t.Errorf("unexpected section chunk %q %v", c.Text, c.Metadata)
+	}
+
+	c, err = chunk(doc, chunkArgs{Section: "usage", Offset: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "run it\n" || c.Metadata[MetadataOffset] != "9" {
+		t.Errorf("unexpected chunk in section %q %v", c.Text, c.Metadata)
+	}
+
+	// the next offset of a section continues in the section
+	c, err = chunk(doc, chunkArgs{Section: "usage", Length: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "## Usage\n" || c.Metadata[MetadataOffset] != "0" || c.Metadata[MetadataNextOffset] != "9" {
+		t.Errorf("unexpected first chunk of a section %q %v", c.Text, c.Metadata)
+	}
+
+	c, err = chunk(doc, chunkArgs{Offset: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "" || c.Metadata[MetadataNextOffset] != "" {
+		t.Errorf("unexpected chunk past the end %q %v", c.Text, c.Metadata)
+	}
+
+	if _, err := chunk(doc, chunkArgs{Section: "missing"}); err == nil {
+		t.Error("expected an error for a missing section")
+	}
+	if _, err := chunk(doc, chunkArgs{Offset: -1}); err == nil {
+		t.Error("expected an error for a negative offset")
+	}
+
+	utf := &Document{Text: "ééé"}
+	for offset := range len(utf.Text) {
+		c, err := chunk(utf, chunkArgs{Offset: offset, Length: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.ValidString(c.Text) {
+			t.Errorf("offset %d: invalid UTF-8 %q", offset, c.Text)
+		}
+	}
+
+	// paging by next_offset with a length shorter than a rune still advances, one rune at a time
+	var pages []string
+	for offset := "0"; offset != "" && len(pages) <= len(utf.Text); {
+		n, _ := strconv.Atoi(offset)
+		c, err := chunk(utf, chunkArgs{Offset: n, Length: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, c.Text)
+		offset = c.Metadata[MetadataNextOffset]
+	}
+	if !slices.Equal(pages, []string{"é", "é", "é"}) {
+		t.Errorf("unexpected pages %q", pages)
+	}
+}
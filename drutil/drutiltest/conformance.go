@@ -0,0 +1,178 @@
+package drutiltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+// concurrentCalls is the number of concurrent searches and fetches of the concurrency check
+const concurrentCalls = 8
+
+// Config configures the conformance checks of a provider
+type Config struct {
+	// Query is a search query that returns at least one result
+	Query string
+	// MissingID is the ID of a document that does not exist
+	MissingID string
+	// Context is the context of the calls, such as one with credentials. It defaults to context.Background.
+	Context context.Context
+}
+
+// Run checks that p behaves as expected by the MCP server built by drutil.BuildMCPServer,
+// calling it directly and through an in-process MCP client:
+//
+//   - search results have non-empty IDs that fetch resolves
+//   - an empty query returns results or an error, without failing the MCP request
+//   - fetching a missing document returns an error, reported as a tool error
+//   - calls with a cancelled context return an error that wraps context.Canceled
+//   - concurrent calls are safe, when run with the race detector
+func Run(t *testing.T, p drutil.Provider, cfg Config) {
+	t.Helper()
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if cfg.Query == "" {
+		t.Fatal("Config.Query is required")
+	}
+	if cfg.MissingID == "" {
+		cfg.MissingID = "drutiltest-missing-document"
+	}
+
+	session := mcputiltest.Connect(ctx, t, drutil.BuildMCPServer("conformance", p, drutil.Options{}), nil)
+
+	t.Run("SearchAndFetch", func(t *testing.T) {
+		results := search(ctx, t, session, cfg.Query)
+		if len(results) == 0 {
+			t.Fatalf("search %q returned no results", cfg.Query)
+		}
+		for _, doc := range results {
+			if doc.ID == "" {
+				t.Errorf("search result %q has no ID", doc.Title)
+				continue
+			}
+			fetched := fetch(ctx, t, session, doc.ID)
+			if fetched.ID == "" {
+				t.Errorf("fetch %s returned a document without ID", doc.ID)
+			}
+		}
+	})
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "search", Arguments: map[string]any{"query": ""}})
+		if err != nil {
+			t.Fatalf("empty query failed the request instead of the tool call: %v", err)
+		}
+		if !res.IsError && res.StructuredContent == nil {
+			t.Error("empty query returned neither results nor an error")
+		}
+	})
+
+	t.Run("MissingDocument", func(t *testing.T) {
+		if _, err := p.Fetch(ctx, cfg.MissingID); err == nil {
+			t.Fatalf("fetch %s returned no error", cfg.MissingID)
+		}
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "fetch", Arguments: map[string]any{"id": cfg.MissingID}})
+		if err != nil {
+			t.Fatalf("fetch of a missing document failed the request instead of the tool call: %v", err)
+		}
+		if !res.IsError || !strings.HasPrefix(text(res), "fetch: ") {
+			t.Errorf("expected a wrapped fetch error, got %q", text(res))
+		}
+	})
+
+	t.Run("Cancellation", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := p.Search(cancelled, cfg.Query); !errors.Is(err, context.Canceled) {
+			t.Errorf("search with a cancelled context: expected an error wrapping context.Canceled, got %v", err)
+		}
+		if _, err := p.Fetch(cancelled, cfg.MissingID); !errors.Is(err, context.Canceled) {
+			t.Errorf("fetch with a cancelled context: expected an error wrapping context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		results := search(ctx, t, session, cfg.Query)
+		if len(results) == 0 {
+			t.Fatalf("search %q returned no results", cfg.Query)
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*concurrentCalls)
+		for i := range concurrentCalls {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				if _, err := p.Search(ctx, cfg.Query); err != nil {
+					errs <- fmt.Errorf("search: %w", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				if _, err := p.Fetch(ctx, results[i%len(results)].ID); err != nil {
+					errs <- fmt.Errorf("fetch: %w", err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("concurrent call: %v", err)
+		}
+	})
+}
+
+func search(ctx context.Context, t *testing.T, session *mcp.ClientSession, query string) []drutil.Document {
+	t.Helper()
+	var out struct {
+		Results []drutil.Document `json:"results"`
+	}
+	call(ctx, t, session, "search", map[string]any{"query": query}, &out)
+	return out.Results
+}
+
+func fetch(ctx context.Context, t *testing.T, session *mcp.ClientSession, id string) drutil.Document {
+	t.Helper()
+	var doc drutil.Document
+	call(ctx, t, session, "fetch", map[string]any{"id": id}, &doc)
+	return doc
+}
+
+// call calls the tool and decodes its structured result into out
+func call(ctx context.Context, t *testing.T, session *mcp.ClientSession, tool string, args map[string]any, out any) {
+	t.Helper()
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tool, Arguments: args})
+	if err != nil {
+		t.Fatalf("call %s: %v", tool, err)
+	}
+	if res.IsError {
+		t.Fatalf("%s %v failed: %s", tool, args, text(res))
+	}
+	data, err := json.Marshal(res.StructuredContent)
+	if err == nil {
+		err = json.Unmarshal(data, out)
+	}
+	if err != nil {
+		t.Fatalf("decode %s result: %v", tool, err)
+	}
+}
+
+func text(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		if tc, ok := c.(*mcp.TextContent); ok {
+			parts = append(parts, tc.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,88 @@
+// Package drutiltest provides a conformance test suite and an in-memory fake for drutil.Provider implementations
+package drutiltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+// ErrNotFound is returned by Fake.Fetch for unknown documents
+var ErrNotFound = errors.New("document not found")
+
+// Fake is an in-memory drutil.Provider, safe for concurrent use
+type Fake struct {
+	mu        sync.RWMutex
+	documents []drutil.Document
+}
+
+// NewFake creates a Fake with the documents
+func NewFake(documents ...drutil.Document) *Fake {
+	return &Fake{documents: documents}
+}
+
+// Add adds or replaces a document
+func (f *Fake) Add(doc drutil.Document) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.documents {
+		if f.documents[i].ID == doc.ID {
+			f.documents[i] = doc
+			return
+		}
+	}
+	f.documents = append(f.documents, doc)
+}
+
+func (f *Fake) GetSearchSyntax() string {
+	return "Search documents whose title or text contains every word of the query."
+}
+
+// Search returns the documents that contain every word of the query, with their title as text
+func (f *Fake) Search(ctx context.Context, query string) ([]drutil.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("query cannot be empty")
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var results []drutil.Document
+	for _, doc := range f.documents {
+		text := strings.ToLower(doc.Title + "\n" + doc.Text)
+		match := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			result := doc
+			result.Text = doc.Title
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (f *Fake) Fetch(ctx context.Context, id string) (*drutil.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", id, err)
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, doc := range f.documents {
+		if doc.ID == id {
+			return &doc, nil
+		}
+	}
+	return nil, fmt.Errorf("fetch %s: %w", id, ErrNotFound)
+}
@@ -0,0 +1,14 @@
+package drutiltest
+
+import (
+	"testing"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+func TestFake(t *testing.T) {
+	Run(t, NewFake(
+		drutil.Document{ID: "1", Title: "Launch plan", Text: "The rocket launches in March."},
+		drutil.Document{ID: "2", Title: "Retro", Text: "What went wrong with the launch."},
+	), Config{Query: "launch"})
+}
@@ -0,0 +1,112 @@
+package drutil
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+// Options configures the MCP server built around a Provider
+type Options struct {
+	// Server are the options of the MCP server
+	Server *mcp.ServerOptions
+	// Sampling enables the fetch tool question argument, and condensing fetched documents
+	// that are too long or when a question is asked, using the client's model through MCP sampling
+	Sampling bool
+	// MaxTextSize is the maximum size of fetched text, in bytes, when Sampling is enabled.
+	// Longer documents are condensed, or truncated if the client does not support sampling.
+	MaxTextSize int
+	// ChunkSize is the size of the chunks long documents are split into for sampling
+	ChunkSize int
+	// Resources exposes documents as MCP resources through ResourceTemplate
+	Resources bool
+	// ResourceTemplate is the URI template of document resources, with a single {id} variable.
+	// It defaults to <name>://document/{id}.
+	ResourceTemplate string
+	// PollInterval is how often subscribed document resources are checked for changes
+	PollInterval time.Duration
+	// Rerank fetches the top search results to rank them by BM25 against the query,
+	// and replaces their text with a snippet of the matching passage
+	Rerank bool
+	// RerankCandidates is the number of top search results fetched for reranking
+	RerankCandidates int
+	// RerankConcurrency is the maximum number of concurrent fetches for reranking
+	RerankConcurrency int
+	// RerankBudget bounds the time spent fetching search results for reranking
+	RerankBudget time.Duration
+}
+
+// OptionsFromEnv reads options from the server instance environment:
+//
+//	SAMPLING=true         enables Options.Sampling, which requires STATEFUL=true
+//	MAX_TEXT_SIZE=50000   sets Options.MaxTextSize
+//	CHUNK_SIZE=20000      sets Options.ChunkSize
+//	RESOURCES=true        enables Options.Resources
+//	POLL_INTERVAL=1m      sets Options.PollInterval
+//	RERANK=true           enables Options.Rerank
+//	RERANK_CANDIDATES=10  sets Options.RerankCandidates
+//	RERANK_CONCURRENCY=4  sets Options.RerankConcurrency
+//	RERANK_BUDGET=5s      sets Options.RerankBudget
+func OptionsFromEnv(env map[string]string) Options {
+	opts := Options{
+		Server:       mcputil.ServerOptionsFromEnv(env),
+		Sampling:     envBool(env, "SAMPLING"),
+		MaxTextSize:  envInt(env, "MAX_TEXT_SIZE"),
+		ChunkSize:    envInt(env, "CHUNK_SIZE"),
+		Resources:    envBool(env, "RESOURCES"),
+		PollInterval: EnvDuration(env, "POLL_INTERVAL"),
+
+		Rerank:            envBool(env, "RERANK"),
+		RerankCandidates:  envInt(env, "RERANK_CANDIDATES"),
+		RerankConcurrency: envInt(env, "RERANK_CONCURRENCY"),
+		RerankBudget:      EnvDuration(env, "RERANK_BUDGET"),
+	}
+	if opts.Sampling && !envBool(env, "STATEFUL") {
+		// the SDK does not know the client capabilities of stateless sessions, so it never offers sampling
+		slog.Warn("SAMPLING requires STATEFUL=true, long documents will only be truncated")
+	}
+	return opts
+}
+
+func envBool(env map[string]string, key string) bool {
+	v, ok := env[key]
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("ignoring invalid boolean", "key", key, "value", v)
+	}
+	return b
+}
+
+func envInt(env map[string]string, key string) int {
+	v, ok := env[key]
+	if !ok {
+		return 0
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		slog.Warn("ignoring invalid number", "key", key, "value", v)
+		return 0
+	}
+	return i
+}
+
+// EnvDuration returns the duration of the variable, or zero if it is unset or is not a valid non-negative duration
+func EnvDuration(env map[string]string, key string) time.Duration {
+	v, ok := env[key]
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		slog.Warn("ignoring invalid duration", "key", key, "value", v)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,15 @@
+package drutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvDuration(t *testing.T) {
+	env := map[string]string{"VALID": "2s", "NEGATIVE": "-1s", "INVALID": "soon"}
+	for key, expected := range map[string]time.Duration{"VALID": 2 * time.Second, "NEGATIVE": 0, "INVALID": 0, "UNSET": 0} {
+		if got := EnvDuration(env, key); got != expected {
+			t.Errorf("%s: got %v, expected %v", key, got, expected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package drutil
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Filters of the search query language
+const (
+	FilterPhrase = "phrase"
+	FilterTitle  = "title"
+	FilterAuthor = "author"
+	FilterAfter  = "after"
+	FilterBefore = "before"
+	FilterType   = "type"
+)
+
+// filterSyntax documents the filters in the search tool description
+var filterSyntax = []struct{ filter, syntax string }{
+	{FilterPhrase, `"<words>": the words must appear next to each other, in this order`},
+	{FilterTitle, `title:<word> or title:"<words>": the title must contain the text`},
+	{FilterAuthor, `author:<name>: the author name must contain the text`},
+	{FilterAfter, `after:<YYYY-MM-DD>: last edited at or after the date`},
+	{FilterBefore, `before:<YYYY-MM-DD>: last edited before the date`},
+	{FilterType, `type:<type>: the document type`},
+}
+
+// Query is a parsed search query. All its parts must match.
+type Query struct {
+	// Terms are the words of the query that are not part of a filter
+	Terms []string
+	// Phrases are the quoted sequences of words of the query
+	Phrases []string
+	// Title holds the texts that the title must contain
+	Title []string
+	// Author is the text that the author name must contain
+	Author string
+	// After and Before restrict the last edit time
+	After  time.Time
+	Before time.Time
+	// Type is the document type
+	Type string
+}
+
+// ParseQuery parses the search query language: words, quoted phrases and field:value filters,
+// where the value may be quoted. Text before a colon that is not a known filter is kept as a word.
+func ParseQuery(s string) (*Query, error) {
+	q := &Query{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var field, value string
+		var quoted bool
+		field, value, quoted, s = nextToken(s)
+		if value == "" {
+			continue
+		}
+
+		switch strings.ToLower(field) {
+		case "":
+			if quoted {
+				q.Phrases = append(q.Phrases, value)
+			} else {
+				q.Terms = append(q.Terms, value)
+			}
+		case FilterTitle:
+			q.Title = append(q.Title, value)
+		case FilterAuthor:
+			q.Author = value
+		case FilterType:
+			q.Type = strings.ToLower(value)
+		case FilterAfter, FilterBefore:
+			t, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field, err)
+			}
+			if strings.EqualFold(field, FilterAfter) {
+				q.After = t
+			} else {
+				q.Before = t
+			}
+		default:
+			q.Terms = append(q.Terms, field+":"+value)
+		}
+	}
+	return q, nil
+}
+
+// nextToken splits the next word, quoted phrase or field:value filter from s
+func nextToken(s string) (field, value string, quoted bool, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, " \t\n\"")
+		if end < 0 {
+			end = len(s)
+		}
+		word, rest := s[:end], s[end:]
+		f, v, ok := strings.Cut(word, ":")
+		if !ok || !isFilter(f) {
+			return "", word, false, rest
+		}
+		if v != "" || !strings.HasPrefix(rest, `"`) {
+			return f, v, false, rest
+		}
+		field, s = f, rest
+	}
+
+	// quoted value, up to the closing quote or the end
+	s = s[1:]
+	end := strings.IndexByte(s, '"')
+	if end < 0 {
+		return field, strings.TrimSpace(s), true, ""
+	}
+	return field, strings.TrimSpace(s[:end]), true, s[end+1:]
+}
+
+func isFilter(field string) bool {
+	switch strings.ToLower(field) {
+	case FilterTitle, FilterAuthor, FilterAfter, FilterBefore, FilterType:
+		return true
+	}
+	return false
+}
+
+// Text returns the words and phrases of the query, without quotes or filters
+func (q *Query) Text() string {
+	return strings.Join(slices.Concat(q.Terms, q.Phrases), " ")
+}
+
+// Filters returns the filters used by the query
+func (q *Query) Filters() []string {
+	var filters []string
+	add := func(filter string, used bool) {
+		if used {
+			filters = append(filters, filter)
+		}
+	}
+	add(FilterPhrase, len(q.Phrases) > 0)
+	add(FilterTitle, len(q.Title) > 0)
+	add(FilterAuthor, q.Author != "")
+	add(FilterAfter, !q.After.IsZero())
+	add(FilterBefore, !q.Before.IsZero())
+	add(FilterType, q.Type != "")
+	return filters
+}
+
+// Match reports whether the document satisfies the given filters of the query
+func (q *Query) Match(doc *Document, filters []string) bool {
+	for _, filter := range filters {
+		var ok bool
+		switch filter {
+		case FilterPhrase:
+			ok = allContained(q.Phrases, doc.Title+"\n"+doc.Text)
+		case FilterTitle:
+			ok = allContained(q.Title, doc.Title)
+		case FilterAuthor:
+			ok = allContained([]string{q.Author}, doc.Author)
+		case FilterAfter:
+			ok = !doc.LastEdited.IsZero() && !doc.LastEdited.Before(q.After)
+		case FilterBefore:
+			ok = !doc.LastEdited.IsZero() && doc.LastEdited.Before(q.Before)
+		case FilterType:
+			ok = strings.EqualFold(doc.ContentType, q.Type)
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func allContained(values []string, text string) bool {
+	text = strings.ToLower(text)
+	for _, v := range values {
+		if !strings.Contains(text, strings.ToLower(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryDescription documents the query language with the filters the provider supports
+func queryDescription(syntax string, filters []string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(syntax))
+	b.WriteString("\n\nThe query is made of words and optional filters, separated by spaces. All of them must match.")
+	for _, f := range filterSyntax {
+		if slices.Contains(filters, f.filter) {
+			b.WriteString("\n- " + f.syntax)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package drutil
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query    string
+		expected Query
+	}{
+		{"launch plan", Query{Terms: []string{"launch", "plan"}}},
+		{`"launch plan" rocket`, Query{Terms: []string{"rocket"}, Phrases: []string{"launch plan"}}},
+		{`title:roadmap Title:"Q1 goals" author:alice`, Query{Title: []string{"roadmap", "Q1 goals"}, Author: "alice"}},
+		{"after:2025-01-02 before:2025-02-01T12:00:00Z type:Page", Query{
+			After:  time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+			Before: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC),
+			Type:   "page",
+		}},
+		{`https://example.com note:x "unterminated phrase`, Query{
+			Terms:   []string{"https://example.com", "note:x"},
+			Phrases: []string{"unterminated phrase"},
+		}},
+		{`title: "" word`, Query{Terms: []string{"word"}}},
+	} {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("parse %q: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(*q, tt.expected) {
+			t.Errorf("parse %q: got %+v, expected %+v", tt.query, *q, tt.expected)
+		}
+	}
+
+	if _, err := ParseQuery("after:yesterday"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
+
+// listProvider returns all its documents for every search, and records the query it received
+type listProvider struct {
+	documents []Document
+	query     string
+}
+
+func (p *listProvider) GetSearchSyntax() string { return "Search everything." }
+
+func (p *listProvider) Search(_ context.Context, query string) ([]Document, error) {
+	p.query = query
+	return p.documents, nil
+}
+
+func (p *listProvider) Fetch(context.Context, string) (*Document, error) { return nil, nil }
+
+func TestSearcherLocalFilters(t *testing.T) {
+	ctx := context.Background()
+
+	p := &listProvider{documents: []Document{
+		{ID: "1", Title: "Launch plan", Text: "the rocket launch", Author: "Ana", LastEdited: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), ContentType: "page"},
+		{ID: "2", Title: "Roadmap", Text: "plan for the launch", Author: "Bo", LastEdited: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), ContentType: "page"},
+		{ID: "3", Title: "Launch retro", Text: "what went wrong", Author: "Ana", ContentType: "database"},
+	}}
+	s := newSearcher(p, Options{})
+
+	description := queryDescription(p.GetSearchSyntax(), s.filters())
+	if !strings.HasPrefix(description, "Search everything.") || !strings.Contains(description, "title:<word>") ||
+		!strings.Contains(description, "after:") {
+		t.Errorf("unexpected description %q", description)
+	}
+
+	results, err := s.search(ctx, `launch title:launch "the rocket"`, SearchOptions{})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if p.query != "launch the rocket" {
+		t.Errorf("provider got query %q", p.query)
+	}
+	if len(results.Results) != 1 || results.Results[0].ID != "1" {
+		t.Errorf("unexpected results %+v", results.Results)
+	}
+
+	// the typed fields of the documents are filtered locally
+	for query, expected := range map[string]string{
+		"launch author:ana after:2025-01-01": "1",
+		"plan before:2025-01-01":             "2",
+		"launch type:database":               "3",
+	} {
+		results, err := s.search(ctx, query, SearchOptions{})
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		if len(results.Results) != 1 || results.Results[0].ID != expected {
+			t.Errorf("search %q: unexpected results %+v", query, results.Results)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	defaultRerankCandidates  = 10
+	defaultRerankConcurrency = 4
+	defaultRerankBudget      = 5 * time.Second
+	// snippetSize is the approximate size of a snippet, in bytes
+	snippetSize = 300
+	// BM25 parameters
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// MetadataScore is the metadata key of the BM25 score of a reranked search result
+const MetadataScore = "score"
+
+// reranker fetches the top search results to rank them by BM25 against the query,
+// and replaces their text with a snippet of the best matching passage
+type reranker struct {
+	p           Provider
+	candidates  int
+	concurrency int
+	budget      time.Duration
+}
+
+func newReranker(p Provider, opts Options) *reranker {
+	r := &reranker{
+		p:           p,
+		candidates:  opts.RerankCandidates,
+		concurrency: opts.RerankConcurrency,
+		budget:      opts.RerankBudget,
+	}
+	if r.candidates == 0 {
+		r.candidates = defaultRerankCandidates
+	}
+	if r.concurrency == 0 {
+		r.concurrency = defaultRerankConcurrency
+	}
+	if r.budget == 0 {
+		r.budget = defaultRerankBudget
+	}
+	return r
+}
+
+// rerank returns the results with the fetched candidates first, by decreasing score,
+// followed by the results that were not fetched in their original order
+func (r *reranker) rerank(ctx context.Context, query string, results []Document) []Document {
+	terms := tokenize(query)
+	if len(terms) == 0 || len(results) == 0 {
+		return results
+	}
+	n := min(len(results), r.candidates)
+	texts := r.fetch(ctx, results[:n])
+
+	var fetched []int
+	for i, text := range texts {
+		if text != nil {
+			fetched = append(fetched, i)
+		}
+	}
+	if missing := n - len(fetched); missing > 0 {
+		Warn(ctx, fmt.Sprintf("%d of %d results could not be fetched for reranking and are ranked last", missing, n))
+	}
+
+	docs := make([][]string, len(fetched))
+	for i, j := range fetched {
+		docs[i] = tokenize(*texts[j])
+	}
+	scores := bm25(terms, docs)
+
+	order := make([]int, len(fetched))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		}
+		return 0
+	})
+
+	reranked := make([]Document, 0, len(results))
+	for _, i := range order {
+		j := fetched[i]
+		doc := withText(&results[j], snippet(*texts[j], terms), MetadataScore, strconv.FormatFloat(scores[i], 'f', 3, 64))
+		reranked = append(reranked, *doc)
+	}
+	for i, text := range texts {
+		if text == nil {
+			reranked = append(reranked, results[i])
+		}
+	}
+	return append(reranked, results[n:]...)
+}
+
+// fetch returns the text of the documents, or nil for those that could not be fetched within the budget.
+// It reports the number of documents fetched, instead of the progress of every fetch.
+func (r *reranker) fetch(ctx context.Context, docs []Document) []*string {
+	ctx, cancel := context.WithTimeout(ctx, r.budget)
+	defer cancel()
+	progressCtx := mcputil.ContinueProgress(ctx)
+	ctx = mcputil.WithoutProgress(ctx)
+	var mu sync.Mutex
+	var done int
+
+	texts := make([]*string, len(docs))
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+	for i, doc := range docs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fetched, err := r.p.Fetch(ctx, doc.ID)
+			mu.Lock()
+			done++
+			mcputil.ReportProgress(progressCtx, float64(done), float64(len(docs)), fmt.Sprintf("fetched %d of %d candidates", done, len(docs)))
+			mu.Unlock()
+			if err != nil {
+				mcputil.Logger(ctx).Debug("failed to fetch search result for reranking", "id", doc.ID, "error", err)
+				return
+			}
+			texts[i] = &fetched.Text
+		}()
+	}
+	wg.Wait()
+	return texts
+}
+
+// bm25 returns the Okapi BM25 score of every tokenized document for the query terms,
+// with the document frequencies computed over the documents themselves
+func bm25(terms []string, docs [][]string) []float64 {
+	scores := make([]float64, len(docs))
+	if len(docs) == 0 {
+		return scores
+	}
+	var total int
+	freqs := make([]map[string]int, len(docs))
+	df := make(map[string]int)
+	for i, doc := range docs {
+		total += len(doc)
+		freqs[i] = make(map[string]int)
+		for _, t := range doc {
+			freqs[i][t]++
+		}
+		for t := range freqs[i] {
+			df[t]++
+		}
+	}
+	avgLen := float64(total) / float64(len(docs))
+	if avgLen == 0 {
+		return scores
+	}
+
+	n := float64(len(docs))
+	for i, doc := range docs {
+		for _, t := range terms {
+			f := float64(freqs[i][t])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log((n-float64(df[t])+0.5)/(float64(df[t])+0.5) + 1)
+			scores[i] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(len(doc))/avgLen))
+		}
+	}
+	return scores
+}
+
+// tokenize returns the lower case words of the text
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// snippet returns the passage of the text with the most query term occurrences, with the terms in bold
+func snippet(text string, terms []string) string {
+	type match struct{ start, end int }
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+
+	// find the byte ranges of the query terms
+	var matches []match
+	start := -1
+	for i, r := range text + " " {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			if want[strings.ToLower(text[start:i])] {
+				matches = append(matches, match{start, i})
+			}
+			start = -1
+		}
+	}
+	if len(matches) == 0 {
+		return strings.TrimSpace(truncate(text, snippetSize))
+	}
+
+	// the window starting at a match that holds the most matches
+	best, bestCount := 0, 0
+	for i, m := range matches {
+		count := 0
+		for _, n := range matches[i:] {
+			if n.end-m.start > snippetSize {
+				break
+			}
+			count++
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	// start and end the snippet at word boundaries when they are close enough, and never inside a UTF-8 sequence
+	from := max(0, matches[best].start-snippetSize/4)
+	for limit := max(0, from-snippetSize/4); from > limit && !unicode.IsSpace(rune(text[from-1])); {
+		from--
+	}
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	to := min(len(text), from+snippetSize)
+	for limit := min(len(text), to+snippetSize/4); to < limit && !unicode.IsSpace(rune(text[to])); {
+		to++
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(text[pos:m.start])
+		b.WriteString("**" + text[m.start:m.end] + "**")
+		pos = m.end
+	}
+	b.WriteString(text[pos:to])
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
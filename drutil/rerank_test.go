@@ -0,0 +1,109 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+// slowProvider returns all its documents, in order, for every search and blocks fetches of the slow document
+type slowProvider struct {
+	staticProvider
+	order []string
+	slow  string
+}
+
+func (p *slowProvider) Search(context.Context, string) ([]Document, error) {
+	var results []Document
+	for _, id := range p.order {
+		doc := *p.documents[id]
+		doc.Text = doc.Title
+		results = append(results, doc)
+	}
+	return results, nil
+}
+
+func (p *slowProvider) Fetch(ctx context.Context, id string) (*Document, error) {
+	if id == p.slow {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	// fetches report their own progress, as the Notion provider reports the blocks fetched
+	mcputil.ReportProgress(ctx, 1, 0, "fetched 1 block")
+	return p.staticProvider.Fetch(ctx, id)
+}
+
+func TestRerank(t *testing.T) {
+	filler := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+	provider := &slowProvider{
+		staticProvider: staticProvider{documents: map[string]*Document{
+			"none":    {ID: "none", Title: "None", Text: "nothing relevant here"},
+			"once":    {ID: "once", Title: "Once", Text: "the launch is soon"},
+			"both":    {ID: "both", Title: "Both", Text: filler + "the launch plan for the launch of the rocket " + filler},
+			"slow":    {ID: "slow", Title: "Slow", Text: "launch plan"},
+			"outside": {ID: "outside", Title: "Outside", Text: "launch plan launch plan"},
+		}},
+		order: []string{"none", "once", "slow", "both", "outside"},
+		slow:  "slow",
+	}
+	r := newReranker(provider, Options{RerankCandidates: 4, RerankConcurrency: 2, RerankBudget: 100 * time.Millisecond})
+
+	var mu sync.Mutex
+	var progress []string
+	ctx := mcputil.WithProgressReporter(context.Background(), func(p, total float64, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, fmt.Sprintf("%v/%v %s", p, total, message))
+	})
+	ctx, w := withWarnings(ctx)
+	results, _ := provider.Search(ctx, "")
+	results = r.rerank(ctx, "Launch plan", results)
+
+	var ids []string
+	for _, doc := range results {
+		ids = append(ids, doc.ID)
+	}
+	if got, expected := strings.Join(ids, ","), "both,once,none,slow,outside"; got != expected {
+		t.Errorf("got order %s, expected %s", got, expected)
+	}
+
+	both := results[0]
+	if !strings.Contains(both.Text, "the **launch** **plan** for the **launch** of the rocket") ||
+		!strings.HasPrefix(both.Text, "…") || !strings.HasSuffix(both.Text, "…") || len(both.Text) > 2*snippetSize {
+		t.Errorf("unexpected snippet %q", both.Text)
+	}
+	if both.Metadata[MetadataScore] == "" || results[2].Metadata[MetadataScore] != "0.000" {
+		t.Errorf("unexpected scores %v %v", both.Metadata, results[2].Metadata)
+	}
+	if results[3].Text != "Slow" || results[4].Text != "Outside" {
+		t.Error("results that were not fetched should be unchanged")
+	}
+	if res := w.result(); res == nil || len(res.Meta["warnings"].([]string)) != 1 {
+		t.Errorf("expected a warning for the slow result, got %v", res)
+	}
+	// the progress counts the fetched candidates, rather than interleaving the progress of the fetches
+	expected := []string{"1/4 fetched 1 of 4 candidates", "2/4 fetched 2 of 4 candidates", "3/4 fetched 3 of 4 candidates", "4/4 fetched 4 of 4 candidates"}
+	if !slices.Equal(progress, expected) {
+		t.Errorf("unexpected progress %q", progress)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	for _, tt := range []struct {
+		text, expected string
+	}{
+		{"short text about Go", "short text about **Go**"},
+		{"no match", "no match"},
+		{"été go été", "été **go** été"},
+	} {
+		if got := snippet(tt.text, tokenize("go")); got != tt.expected {
+			t.Errorf("snippet(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package drutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	defaultPollInterval = time.Minute
+	resourceMIMEType    = "text/markdown"
+)
+
+// documentResources serves the documents of a Provider as MCP resources
+type documentResources struct {
+	p        Provider
+	template string
+	prefix   string
+	suffix   string
+	interval time.Duration
+	// server is set once the server is created, it is used to notify subscribers
+	server *mcp.Server
+
+	mu      sync.Mutex
+	watches map[watchKey]*watch
+}
+
+// watchKey identifies the watch of a document by the credentials it polls with,
+// so that a watch never outlives the subscriptions of their owner
+type watchKey struct {
+	owner string
+	uri   string
+}
+
+// watch polls a subscribed document for changes
+type watch struct {
+	key      watchKey
+	sessions map[*mcp.ServerSession]bool
+	cancel   context.CancelFunc
+}
+
+func newDocumentResources(p Provider, template string, interval time.Duration) *documentResources {
+	prefix, suffix, ok := strings.Cut(template, "{id}")
+	if !ok || strings.ContainsAny(prefix+suffix, "{}") {
+		panic(fmt.Sprintf("resource template %q must have a single {id} variable", template))
+	}
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	return &documentResources{
+		p:        p,
+		template: template,
+		prefix:   prefix,
+		suffix:   suffix,
+		interval: interval,
+		watches:  make(map[watchKey]*watch),
+	}
+}
+
+func (r *documentResources) uri(id string) string {
+	return r.prefix + url.PathEscape(id) + r.suffix
+}
+
+func (r *documentResources) id(uri string) (string, bool) {
+	rest, ok := strings.CutPrefix(uri, r.prefix)
+	if !ok {
+		return "", false
+	}
+	rest, ok = strings.CutSuffix(rest, r.suffix)
+	if !ok {
+		return "", false
+	}
+	id, err := url.PathUnescape(rest)
+	if err != nil || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// register adds the resource template, and the document list if the provider supports it
+func (r *documentResources) register(server *mcp.Server, name string) {
+	r.server = server
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "document",
+		Title:       name + " document",
+		Description: "A " + name + " document by ID",
+		URITemplate: r.template,
+		MIMEType:    resourceMIMEType,
+	}, r.read)
+	if lister, ok := r.p.(DocumentLister); ok {
+		server.AddReceivingMiddleware(r.listMiddleware(lister))
+	}
+}
+
+func (r *documentResources) read(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	id, ok := r.id(req.Params.URI)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	doc, err := r.p.Fetch(ctx, id)
+	if err != nil {
+		mcputil.Logger(ctx).Error("read resource failed", "uri", req.Params.URI, "error", err)
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: req.Params.URI, MIMEType: resourceMIMEType, Text: doc.Text},
+		},
+	}, nil
+}
+
+// listMiddleware answers resources/list with the documents of the caller,
+// as the SDK only lists resources that were added to the server
+func (r *documentResources) listMiddleware(lister DocumentLister) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if method != "resources/list" {
+				return next(ctx, method, req)
+			}
+			documents, err := lister.ListDocuments(ctx)
+			if err != nil {
+				mcputil.Logger(ctx).Error("list documents failed", "error", err)
+				return nil, fmt.Errorf("list documents: %w", err)
+			}
+			resources := make([]*mcp.Resource, 0, len(documents))
+			for _, doc := range documents {
+				resources = append(resources, &mcp.Resource{
+					URI:      r.uri(doc.ID),
+					Name:     doc.ID,
+					Title:    doc.Title,
+					MIMEType: resourceMIMEType,
+				})
+			}
+			return &mcp.ListResourcesResult{Resources: resources}, nil
+		}
+	}
+}
+
+// subscribe starts polling the document for changes with the credentials of the subscriber,
+// unless a subscriber with the same credentials already did
+func (r *documentResources) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	id, ok := r.id(uri)
+	if !ok {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	// also checks that the subscriber has access to the document
+	version, err := r.version(ctx, id)
+	if err != nil {
+		return fmt.Errorf("subscribe %s: %w", uri, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := watchKey{owner: watchOwner(ctx), uri: uri}
+	if w, ok := r.watches[key]; ok {
+		w.sessions[req.Session] = true
+		return nil
+	}
+	pollCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	w := &watch{
+		key:      key,
+		sessions: map[*mcp.ServerSession]bool{req.Session: true},
+		cancel:   cancel,
+	}
+	r.watches[key] = w
+	go r.poll(pollCtx, w, id, version)
+	return nil
+}
+
+// unsubscribe drops the session from the watches of the document, whatever credentials it subscribed with
+func (r *documentResources) unsubscribe(_ context.Context, req *mcp.UnsubscribeRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, w := range r.watches {
+		if key.uri == req.Params.URI && w.sessions[req.Session] {
+			r.remove(w, req.Session)
+		}
+	}
+	return nil
+}
+
+// remove drops the session from the watch, and stops it once no session is left. r.mu must be held.
+func (r *documentResources) remove(w *watch, ss *mcp.ServerSession) {
+	delete(w.sessions, ss)
+	if len(w.sessions) == 0 {
+		w.cancel()
+		delete(r.watches, w.key)
+	}
+}
+
+// watchOwner identifies the credentials of the caller, its Pomerium user and token
+func watchOwner(ctx context.Context) string {
+	h := sha256.New()
+	if identity, ok := ctxutil.IdentityFromContext(ctx); ok {
+		h.Write([]byte(identity.User))
+	}
+	h.Write([]byte{0})
+	if token, err := ctxutil.AuthorizationTokenFromContext(ctx); err == nil {
+		h.Write([]byte(token))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// poll notifies the subscribers of the document when it changes.
+// The SDK notifies every session subscribed to the URI, whichever watch noticed the change.
+func (r *documentResources) poll(ctx context.Context, w *watch, id, version string) {
+	uri := w.key.uri
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.prune(w) {
+			return
+		}
+
+		v, err := r.version(ctx, id)
+		if err != nil {
+			slog.Warn("failed to check document for changes", "uri", uri, "error", err)
+			continue
+		}
+		if v == version {
+			continue
+		}
+		version = v
+		if err := r.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+			slog.Warn("failed to notify resource update", "uri", uri, "error", err)
+		}
+	}
+}
+
+// prune forgets the sessions of the watch that ended without unsubscribing,
+// and reports whether the watch is still active
+func (r *documentResources) prune(w *watch) bool {
+	live := make(map[*mcp.ServerSession]bool)
+	for ss := range r.server.Sessions() {
+		live[ss] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watches[w.key] != w {
+		return false
+	}
+	for ss := range w.sessions {
+		if !live[ss] {
+			r.remove(w, ss)
+		}
+	}
+	return r.watches[w.key] == w
+}
+
+// version returns the provider version of the document, or a hash of its content
+func (r *documentResources) version(ctx context.Context, id string) (string, error) {
+	if v, ok := r.p.(DocumentVersioner); ok {
+		return v.DocumentVersion(ctx, id)
+	}
+	doc, err := r.p.Fetch(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%s", len(doc.Title), doc.Title)
+	h.Write([]byte(doc.Text))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// withSubscriptions returns a copy of opts that handles resource subscriptions
+func withSubscriptions(opts *mcp.ServerOptions, r *documentResources) *mcp.ServerOptions {
+	var o mcp.ServerOptions
+	if opts != nil {
+		o = *opts
+	}
+	o.SubscribeHandler = r.subscribe
+	o.UnsubscribeHandler = r.unsubscribe
+	return &o
+}
@@ -0,0 +1,198 @@
+package drutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+type versionedProvider struct {
+	staticProvider
+	version atomic.Int64
+}
+
+func (p *versionedProvider) ListDocuments(context.Context) ([]Document, error) {
+	return []Document{*p.documents["a"]}, nil
+}
+
+func (p *versionedProvider) DocumentVersion(_ context.Context, id string) (string, error) {
+	if _, err := p.Fetch(context.Background(), id); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(p.version.Load(), 10), nil
+}
+
+func (p *versionedProvider) CompleteDocumentID(_ context.Context, value string) ([]string, error) {
+	return []string{value + "a"}, nil
+}
+
+func TestResources(t *testing.T) {
+	ctx := context.Background()
+
+	provider := &versionedProvider{staticProvider: staticProvider{documents: map[string]*Document{
+		"a": {ID: "a", Title: "Page A", Text: "text of a"},
+	}}}
+	server := BuildMCPServer("Test", provider, Options{
+		Resources:        true,
+		ResourceTemplate: "test://page/{id}",
+		PollInterval:     10 * time.Millisecond,
+	})
+
+	updated := make(chan string, 1)
+	session := mcputiltest.Connect(ctx, t, server, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			select {
+			case updated <- req.Params.URI:
+			default:
+			}
+		},
+	})
+
+	templates, err := session.ListResourceTemplates(ctx, nil)
+	if err != nil {
+		t.Fatalf("list resource templates: %v", err)
+	}
+	if len(templates.ResourceTemplates) != 1 || templates.ResourceTemplates[0].URITemplate != "test://page/{id}" {
+		t.Errorf("unexpected resource templates: %+v", templates.ResourceTemplates)
+	}
+
+	for _, ref := range []*mcp.CompleteReference{
+		{Type: "ref/resource", URI: "test://page/{id}"},
+		{Type: "ref/resource", URI: "test://other/{id}"},
+		{Type: "ref/prompt", Name: "fetch"},
+	} {
+		res, err := session.Complete(ctx, &mcp.CompleteParams{Ref: ref, Argument: mcp.CompleteParamsArgument{Name: "id", Value: "x"}})
+		if err != nil {
+			t.Fatalf("complete: %v", err)
+		}
+		if ref.URI == "test://page/{id}" && (len(res.Completion.Values) != 1 || res.Completion.Values[0] != "xa") {
+			t.Errorf("expected the id to be completed, got %q", res.Completion.Values)
+		} else if ref.URI != "test://page/{id}" && len(res.Completion.Values) != 0 {
+			t.Errorf("expected no completion for %+v, got %q", ref, res.Completion.Values)
+		}
+	}
+
+	list, err := session.ListResources(ctx, nil)
+	if err != nil {
+		t.Fatalf("list resources: %v", err)
+	}
+	if len(list.Resources) != 1 || list.Resources[0].URI != "test://page/a" || list.Resources[0].Title != "Page A" {
+		t.Errorf("unexpected resources: %+v", list.Resources)
+	}
+
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "test://page/a"})
+	if err != nil {
+		t.Fatalf("read resource: %v", err)
+	}
+	if len(read.Contents) != 1 || read.Contents[0].Text != "text of a" {
+		t.Errorf("unexpected contents: %+v", read.Contents)
+	}
+
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "test://page/missing"}); err == nil {
+		t.Error("expected an error reading a missing document")
+	}
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "test://page/missing"}); err == nil {
+		t.Error("expected an error subscribing to a missing document")
+	}
+
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "test://page/a"}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	provider.version.Add(1)
+	select {
+	case uri := <-updated:
+		if uri != "test://page/a" {
+			t.Errorf("got update for %q", uri)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resource update notification")
+	}
+
+	if err := session.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: "test://page/a"}); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	provider.version.Add(1)
+	select {
+	case uri := <-updated:
+		t.Errorf("got update for %q after unsubscribing", uri)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// callerProvider records the tokens the versions of documents are checked with
+type callerProvider struct {
+	versionedProvider
+	mu     sync.Mutex
+	tokens map[string]int
+}
+
+func (p *callerProvider) DocumentVersion(ctx context.Context, id string) (string, error) {
+	token, _ := ctxutil.AuthorizationTokenFromContext(ctx)
+	p.mu.Lock()
+	p.tokens[token]++
+	p.mu.Unlock()
+	return p.versionedProvider.DocumentVersion(ctx, id)
+}
+
+func (p *callerProvider) reset() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tokens := p.tokens
+	p.tokens = make(map[string]int)
+	return tokens
+}
+
+func TestResourceWatchOwners(t *testing.T) {
+	ctx := context.Background()
+	provider := &callerProvider{
+		versionedProvider: versionedProvider{staticProvider: staticProvider{documents: map[string]*Document{
+			"a": {ID: "a", Title: "Page A", Text: "text of a"},
+		}}},
+		tokens: make(map[string]int),
+	}
+	server := BuildMCPServer("Test", provider, Options{
+		Resources:        true,
+		ResourceTemplate: "test://page/{id}",
+		PollInterval:     10 * time.Millisecond,
+	})
+
+	subscribe := func(token string) *mcp.ClientSession {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		session := mcputiltest.Connect(ctxutil.AuthorizationTokenFromRequest(ctx, req), t, server, nil)
+		if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: "test://page/a"}); err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+		return session
+	}
+
+	// each subscriber is polled for with their own credentials
+	first := subscribe("first")
+	subscribe("second")
+	time.Sleep(100 * time.Millisecond)
+	if tokens := provider.reset(); tokens["first"] < 2 || tokens["second"] < 2 {
+		t.Errorf("expected both tokens to poll, got %v", tokens)
+	}
+
+	// the credentials of a subscriber are no longer used once they unsubscribed
+	if err := first.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: "test://page/a"}); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	// let a check that was running finish
+	time.Sleep(20 * time.Millisecond)
+	provider.reset()
+	time.Sleep(100 * time.Millisecond)
+	if tokens := provider.reset(); tokens["first"] != 0 || tokens["second"] == 0 {
+		t.Errorf("expected only the remaining subscriber to poll, got %v", tokens)
+	}
+}
@@ -0,0 +1,206 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	defaultMaxTextSize = 50000
+	defaultChunkSize   = 20000
+	// maxSamplingChunks bounds the number of sampling requests made for a single document
+	maxSamplingChunks = 16
+	// maxReduceRounds bounds the number of times partial results are condensed again
+	maxReduceRounds = 3
+	// samplingMaxTokens is the maximum number of tokens requested from the client's model
+	samplingMaxTokens = 2048
+)
+
+const samplingSystemPrompt = "You condense documents for another assistant that has limited context. " +
+	"Only use information from the document. Preserve names, dates, figures and identifiers exactly."
+
+// condenser reduces fetched documents to what fits the client context,
+// using MCP sampling to have the client's model summarize them or extract the parts relevant to a question
+type condenser struct {
+	session     *mcp.ServerSession
+	maxTextSize int
+	chunkSize   int
+}
+
+func newCondenser(session *mcp.ServerSession, opts Options) *condenser {
+	c := &condenser{
+		session:     session,
+		maxTextSize: opts.MaxTextSize,
+		chunkSize:   opts.ChunkSize,
+	}
+	if c.maxTextSize == 0 {
+		c.maxTextSize = defaultMaxTextSize
+	}
+	if c.chunkSize == 0 {
+		c.chunkSize = defaultChunkSize
+	}
+	return c
+}
+
+// condense returns the document with its text condensed if a question was asked or if it is too long.
+// If sampling is not available, long text is truncated instead.
+func (c *condenser) condense(ctx context.Context, doc *Document, question string) *Document {
+	if question == "" && len(doc.Text) <= c.maxTextSize {
+		return doc
+	}
+
+	if c.supportsSampling() {
+		text, err := c.mapReduce(ctx, doc.Title, doc.Text, question)
+		if err == nil {
+			return withText(doc, text, "condensed", "sampling")
+		}
+		mcputil.Logger(ctx).Warn("sampling failed, falling back to truncation", "id", doc.ID, "error", err)
+	}
+
+	if len(doc.Text) <= c.maxTextSize {
+		return doc
+	}
+	notice := fmt.Sprintf("\n\n[Document truncated from %d to %d bytes.]", len(doc.Text), c.maxTextSize)
+	return withText(doc, truncate(doc.Text, c.maxTextSize)+notice, "truncated", "true")
+}
+
+func (c *condenser) supportsSampling() bool {
+	if c.session == nil {
+		return false
+	}
+	params := c.session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Sampling != nil
+}
+
+// mapReduce condenses every chunk of the text, then condenses the combined results until they fit a single chunk.
+// Its progress counts the sampling requests of all the rounds, after the progress of the fetch.
+func (c *condenser) mapReduce(ctx context.Context, title, text, question string) (string, error) {
+	ctx = mcputil.ContinueProgress(ctx)
+	chunks := splitChunks(text, c.chunkSize)
+	var omitted bool
+	if len(chunks) > maxSamplingChunks {
+		chunks, omitted = chunks[:maxSamplingChunks], true
+	}
+
+	sampled := 0
+	for round := 0; len(chunks) > 1 && round < maxReduceRounds; round++ {
+		parts := make([]string, 0, len(chunks))
+		for i, chunk := range chunks {
+			part, err := c.sample(ctx, condensePrompt(title, question, chunk, i+1, len(chunks)))
+			if err != nil {
+				return "", fmt.Errorf("condense chunk %d of %d: %w", i+1, len(chunks), err)
+			}
+			parts = append(parts, part)
+			sampled++
+			// the total counts the chunks left in this round and the final request, later rounds are not known yet
+			mcputil.ReportProgress(ctx, float64(sampled), float64(sampled+len(chunks)-i), fmt.Sprintf("condensed %d of %d chunks", i+1, len(chunks)))
+		}
+		chunks = splitChunks(strings.Join(parts, "\n\n"), c.chunkSize)
+	}
+
+	combined := strings.Join(chunks, "\n\n")
+	var notice string
+	if len(combined) > c.chunkSize {
+		notice = fmt.Sprintf("The condensed parts were truncated from %d to %d bytes after %d rounds.", len(combined), c.chunkSize, maxReduceRounds)
+		Warn(ctx, notice)
+		combined = truncate(combined, c.chunkSize)
+	}
+	result, err := c.sample(ctx, condensePrompt(title, question, combined, 0, 0))
+	if err != nil {
+		return "", err
+	}
+	sampled++
+	mcputil.ReportProgress(ctx, float64(sampled), float64(sampled), "condensed the document")
+	if omitted {
+		result += fmt.Sprintf("\n\n[Only the first %d bytes of the document were condensed.]", maxSamplingChunks*c.chunkSize)
+	}
+	if notice != "" {
+		result += "\n\n[" + notice + "]"
+	}
+	return result, nil
+}
+
+func (c *condenser) sample(ctx context.Context, prompt string) (string, error) {
+	res, err := c.session.CreateMessage(ctx, &mcp.CreateMessageParams{
+		SystemPrompt: samplingSystemPrompt,
+		MaxTokens:    samplingMaxTokens,
+		Messages: []*mcp.SamplingMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: prompt}},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	text, ok := res.Content.(*mcp.TextContent)
+	if !ok {
+		return "", fmt.Errorf("unexpected sampling result content %T", res.Content)
+	}
+	return text.Text, nil
+}
+
+// condensePrompt asks to condense one of n parts of a document, or the whole document if n is zero
+func condensePrompt(title, question, text string, part, n int) string {
+	var b strings.Builder
+	if question != "" {
+		fmt.Fprintf(&b, "Extract the passages of the document below that are relevant to the question %q, quoting them verbatim where possible. ", question)
+		b.WriteString("If nothing is relevant, answer \"Nothing relevant.\"\n\n")
+	} else {
+		b.WriteString("Summarize the document below, keeping its structure and key facts.\n\n")
+	}
+	fmt.Fprintf(&b, "Document: %s\n", title)
+	if n > 0 {
+		fmt.Fprintf(&b, "Part %d of %d\n", part, n)
+	}
+	b.WriteString("\n---\n")
+	b.WriteString(text)
+	return b.String()
+}
+
+// splitChunks splits text into chunks of at most size bytes, preferring line boundaries
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		i := strings.LastIndexByte(text[:size], '\n')
+		if i <= 0 {
+			i = len(truncate(text, size))
+		}
+		if i == 0 {
+			_, i = utf8.DecodeRuneInString(text)
+		}
+		chunks = append(chunks, text[:i])
+		text = strings.TrimLeft(text[i:], "\n")
+	}
+	if text != "" || len(chunks) == 0 {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// truncate returns at most size bytes of s, without splitting a UTF-8 sequence
+func truncate(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size]
+}
+
+func withText(doc *Document, text, key, value string) *Document {
+	d := *doc
+	d.Text = text
+	d.Metadata = maps.Clone(doc.Metadata)
+	if d.Metadata == nil {
+		d.Metadata = make(map[string]string)
+	}
+	d.Metadata[key] = value
+	return &d
+}
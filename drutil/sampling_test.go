@@ -0,0 +1,221 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+type staticProvider struct {
+	documents map[string]*Document
+}
+
+func (p *staticProvider) GetSearchSyntax() string { return "search by title" }
+
+func (p *staticProvider) Search(context.Context, string) ([]Document, error) { return nil, nil }
+
+func (p *staticProvider) Fetch(_ context.Context, id string) (*Document, error) {
+	doc, ok := p.documents[id]
+	if !ok {
+		return nil, fmt.Errorf("document %s not found", id)
+	}
+	return doc, nil
+}
+
+// progressProvider reports the progress of its fetches, as providers that fetch documents in parts do
+type progressProvider struct {
+	staticProvider
+}
+
+func (p *progressProvider) Fetch(ctx context.Context, id string) (*Document, error) {
+	for i := range 3 {
+		mcputil.ReportProgress(ctx, float64(i+1), 0, fmt.Sprintf("fetched %d parts", i+1))
+	}
+	return p.staticProvider.Fetch(ctx, id)
+}
+
+func fetchDocument(ctx context.Context, t *testing.T, server *mcp.Server, opts *mcp.ClientOptions, args map[string]any) *Document {
+	t.Helper()
+
+	session := mcputiltest.Connect(ctx, t, server, opts)
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "fetch", Arguments: args})
+	if err != nil {
+		t.Fatalf("call fetch: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("fetch failed: %v", res.Content)
+	}
+	m := res.StructuredContent.(map[string]any)
+	doc := &Document{Text: m["text"].(string), Metadata: map[string]string{}}
+	if md, ok := m["metadata"].(map[string]any); ok {
+		for k, v := range md {
+			doc.Metadata[k] = v.(string)
+		}
+	}
+	return doc
+}
+
+func TestFetchSampling(t *testing.T) {
+	ctx := context.Background()
+
+	// 10 lines of 100 bytes, in chunks of 250 bytes that hold 2 lines
+	lines := make([]string, 10)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%-99d", i)
+	}
+	provider := &staticProvider{documents: map[string]*Document{
+		"long":  {ID: "long", Title: "Long", Text: strings.Join(lines, "\n")},
+		"short": {ID: "short", Title: "Short", Text: "short text"},
+	}}
+	server := BuildMCPServer("test", provider, Options{Sampling: true, MaxTextSize: 500, ChunkSize: 250})
+
+	var mu sync.Mutex
+	var prompts []string
+	opts := &mcp.ClientOptions{
+		CreateMessageHandler: func(_ context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			prompts = append(prompts, req.Params.Messages[0].Content.(*mcp.TextContent).Text)
+			return &mcp.CreateMessageResult{
+				Model:   "test",
+				Role:    "assistant",
+				Content: &mcp.TextContent{Text: fmt.Sprintf("summary %d", len(prompts))},
+			}, nil
+		},
+	}
+
+	t.Run("short without question", func(t *testing.T) {
+		prompts = nil
+		doc := fetchDocument(ctx, t, server, opts, map[string]any{"id": "short"})
+		if doc.Text != "short text" || len(prompts) != 0 {
+			t.Errorf("expected short document to be returned as is, got %q after %d prompts", doc.Text, len(prompts))
+		}
+	})
+
+	t.Run("long", func(t *testing.T) {
+		prompts = nil
+		doc := fetchDocument(ctx, t, server, opts, map[string]any{"id": "long"})
+		// 5 chunks are condensed, then the combined parts once more
+		if len(prompts) != 6 {
+			t.Fatalf("expected 6 sampling requests, got %d", len(prompts))
+		}
+		if !strings.Contains(prompts[0], "Part 1 of 5") || !strings.Contains(prompts[0], "Summarize") {
+			t.Errorf("unexpected first prompt: %q", prompts[0])
+		}
+		if !strings.Contains(prompts[5], "summary 1\n\nsummary 2") {
+			t.Errorf("expected final prompt to combine partial results, got %q", prompts[5])
+		}
+		if doc.Text != "summary 6" || doc.Metadata["condensed"] != "sampling" {
+			t.Errorf("unexpected document %q %v", doc.Text, doc.Metadata)
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		var progress []float64
+		var total float64
+		opts := &mcp.ClientOptions{
+			CreateMessageHandler: opts.CreateMessageHandler,
+			ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+				mu.Lock()
+				defer mu.Unlock()
+				progress = append(progress, req.Params.Progress)
+				total = req.Params.Total
+			},
+		}
+		server := BuildMCPServer("test", &progressProvider{*provider}, Options{Sampling: true, MaxTextSize: 500, ChunkSize: 250})
+		session := mcputiltest.Connect(ctx, t, server, opts)
+		_, err := session.CallTool(ctx, &mcp.CallToolParams{Meta: mcp.Meta{"progressToken": "fetch"}, Name: "fetch", Arguments: map[string]any{"id": "long"}})
+		if err != nil {
+			t.Fatalf("call fetch: %v", err)
+		}
+
+		// notifications are delivered asynchronously, in order: 3 for the fetch, 5 for the chunks and 1 for the result
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			n := len(progress)
+			mu.Unlock()
+			if n >= 9 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(progress) != 9 {
+			t.Fatalf("expected 9 progress notifications, got %v", progress)
+		}
+		for i := 1; i < len(progress); i++ {
+			if progress[i] <= progress[i-1] {
+				t.Errorf("expected increasing progress, got %v", progress)
+				break
+			}
+		}
+		if last := progress[len(progress)-1]; last != total {
+			t.Errorf("expected the last progress to reach the total, got %v of %v", last, total)
+		}
+	})
+
+	t.Run("reduce rounds", func(t *testing.T) {
+		// summaries as long as the chunks never fit a single one
+		opts := &mcp.ClientOptions{
+			CreateMessageHandler: func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+				return &mcp.CreateMessageResult{Model: "test", Role: "assistant", Content: &mcp.TextContent{Text: strings.Repeat("s", 200)}}, nil
+			},
+		}
+		doc := fetchDocument(ctx, t, server, opts, map[string]any{"id": "long"})
+		if !strings.Contains(doc.Text, "[The condensed parts were truncated from") {
+			t.Errorf("expected a truncation notice, got %q", doc.Text)
+		}
+	})
+
+	t.Run("short with question", func(t *testing.T) {
+		prompts = nil
+		doc := fetchDocument(ctx, t, server, opts, map[string]any{"id": "short", "question": "what is it?"})
+		if len(prompts) != 1 || !strings.Contains(prompts[0], `"what is it?"`) {
+			t.Fatalf("expected a single prompt with the question, got %q", prompts)
+		}
+		if doc.Text != "summary 1" {
+			t.Errorf("unexpected document text %q", doc.Text)
+		}
+	})
+
+	t.Run("without sampling", func(t *testing.T) {
+		doc := fetchDocument(ctx, t, server, nil, map[string]any{"id": "long", "question": "what is it?"})
+		if !strings.HasPrefix(doc.Text, lines[0]) || !strings.Contains(doc.Text, "[Document truncated from 999 to 500 bytes") {
+			t.Errorf("expected truncated text with a notice, got %q", doc.Text)
+		}
+		if doc.Metadata["truncated"] != "true" {
+			t.Errorf("expected truncated metadata, got %v", doc.Metadata)
+		}
+	})
+}
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		text     string
+		size     int
+		expected []string
+	}{
+		{"", 10, []string{""}},
+		{"abc", 10, []string{"abc"}},
+		{"aaaa\nbbbb\ncccc", 10, []string{"aaaa\nbbbb", "cccc"}},
+		{"aaaaaaaaaaaa", 5, []string{"aaaaa", "aaaaa", "aa"}},
+		{"ééé", 3, []string{"é", "é", "é"}},
+	}
+	for _, tt := range tests {
+		chunks := splitChunks(tt.text, tt.size)
+		if fmt.Sprint(chunks) != fmt.Sprint(tt.expected) {
+			t.Errorf("splitChunks(%q, %d): expected %q, got %q", tt.text, tt.size, tt.expected, chunks)
+		}
+	}
+}
@@ -1,7 +1,15 @@
 // Package drutil provides utility functions for OpenAI DeepResearcher compatibility
 package drutil
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
 
 type Document struct {
 	ID       string            `json:"id"`
@@ -9,6 +17,99 @@ type Document struct {
 	Text     string            `json:"text"`
 	URL      *string           `json:"url,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// The optional typed metadata below is encoded in Metadata, under the Metadata* keys,
+	// to keep the document JSON compatible with OpenAI DeepResearch.
+
+	// Author is the name of the creator of the document
+	Author string `json:"-"`
+	// Created and LastEdited are the creation and last edit times of the document
+	Created    time.Time `json:"-"`
+	LastEdited time.Time `json:"-"`
+	// Parent is the ID of the document, database or workspace that contains the document
+	Parent string `json:"-"`
+	// ContentType is the kind of document, such as page or database
+	ContentType string `json:"-"`
+	// Tags are labels of the document
+	Tags []string `json:"-"`
+}
+
+// Metadata keys of the typed Document metadata
+const (
+	MetadataAuthor      = "author"
+	MetadataCreated     = "created_time"
+	MetadataLastEdited  = "last_edited_time"
+	MetadataParent      = "parent"
+	MetadataContentType = "content_type"
+	MetadataTags        = "tags"
+)
+
+// documentJSON is the JSON shape of a Document
+type documentJSON struct {
+	ID       string            `json:"id"`
+	Title    string            `json:"title"`
+	Text     string            `json:"text"`
+	URL      *string           `json:"url,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// MarshalJSON encodes the typed metadata in the metadata object.
+// Times are RFC 3339 in UTC, so they sort as strings, and tags are comma separated.
+func (d Document) MarshalJSON() ([]byte, error) {
+	metadata := maps.Clone(d.Metadata)
+	set := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = value
+	}
+	set(MetadataAuthor, d.Author)
+	set(MetadataCreated, formatTime(d.Created))
+	set(MetadataLastEdited, formatTime(d.LastEdited))
+	set(MetadataParent, d.Parent)
+	set(MetadataContentType, d.ContentType)
+	set(MetadataTags, strings.Join(d.Tags, ","))
+	return json.Marshal(documentJSON{
+		ID:       d.ID,
+		Title:    d.Title,
+		Text:     d.Text,
+		URL:      d.URL,
+		Metadata: metadata,
+	})
+}
+
+// UnmarshalJSON decodes the typed metadata from the metadata object, which is kept as is
+func (d *Document) UnmarshalJSON(data []byte) error {
+	var v documentJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*d = Document{
+		ID:          v.ID,
+		Title:       v.Title,
+		Text:        v.Text,
+		URL:         v.URL,
+		Metadata:    v.Metadata,
+		Author:      v.Metadata[MetadataAuthor],
+		Parent:      v.Metadata[MetadataParent],
+		ContentType: v.Metadata[MetadataContentType],
+	}
+	d.Created, _ = time.Parse(time.RFC3339, v.Metadata[MetadataCreated])
+	d.LastEdited, _ = time.Parse(time.RFC3339, v.Metadata[MetadataLastEdited])
+	if tags := v.Metadata[MetadataTags]; tags != "" {
+		d.Tags = strings.Split(tags, ",")
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 type Provider interface {
@@ -16,3 +117,85 @@ type Provider interface {
 	Search(ctx context.Context, query string) ([]Document, error)
 	Fetch(ctx context.Context, id string) (*Document, error)
 }
+
+// ToolAnnotator is an optional interface a Provider may implement to declare
+// the annotations of the search and fetch tools built on top of it.
+// Returning nil keeps the default read-only, open world annotations.
+type ToolAnnotator interface {
+	ToolAnnotations(tool string) *mcp.ToolAnnotations
+}
+
+// DocumentCompleter is an optional interface a Provider may implement to
+// complete document IDs from a partial title, in the id variable of the document resource template.
+type DocumentCompleter interface {
+	CompleteDocumentID(ctx context.Context, value string) ([]string, error)
+}
+
+// DocumentLister is an optional interface a Provider may implement to list documents,
+// such as recently edited or starred ones, through resources/list.
+type DocumentLister interface {
+	ListDocuments(ctx context.Context) ([]Document, error)
+}
+
+// DocumentVersioner is an optional interface a Provider may implement to cheaply detect
+// changes of subscribed document resources. The version must change whenever the document does.
+// Documents of providers that do not implement it are fetched and compared instead.
+type DocumentVersioner interface {
+	DocumentVersion(ctx context.Context, id string) (string, error)
+}
+
+// SubtreeFetcher is an optional interface a Provider may implement to fetch a document with its child
+// documents inlined, through the depth argument of the fetch tool.
+type SubtreeFetcher interface {
+	// MaxFetchDepth returns the maximum depth accepted by FetchSubtree
+	MaxFetchDepth() int
+	// FetchSubtree fetches the document, and its descendants up to depth levels below it
+	FetchSubtree(ctx context.Context, id string, depth int) (*Document, error)
+}
+
+// Sort orders of search results
+const (
+	SortRelevance      = "relevance"
+	SortLastEditedDesc = "last_edited_desc"
+	SortLastEditedAsc  = "last_edited_asc"
+)
+
+// SearchOptions page, filter and sort a search. Zero values leave the provider defaults.
+type SearchOptions struct {
+	// Limit is the maximum number of results
+	Limit int
+	// Cursor continues a previous search from its SearchResults.NextCursor
+	Cursor string
+	// EditedAfter and EditedBefore restrict results to documents last edited in the range
+	EditedAfter  time.Time
+	EditedBefore time.Time
+	// Type restricts results to one of the provider SearchTypes
+	Type string
+	// Sort is one of the Sort constants
+	Sort string
+}
+
+// SearchResults is a page of search results
+type SearchResults struct {
+	Results []Document
+	// NextCursor is set when there are more results
+	NextCursor string
+}
+
+// PagedSearcher is an optional interface a Provider may implement to support
+// paging, filtering and sorting in the search tool.
+type PagedSearcher interface {
+	// SearchTypes returns the document types accepted by SearchOptions.Type
+	SearchTypes() []string
+	SearchWithOptions(ctx context.Context, query string, opts SearchOptions) (*SearchResults, error)
+}
+
+// QuerySearcher is an optional interface a Provider may implement to search with parsed queries,
+// and apply the filters of the query language itself. It takes precedence over PagedSearcher,
+// with the filters of SearchOptions moved to the query.
+type QuerySearcher interface {
+	// SearchFilters returns the filters that SearchQuery applies, and those that it does not apply
+	// but whose Document fields it fills, so that they are applied to the results.
+	SearchFilters() (pushdown, local []string)
+	SearchQuery(ctx context.Context, q *Query, opts SearchOptions) (*SearchResults, error)
+}
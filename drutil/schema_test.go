@@ -0,0 +1,56 @@
+package drutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDocumentJSON(t *testing.T) {
+	url := "https://example.com/a"
+	doc := Document{
+		ID:          "a",
+		Title:       "A",
+		Text:        "text",
+		URL:         &url,
+		Metadata:    map[string]string{"source": "test"},
+		Author:      "Alice",
+		Created:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		LastEdited:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Parent:      "page:b",
+		ContentType: "page",
+		Tags:        []string{"x", "y"},
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	expected := `{"id":"a","title":"A","text":"text","url":"https://example.com/a","metadata":{` +
+		`"author":"Alice","content_type":"page","created_time":"2024-01-02T02:04:05Z","last_edited_time":"2025-01-02T03:04:05Z",` +
+		`"parent":"page:b","source":"test","tags":"x,y"}}`
+	if string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+	if doc.Metadata["author"] != "" {
+		t.Error("marshal modified the document metadata")
+	}
+
+	var decoded Document
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.Author != doc.Author || !decoded.Created.Equal(doc.Created) || !decoded.LastEdited.Equal(doc.LastEdited) ||
+		decoded.Parent != doc.Parent || decoded.ContentType != doc.ContentType || !reflect.DeepEqual(decoded.Tags, doc.Tags) {
+		t.Errorf("got %+v, expected %+v", decoded, doc)
+	}
+
+	data, err = json.Marshal(Document{ID: "b", Title: "B"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if expected := `{"id":"b","title":"B","text":""}`; string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+}
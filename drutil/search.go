@@ -0,0 +1,258 @@
+package drutil
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+// maxSearchLimit is the maximum number of results of a single search
+const maxSearchLimit = 100
+
+type searchArgs struct {
+	Query string `json:"query" jsonschema:"The search query to execute"`
+}
+
+type searchResult struct {
+	Results []Document `json:"results"`
+}
+
+type pagedSearchArgs struct {
+	Query  string `json:"query" jsonschema:"The search query to execute"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"Maximum number of results to return"`
+	Cursor string `json:"cursor,omitempty" jsonschema:"The next_cursor of a previous search with the same arguments, to get the following results"`
+	After  string `json:"after,omitempty" jsonschema:"Only return documents last edited at or after this date, as YYYY-MM-DD or RFC 3339"`
+	Before string `json:"before,omitempty" jsonschema:"Only return documents last edited before this date, as YYYY-MM-DD or RFC 3339"`
+	Type   string `json:"type,omitempty" jsonschema:"Only return documents of this type"`
+	Sort   string `json:"sort,omitempty" jsonschema:"Order of the results, by relevance by default"`
+}
+
+type pagedSearchResult struct {
+	Results    []Document `json:"results"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// searcher runs parsed queries on a provider, and applies the filters it does not support to the results
+type searcher struct {
+	p    Provider
+	opts Options
+	// pushdown are the filters applied by the provider, and local those applied to its results
+	pushdown []string
+	local    []string
+	types    []string
+}
+
+func newSearcher(p Provider, opts Options) *searcher {
+	s := &searcher{
+		p:    p,
+		opts: opts,
+		// the results of plain providers are filtered from the typed fields of their documents
+		local: []string{FilterPhrase, FilterTitle, FilterAuthor, FilterAfter, FilterBefore, FilterType},
+	}
+	if ps, ok := p.(PagedSearcher); ok {
+		s.local = []string{FilterPhrase, FilterTitle}
+		s.types = ps.SearchTypes()
+		s.pushdown = []string{FilterAfter, FilterBefore}
+		if len(s.types) > 0 {
+			s.pushdown = append(s.pushdown, FilterType)
+		}
+	}
+	if qs, ok := p.(QuerySearcher); ok {
+		s.pushdown, s.local = qs.SearchFilters()
+	}
+	return s
+}
+
+// paged reports whether the provider supports paging and sorting
+func (s *searcher) paged() bool {
+	switch s.p.(type) {
+	case PagedSearcher, QuerySearcher:
+		return true
+	}
+	return false
+}
+
+// filters returns the filters supported by the search, pushed down or applied locally
+func (s *searcher) filters() []string {
+	return slices.Concat(s.pushdown, s.local)
+}
+
+// search parses and runs the query. The filters of opts are merged into the query, the query filters taking precedence.
+func (s *searcher) search(ctx context.Context, query string, opts SearchOptions) (*SearchResults, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if q.After.IsZero() {
+		q.After = opts.EditedAfter
+	}
+	if q.Before.IsZero() {
+		q.Before = opts.EditedBefore
+	}
+	if q.Type == "" {
+		q.Type = opts.Type
+	}
+	opts.EditedAfter, opts.EditedBefore, opts.Type = time.Time{}, time.Time{}, ""
+
+	var unsupported []string
+	for _, f := range q.Filters() {
+		if !slices.Contains(s.filters(), f) {
+			unsupported = append(unsupported, f)
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("unsupported search filters: %s", strings.Join(unsupported, ", "))
+	}
+	if q.Type != "" && len(s.types) > 0 && !slices.Contains(s.types, q.Type) {
+		return nil, fmt.Errorf("unknown document type %q, expected one of %s", q.Type, strings.Join(s.types, ", "))
+	}
+
+	var results *SearchResults
+	switch p := s.p.(type) {
+	case QuerySearcher:
+		results, err = p.SearchQuery(ctx, q, opts)
+	case PagedSearcher:
+		opts.EditedAfter, opts.EditedBefore, opts.Type = q.After, q.Before, q.Type
+		results, err = p.SearchWithOptions(ctx, q.Text(), opts)
+	default:
+		var documents []Document
+		documents, err = s.p.Search(ctx, q.Text())
+		results = &SearchResults{Results: documents}
+	}
+	if err != nil {
+		mcputil.Logger(ctx).Error("search failed", "error", err)
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	var local []string
+	for _, f := range q.Filters() {
+		if slices.Contains(s.local, f) {
+			local = append(local, f)
+		}
+	}
+	if len(local) > 0 {
+		// the results may be owned by the provider, so they are copied rather than filtered in place
+		var matches []Document
+		for _, doc := range results.Results {
+			if q.Match(&doc, local) {
+				matches = append(matches, doc)
+			}
+		}
+		results.Results = matches
+	}
+
+	if s.opts.Rerank && opts.Sort != SortLastEditedAsc && opts.Sort != SortLastEditedDesc {
+		results.Results = newReranker(s.p, s.opts).rerank(ctx, q.Text(), results.Results)
+	}
+	return results, nil
+}
+
+// addSearchTool adds the search tool, with paging and filter arguments if the provider supports them
+func addSearchTool(server *mcp.Server, p Provider, opts Options) {
+	s := newSearcher(p, opts)
+	tool := &mcp.Tool{
+		Name:        "search",
+		Description: queryDescription(p.GetSearchSyntax(), s.filters()),
+		Annotations: toolAnnotations(p, "search", mcputil.ReadOnlyTool("Search documents", true)),
+	}
+
+	if !s.paged() {
+		mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args searchArgs) (*mcp.CallToolResult, searchResult, error) {
+			ctx = mcputil.WithProgress(ctx, req)
+			ctx, warnings := withWarnings(ctx)
+			results, err := s.search(ctx, args.Query, SearchOptions{})
+			if err != nil {
+				return nil, searchResult{}, err
+			}
+			return warnings.result(), searchResult{Results: results.Results}, nil
+		})
+		return
+	}
+
+	tool.InputSchema = pagedSearchSchema(s.types)
+	mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, args pagedSearchArgs) (*mcp.CallToolResult, pagedSearchResult, error) {
+		ctx = mcputil.WithProgress(ctx, req)
+		ctx, warnings := withWarnings(ctx)
+		searchOpts, err := args.options()
+		if err != nil {
+			return nil, pagedSearchResult{}, err
+		}
+		results, err := s.search(ctx, args.Query, searchOpts)
+		if err != nil {
+			return nil, pagedSearchResult{}, err
+		}
+		return warnings.result(), pagedSearchResult{Results: results.Results, NextCursor: results.NextCursor}, nil
+	})
+}
+
+// pagedSearchSchema returns the input schema of the paged search tool, restricted to the supported types
+func pagedSearchSchema(types []string) *jsonschema.Schema {
+	schema, err := jsonschema.For[pagedSearchArgs](nil)
+	if err != nil {
+		panic(fmt.Errorf("search tool schema: %w", err))
+	}
+	minLimit, maxLimit := 1.0, float64(maxSearchLimit)
+	schema.Properties["limit"].Minimum = &minLimit
+	schema.Properties["limit"].Maximum = &maxLimit
+	schema.Properties["sort"].Enum = []any{SortRelevance, SortLastEditedDesc, SortLastEditedAsc}
+	if len(types) > 0 {
+		enum := make([]any, 0, len(types))
+		for _, t := range types {
+			enum = append(enum, t)
+		}
+		schema.Properties["type"].Enum = enum
+	} else {
+		delete(schema.Properties, "type")
+	}
+	return schema
+}
+
+func (args pagedSearchArgs) options() (SearchOptions, error) {
+	opts := SearchOptions{
+		Limit:  args.Limit,
+		Cursor: args.Cursor,
+		Type:   args.Type,
+		Sort:   args.Sort,
+	}
+	var err error
+	if opts.EditedAfter, err = parseDate(args.After); err != nil {
+		return opts, fmt.Errorf("after: %w", err)
+	}
+	if opts.EditedBefore, err = parseDate(args.Before); err != nil {
+		return opts, fmt.Errorf("before: %w", err)
+	}
+	return opts, nil
+}
+
+// parseDate parses an RFC 3339 timestamp or a date, which is the start of the day in UTC
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// InRange reports whether t is within the last edited range of the options
+func (opts SearchOptions) InRange(t time.Time) bool {
+	if !opts.EditedAfter.IsZero() && t.Before(opts.EditedAfter) {
+		return false
+	}
+	if !opts.EditedBefore.IsZero() && !t.Before(opts.EditedBefore) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package drutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+type pagedProvider struct {
+	staticProvider
+	opts SearchOptions
+}
+
+func (p *pagedProvider) SearchTypes() []string { return []string{"page"} }
+
+func (p *pagedProvider) SearchWithOptions(_ context.Context, _ string, opts SearchOptions) (*SearchResults, error) {
+	p.opts = opts
+	return &SearchResults{Results: []Document{{ID: "a", Title: "A"}}, NextCursor: "next"}, nil
+}
+
+func TestPagedSearch(t *testing.T) {
+	ctx := context.Background()
+
+	provider := &pagedProvider{}
+	server := BuildMCPServer("test", provider, Options{})
+
+	session := mcputiltest.Connect(ctx, t, server, nil)
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	for _, tool := range tools.Tools {
+		if tool.Name != "search" {
+			continue
+		}
+		props := tool.InputSchema.(map[string]any)["properties"].(map[string]any)
+		for _, arg := range []string{"query", "limit", "cursor", "after", "before", "type", "sort"} {
+			if _, ok := props[arg]; !ok {
+				t.Errorf("search tool has no %s argument", arg)
+			}
+		}
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "search", Arguments: map[string]any{
+		"query":  "q",
+		"limit":  5,
+		"cursor": "c",
+		"after":  "2025-01-02",
+		"before": "2025-02-01T12:00:00Z",
+		"type":   "page",
+		"sort":   SortLastEditedAsc,
+	}})
+	if err != nil {
+		t.Fatalf("call search: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("search failed: %v", res.Content)
+	}
+	expected := SearchOptions{
+		Limit:        5,
+		Cursor:       "c",
+		EditedAfter:  time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+		EditedBefore: time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC),
+		Type:         "page",
+		Sort:         SortLastEditedAsc,
+	}
+	if provider.opts != expected {
+		t.Errorf("got options %+v, expected %+v", provider.opts, expected)
+	}
+	if next := res.StructuredContent.(map[string]any)["next_cursor"]; next != "next" {
+		t.Errorf("got next cursor %v", next)
+	}
+
+	for name, args := range map[string]map[string]any{
+		"invalid date":  {"query": "q", "after": "yesterday"},
+		"invalid type":  {"query": "q", "type": "database"},
+		"invalid sort":  {"query": "q", "sort": "random"},
+		"invalid limit": {"query": "q", "limit": 500},
+	} {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "search", Arguments: args})
+		if err == nil && !res.IsError {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package drutil
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type warningsKey struct{}
+
+// warnings collects the warnings of a single tool call
+type warnings struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func withWarnings(ctx context.Context) (context.Context, *warnings) {
+	w := &warnings{}
+	return context.WithValue(ctx, warningsKey{}, w), w
+}
+
+// Warn records a warning about an incomplete result, such as a backend that did not respond.
+// The search and fetch tools report warnings to the client in the _meta of their result.
+func Warn(ctx context.Context, warning string) {
+	if w, ok := ctx.Value(warningsKey{}).(*warnings); ok {
+		w.mu.Lock()
+		w.list = append(w.list, warning)
+		w.mu.Unlock()
+	}
+}
+
+// result returns a tool result that carries the warnings, or nil if there are none
+func (w *warnings) result() *mcp.CallToolResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.list) == 0 {
+		return nil
+	}
+	return &mcp.CallToolResult{
+		Meta: mcp.Meta{"warnings": w.list},
+	}
+}
+
+// CollectWarnings returns a context that collects the warnings recorded outside of a tool call,
+// such as by background work that must not keep incomplete results, and a function that returns them
+func CollectWarnings(ctx context.Context) (context.Context, func() []string) {
+	ctx, w := withWarnings(ctx)
+	return ctx, func() []string {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return slices.Clone(w.list)
+	}
+}
@@ -0,0 +1,180 @@
+// Package federated provides a drutil.Provider that searches several providers at once
+package federated
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	defaultLimit   = 20
+	// rrfK dampens the weight of the top ranks in reciprocal rank fusion
+	rrfK = 60
+)
+
+// Backend is a provider searched by the federated provider
+type Backend struct {
+	// Name prefixes the IDs of the backend documents, as <name>:<id>
+	Name     string
+	Provider drutil.Provider
+}
+
+// Options configures the federated provider
+type Options struct {
+	// Timeout bounds the search of every backend, backends that do not respond in time are skipped
+	Timeout time.Duration
+	// Limit is the maximum number of merged search results
+	Limit int
+}
+
+// provider fans out searches across backends and merges their results
+type provider struct {
+	backends []Backend
+	timeout  time.Duration
+	limit    int
+}
+
+// New creates a provider that searches all backends concurrently
+func New(backends []Backend, opts Options) drutil.Provider {
+	p := &provider{
+		backends: backends,
+		timeout:  opts.Timeout,
+		limit:    opts.Limit,
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultTimeout
+	}
+	if p.limit == 0 {
+		p.limit = defaultLimit
+	}
+	return p
+}
+
+func (p *provider) GetSearchSyntax() string {
+	var b strings.Builder
+	b.WriteString("Search across several sources at once, the query is passed to each of them:\n")
+	for _, backend := range p.backends {
+		fmt.Fprintf(&b, "- %s: %s\n", backend.Name, strings.TrimSpace(backend.Provider.GetSearchSyntax()))
+	}
+	b.WriteString("Result IDs are prefixed with the source name, pass them unchanged to fetch.")
+	return b.String()
+}
+
+// Search searches every backend concurrently and merges their results.
+// Backends that fail or time out are reported as warnings, so the results may be partial.
+func (p *provider) Search(ctx context.Context, query string) ([]drutil.Document, error) {
+	results := make([][]drutil.Document, len(p.backends))
+	errs := make([]error, len(p.backends))
+	var wg sync.WaitGroup
+	for i, backend := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+			results[i], errs[i] = backend.Provider.Search(ctx, query)
+		}()
+	}
+	wg.Wait()
+
+	var failed int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			drutil.Warn(ctx, fmt.Sprintf("%s: search failed, its results are missing: %v", p.backends[i].Name, err))
+		}
+	}
+	if failed > 0 && failed == len(p.backends) {
+		return nil, fmt.Errorf("all sources failed: %w", errors.Join(errs...))
+	}
+	return p.merge(query, results), nil
+}
+
+// merge namespaces the results of every backend and ranks them by reciprocal rank fusion,
+// with a boost for titles that contain the query words
+func (p *provider) merge(query string, results [][]drutil.Document) []drutil.Document {
+	type ranked struct {
+		doc   drutil.Document
+		score float64
+	}
+	words := strings.Fields(strings.ToLower(query))
+
+	var all []ranked
+	for i, docs := range results {
+		for rank, doc := range docs {
+			all = append(all, ranked{
+				doc:   namespace(p.backends[i].Name, doc),
+				score: 1/float64(rrfK+rank+1) + titleScore(words, doc.Title),
+			})
+		}
+	}
+	slices.SortStableFunc(all, func(a, b ranked) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+
+	documents := make([]drutil.Document, 0, min(len(all), p.limit))
+	for _, r := range all[:min(len(all), p.limit)] {
+		documents = append(documents, r.doc)
+	}
+	return documents
+}
+
+// titleScore returns the fraction of the query words found in the title, scaled to outweigh rank differences
+func titleScore(words []string, title string) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	title = strings.ToLower(title)
+	var found int
+	for _, w := range words {
+		if strings.Contains(title, w) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(words)) / rrfK
+}
+
+func (p *provider) Fetch(ctx context.Context, id string) (*drutil.Document, error) {
+	name, backendID, ok := strings.Cut(id, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid id %q, expected <source>:<id>", id)
+	}
+	for _, backend := range p.backends {
+		if backend.Name != name {
+			continue
+		}
+		doc, err := backend.Provider.Fetch(ctx, backendID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		namespaced := namespace(name, *doc)
+		return &namespaced, nil
+	}
+	return nil, fmt.Errorf("unknown source %q", name)
+}
+
+// namespace returns a copy of the document with its ID prefixed by the backend name
+func namespace(name string, doc drutil.Document) drutil.Document {
+	doc.ID = name + ":" + doc.ID
+	doc.Metadata = maps.Clone(doc.Metadata)
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]string)
+	}
+	doc.Metadata["source"] = name
+	return doc
+}
@@ -0,0 +1,119 @@
+package federated
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/drutil/drutiltest"
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+// fakeProvider returns its documents whose title contains the query, after an optional delay
+type fakeProvider struct {
+	documents []drutil.Document
+	delay     time.Duration
+	err       error
+}
+
+func (p *fakeProvider) GetSearchSyntax() string { return "search by title" }
+
+func (p *fakeProvider) Search(ctx context.Context, query string) ([]drutil.Document, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	var results []drutil.Document
+	for _, doc := range p.documents {
+		if strings.Contains(strings.ToLower(doc.Title), strings.ToLower(query)) {
+			results = append(results, doc)
+		}
+	}
+	return results, nil
+}
+
+func (p *fakeProvider) Fetch(_ context.Context, id string) (*drutil.Document, error) {
+	for _, doc := range p.documents {
+		if doc.ID == id {
+			return &doc, nil
+		}
+	}
+	return nil, fmt.Errorf("document %s not found", id)
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+
+	p := New([]Backend{
+		{Name: "docs", Provider: &fakeProvider{documents: []drutil.Document{
+			{ID: "1", Title: "Plan"},
+			{ID: "2", Title: "Launch plan"},
+		}}},
+		{Name: "data", Provider: &fakeProvider{documents: []drutil.Document{
+			{ID: "t/1", Title: "plans #1"},
+		}}},
+		{Name: "slow", Provider: &fakeProvider{delay: time.Minute, documents: []drutil.Document{
+			{ID: "x", Title: "Plan"},
+		}}},
+		{Name: "broken", Provider: &fakeProvider{err: errors.New("unavailable")}},
+	}, Options{Timeout: 50 * time.Millisecond})
+	server := drutil.BuildMCPServer("Federated", p, drutil.Options{})
+
+	session := mcputiltest.Connect(ctx, t, server, nil)
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "search", Arguments: map[string]any{"query": "plan"}})
+	if err != nil {
+		t.Fatalf("call search: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("search failed: %v", res.Content)
+	}
+
+	var ids []string
+	for _, r := range res.StructuredContent.(map[string]any)["results"].([]any) {
+		ids = append(ids, r.(map[string]any)["id"].(string))
+	}
+	if got, expected := strings.Join(ids, ","), "docs:1,data:t/1,docs:2"; got != expected {
+		t.Errorf("got results %s, expected %s", got, expected)
+	}
+
+	warnings, _ := res.Meta["warnings"].([]any)
+	if len(warnings) != 2 {
+		t.Fatalf("expected warnings for the slow and broken backends, got %v", res.Meta)
+	}
+	for i, name := range []string{"slow", "broken"} {
+		if w := warnings[i].(string); !strings.HasPrefix(w, name+":") {
+			t.Errorf("unexpected warning %q", w)
+		}
+	}
+
+	doc, err := p.Fetch(ctx, "data:t/1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if doc.ID != "data:t/1" || doc.Title != "plans #1" || doc.Metadata["source"] != "data" {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	for _, id := range []string{"t/1", "unknown:1"} {
+		if _, err := p.Fetch(ctx, id); err == nil {
+			t.Errorf("expected an error fetching %s", id)
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	drutiltest.Run(t, New([]Backend{
+		{Name: "docs", Provider: drutiltest.NewFake(drutil.Document{ID: "1", Title: "Launch plan"})},
+		{Name: "notes", Provider: drutiltest.NewFake(drutil.Document{ID: "a", Title: "Notes", Text: "launch notes"})},
+	}, Options{}), drutiltest.Config{Query: "launch", MissingID: "docs:missing"})
+}
@@ -0,0 +1,57 @@
+package federated
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/notion"
+	"github.com/pomerium/mcp-servers/sqlite"
+)
+
+// backendBuilders maps the backend names accepted in BACKENDS to their constructor,
+// that receives the variables prefixed with the upper case backend name
+var backendBuilders = map[string]func(ctx context.Context, env map[string]string) (drutil.Provider, error){
+	"notion": notion.NewProvider,
+	"sqlite": sqlite.NewDocumentProvider,
+}
+
+// NewServer creates the federated server from the backends listed in BACKENDS, such as notion,sqlite
+func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error) {
+	var backends []Backend
+	for _, name := range strings.Split(env["BACKENDS"], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		build, ok := backendBuilders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q", name)
+		}
+		p, err := build(ctx, subEnv(env, strings.ToUpper(name)+"_"))
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", name, err)
+		}
+		backends = append(backends, Backend{Name: name, Provider: p})
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("BACKENDS environment variable not set or empty")
+	}
+
+	timeout := drutil.EnvDuration(env, "TIMEOUT")
+	return drutil.BuildMCPServer("Federated", New(backends, Options{Timeout: timeout}), drutil.OptionsFromEnv(env)), nil
+}
+
+// subEnv returns the variables that start with prefix, without it
+func subEnv(env map[string]string, prefix string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range env {
+		if key, ok := strings.CutPrefix(k, prefix); ok {
+			result[key] = v
+		}
+	}
+	return result
+}
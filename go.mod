@@ -3,6 +3,7 @@ module github.com/pomerium/mcp-servers
 go 1.24.2
 
 require (
+	github.com/google/jsonschema-go v0.3.0
 	github.com/jomei/notionapi v1.13.3
 	github.com/modelcontextprotocol/go-sdk v1.1.0
 	github.com/pomerium/sdk-go v0.0.9
@@ -12,7 +13,6 @@ require (
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.4 // indirect
-	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.4 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -1,48 +1,386 @@
 package httputil
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"mime"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
+const (
+	// defaultMaxBodySize is the number of body bytes logged when DebugOptions.MaxBodySize is nil
+	defaultMaxBodySize = 4096
+	redacted           = "[REDACTED]"
+)
+
+// sensitiveHeaders are the headers whose values are never logged
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DefaultRedactFields are the JSON fields, form fields and query parameters whose values are never logged
+var DefaultRedactFields = []string{"access_token", "refresh_token", "id_token", "client_secret", "password", "code"}
+
+// DebugOptions configures the debug logging of HTTP requests and responses
+type DebugOptions struct {
+	// Logger receives the requests and responses at debug level, defaults to the handler of slog.Default()
+	// with debug records enabled, as enabling debug logging is the point of installing the round tripper
+	Logger *slog.Logger
+	// RedactFields are the names of the fields whose values are redacted from bodies and query strings,
+	// in addition to DefaultRedactFields. Names are matched case insensitively.
+	RedactFields []string
+	// MaxBodySize is the maximum number of body bytes logged, defaults to 4096 if nil, and 0 leaves the bodies out
+	MaxBodySize *int
+}
+
+// DebugOptionsFromEnv returns the debug logging options of a server from its environment variables, without their
+// prefix, and whether debug logging is enabled by DEBUG_HTTP
+func DebugOptionsFromEnv(env map[string]string) (DebugOptions, bool, error) {
+	var opts DebugOptions
+	v := env["DEBUG_HTTP"]
+	if v == "" {
+		return opts, false, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return opts, false, fmt.Errorf("invalid DEBUG_HTTP %q", v)
+	}
+	for _, field := range strings.Split(env["DEBUG_HTTP_REDACT"], ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			opts.RedactFields = append(opts.RedactFields, field)
+		}
+	}
+	if v, ok := env["DEBUG_HTTP_MAX_BODY"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, false, fmt.Errorf("invalid DEBUG_HTTP_MAX_BODY %q", v)
+		}
+		opts.MaxBodySize = &n
+	}
+	return opts, enabled, nil
+}
+
 type debugRoundTripper struct {
-	printer   func(string)
+	opts      DebugOptions
+	maxBody   int
+	redact    map[string]bool
 	transport http.RoundTripper
 }
 
-// NewDebugRoundTripper logs request and response including full JSON request and response bodies
-func NewDebugRoundTripper(printer func(string), rt http.RoundTripper) http.RoundTripper {
+// NewDebugRoundTripper logs requests and responses through slog at debug level, with a request_id attribute
+// that correlates them. Credentials are redacted from the headers, bodies and query strings, and bodies are
+// truncated to opts.MaxBodySize. Only that much of a response body is kept, and it is logged once read.
+func NewDebugRoundTripper(rt http.RoundTripper, opts DebugOptions) http.RoundTripper {
+	maxBody := defaultMaxBodySize
+	if opts.MaxBodySize != nil {
+		maxBody = *opts.MaxBodySize
+	}
+	redact := make(map[string]bool)
+	for _, field := range slices.Concat(DefaultRedactFields, opts.RedactFields) {
+		redact[strings.ToLower(field)] = true
+	}
 	return &debugRoundTripper{
-		printer:   printer,
+		opts:      opts,
+		maxBody:   maxBody,
+		redact:    redact,
 		transport: rt,
 	}
 }
 
-// NewDebugHTTPClient returns a new http.Client that logs request and response including full JSON request and response bodies
-func NewDebugHTTPClient(printer func(string)) *http.Client {
+// NewDebugHTTPClient returns a new http.Client that logs requests and responses, see NewDebugRoundTripper
+func NewDebugHTTPClient(opts DebugOptions) *http.Client {
 	client := new(http.Client)
 	*client = *http.DefaultClient
-	client.Transport = NewDebugRoundTripper(printer, http.DefaultTransport)
+	client.Transport = NewDebugRoundTripper(http.DefaultTransport, opts)
 	return client
 }
 
-// RoundTrip logs request and response including full JSON request and response bodies
 func (rt *debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	data, err := httputil.DumpRequest(req, true)
-	if err != nil {
-		return nil, err
+	ctx := req.Context()
+	logger := rt.opts.Logger
+	if logger == nil {
+		logger = slog.New(debugHandler{slog.Default().Handler()})
 	}
-	rt.printer(string(data))
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return rt.transport.RoundTrip(req)
+	}
+	logger = logger.With("request_id", fmt.Sprintf("%016x", rand.Uint64()))
+	attrs := []any{
+		"method", req.Method,
+		"url", rt.redactURL(req.URL),
+		"headers", rt.headers(req.Header),
+	}
+	if rt.maxBody > 0 {
+		var body []byte
+		var err error
+		if req, body, err = requestBody(req); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, "body", rt.body(body, len(body), req.Header.Get("Content-Type")))
+	}
+	logger.DebugContext(ctx, "http request", attrs...)
 
+	start := time.Now()
 	resp, err := rt.transport.RoundTrip(req)
 	if err != nil {
+		logger.DebugContext(ctx, "http request failed", "duration", time.Since(start), "error", err)
 		return nil, err
 	}
-	data, err = httputil.DumpResponse(resp, true)
+	logger.DebugContext(ctx, "http response",
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"headers", rt.headers(resp.Header),
+	)
+	if rt.maxBody > 0 && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &loggedBody{
+			ReadCloser:  resp.Body,
+			ctx:         ctx,
+			logger:      logger,
+			rt:          rt,
+			contentType: resp.Header.Get("Content-Type"),
+			start:       start,
+		}
+	}
+	return resp, nil
+}
+
+// requestBody returns the request body, and a request that can still send it. The request is cloned
+// before its body is replaced, as a round tripper must not modify it.
+func requestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return req, data, err
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
 	}
-	rt.printer(string(data))
+	return req, data, nil
+}
 
-	return resp, nil
+// loggedBody keeps the first bytes of a response body as it is read, up to the maximum body size,
+// and logs them once the body is read to its end or closed
+type loggedBody struct {
+	io.ReadCloser
+	ctx         context.Context
+	logger      *slog.Logger
+	rt          *debugRoundTripper
+	contentType string
+	start       time.Time
+
+	head   []byte
+	size   int
+	logged sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := min(n, b.rt.maxBody-len(b.head)); keep > 0 {
+		b.head = append(b.head, p[:keep]...)
+	}
+	b.size += n
+	if err != nil {
+		b.log(err)
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	b.log(nil)
+	return b.ReadCloser.Close()
+}
+
+// log logs the body once, err is the error that ended the reading if any
+func (b *loggedBody) log(err error) {
+	b.logged.Do(func() {
+		attrs := []any{"duration", time.Since(b.start), "body", b.rt.body(b.head, b.size, b.contentType)}
+		if err != nil && err != io.EOF {
+			attrs = append(attrs, "error", err)
+		}
+		b.logger.DebugContext(b.ctx, "http response body", attrs...)
+	})
+}
+
+// headers returns the headers as a log group, with the sensitive ones redacted
+func (rt *debugRoundTripper) headers(h http.Header) slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for _, name := range slices.Sorted(maps.Keys(h)) {
+		value := strings.Join(h.Values(name), ", ")
+		if slices.ContainsFunc(sensitiveHeaders, func(s string) bool { return strings.EqualFold(s, name) }) {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// body returns the first bytes of a body of the given size, with the values of the redacted fields replaced
+// for JSON and form bodies, truncated to the maximum size
+func (rt *debugRoundTripper) body(head []byte, size int, contentType string) string {
+	if size == 0 {
+		return ""
+	}
+	complete := len(head) == size
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	text := string(head)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var ok bool
+		text, ok = rt.redactJSON(head)
+		if complete && !ok {
+			// a body that cannot be parsed cannot be redacted either
+			return fmt.Sprintf("[%d bytes of invalid JSON]", size)
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if !complete {
+			// the last field may be cut
+			text = text[:max(strings.LastIndex(text, "&"), 0)]
+		}
+		values, err := url.ParseQuery(text)
+		if err != nil {
+			return fmt.Sprintf("[%d bytes of invalid form]", size)
+		}
+		text = rt.redactValues(values).Encode()
+	}
+	if n := rt.maxBody; len(text) > n {
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = text[:n]
+		complete = false
+	}
+	if !complete {
+		text = fmt.Sprintf("%s… [%d bytes]", text, size)
+	}
+	return text
+}
+
+// redactJSON re-encodes the JSON tokens of data with the values of the redacted fields replaced, in their order.
+// The tokens up to the first incomplete or invalid one are kept, and it returns whether data is valid JSON.
+func (rt *debugRoundTripper) redactJSON(data []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var b strings.Builder
+	type container struct {
+		object bool
+		tokens int
+	}
+	var stack []container
+	// skip is the depth of the redacted object or array being skipped, redactNext is set after a redacted key
+	skip, redactNext := 0, false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return b.String(), len(stack) == 0
+		}
+		if err != nil {
+			return b.String(), false
+		}
+		delim, isDelim := tok.(json.Delim)
+		if skip > 0 {
+			if isDelim && (delim == '{' || delim == '[') {
+				skip++
+			} else if isDelim {
+				skip--
+			}
+			continue
+		}
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			b.WriteRune(rune(delim))
+			continue
+		}
+
+		isKey := false
+		if n := len(stack); n > 0 {
+			top := &stack[n-1]
+			isKey = top.object && top.tokens%2 == 0
+			switch {
+			case top.object && !isKey:
+				b.WriteByte(':')
+			case top.tokens > 0:
+				b.WriteByte(',')
+			}
+			top.tokens++
+		}
+		if redactNext {
+			redactNext = false
+			b.WriteString(`"` + redacted + `"`)
+			if isDelim {
+				skip = 1
+			}
+			continue
+		}
+		if isDelim {
+			b.WriteRune(rune(delim))
+			stack = append(stack, container{object: delim == '{'})
+			continue
+		}
+		if key, ok := tok.(string); ok && isKey && rt.redact[strings.ToLower(key)] {
+			redactNext = true
+		}
+		value, _ := json.Marshal(tok)
+		b.Write(value)
+	}
+}
+
+func (rt *debugRoundTripper) redactValues(values url.Values) url.Values {
+	for key := range values {
+		if rt.redact[strings.ToLower(key)] {
+			values[key] = []string{redacted}
+		}
+	}
+	return values
+}
+
+func (rt *debugRoundTripper) redactURL(u *url.URL) string {
+	if u.RawQuery == "" && u.User == nil {
+		return u.String()
+	}
+	c := *u
+	c.User = nil
+	c.RawQuery = rt.redactValues(u.Query()).Encode()
+	return c.String()
+}
+
+// debugHandler enables the debug records of a handler that may be set to a higher level
+type debugHandler struct {
+	slog.Handler
+}
+
+func (h debugHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelDebug || h.Handler.Enabled(ctx, level)
+}
+
+func (h debugHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return debugHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h debugHandler) WithGroup(name string) slog.Handler {
+	return debugHandler{h.Handler.WithGroup(name)}
 }
@@ -0,0 +1,162 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDebugRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"query":"q","access_token":"secret-1"}` {
+			t.Errorf("unexpected request body %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Set-Cookie", "session=secret-2")
+		io.WriteString(w, `{"results":[{"title":"Page","bot_token":"secret-3"}],"text":"`+strings.Repeat("x", 100)+`"}`)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	client := &http.Client{Transport: NewDebugRoundTripper(http.DefaultTransport, DebugOptions{
+		Logger:       slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		RedactFields: []string{"Bot_Token"},
+		MaxBodySize:  ptr(80),
+	})}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/search?code=secret-4&page=2", strings.NewReader(`{"query":"q","access_token":"secret-1"}`))
+	req.Header.Set("Authorization", "Bearer secret-5")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "secret-3") {
+		t.Errorf("expected the response body to be left intact, got %s", body)
+	}
+
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("credentials were logged:\n%s", logs.String())
+	}
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("parse log: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 || records[0]["msg"] != "http request" || records[1]["msg"] != "http response" || records[2]["msg"] != "http response body" {
+		t.Fatalf("unexpected records %v", records)
+	}
+	for _, record := range records[1:] {
+		if id := records[0]["request_id"]; id == nil || id != record["request_id"] {
+			t.Errorf("expected a shared request_id, got %v and %v", id, record["request_id"])
+		}
+	}
+	if url := records[0]["url"].(string); !strings.HasSuffix(url, "/search?code=%5BREDACTED%5D&page=2") {
+		t.Errorf("unexpected url %s", url)
+	}
+	if auth := records[0]["headers"].(map[string]any)["Authorization"]; auth != redacted {
+		t.Errorf("unexpected authorization %v", auth)
+	}
+	if body := records[0]["body"]; body != `{"query":"q","access_token":"[REDACTED]"}` {
+		t.Errorf("unexpected request body %v", body)
+	}
+	// only the first bytes of the response are kept, and redacted up to the cut string
+	if body := records[2]["body"]; body != `{"results":[{"title":"Page","bot_token":"[REDACTED]"}],"text"… [163 bytes]` {
+		t.Errorf("unexpected response body %v", body)
+	}
+}
+
+func TestDebugRoundTripperBodies(t *testing.T) {
+	// the server answers with the size of the request body
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, strconv.Itoa(len(body)))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	// a request without GetBody is cloned rather than modified
+	client := &http.Client{Transport: NewDebugRoundTripper(http.DefaultTransport, DebugOptions{Logger: logger})}
+	body := io.NopCloser(strings.NewReader("password=secret&page=2"))
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(size) != "22" || req.Body != body {
+		t.Errorf("expected the body to be sent from a clone, got %s bytes", size)
+	}
+	if strings.Contains(logs.String(), "secret") || !strings.Contains(logs.String(), "password=%5BREDACTED%5D") {
+		t.Errorf("unexpected logs:\n%s", logs.String())
+	}
+
+	// a maximum size of 0 leaves the bodies out
+	logs.Reset()
+	client = &http.Client{Transport: NewDebugRoundTripper(http.DefaultTransport, DebugOptions{Logger: logger, MaxBodySize: ptr(0)})}
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(logs.String(), `"body"`) || strings.Count(logs.String(), "\n") != 2 {
+		t.Errorf("expected no bodies, got:\n%s", logs.String())
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	rt := NewDebugRoundTripper(nil, DebugOptions{}).(*debugRoundTripper)
+	for input, expected := range map[string]string{
+		`{"a":[1,{"password":{"x":[2]}},"b"],"c":null}`: `{"a":[1,{"password":"[REDACTED]"},"b"],"c":null}`,
+		`[{"code":"secret"},{"cod`:                      `[{"code":"[REDACTED]"},{`,
+		`{"code":"sec`:                                  `{"code"`,
+	} {
+		if got, _ := rt.redactJSON([]byte(input)); got != expected {
+			t.Errorf("%s: got %s, expected %s", input, got, expected)
+		}
+	}
+	if _, ok := rt.redactJSON([]byte(`{"a":1}`)); !ok {
+		t.Error("expected valid JSON")
+	}
+	if _, ok := rt.redactJSON([]byte(`{"a":`)); ok {
+		t.Error("expected incomplete JSON")
+	}
+}
+
+func TestDebugOptionsFromEnv(t *testing.T) {
+	if _, ok, err := DebugOptionsFromEnv(map[string]string{}); ok || err != nil {
+		t.Errorf("expected debug logging to be disabled by default, got %v %v", ok, err)
+	}
+	opts, ok, err := DebugOptionsFromEnv(map[string]string{"DEBUG_HTTP": "true", "DEBUG_HTTP_REDACT": "email, name", "DEBUG_HTTP_MAX_BODY": "0"})
+	if err != nil || !ok || len(opts.RedactFields) != 2 || opts.RedactFields[1] != "name" || opts.MaxBodySize == nil || *opts.MaxBodySize != 0 {
+		t.Errorf("unexpected options %v %+v %v", ok, opts, err)
+	}
+	for _, env := range []map[string]string{
+		{"DEBUG_HTTP": "yes please"},
+		{"DEBUG_HTTP": "true", "DEBUG_HTTP_MAX_BODY": "-1"},
+	} {
+		if _, _, err := DebugOptionsFromEnv(env); err == nil {
+			t.Errorf("%v: expected an error", env)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
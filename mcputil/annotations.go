@@ -0,0 +1,31 @@
+package mcputil
+
+import "github.com/modelcontextprotocol/go-sdk/mcp"
+
+// ReadOnlyTool returns annotations for a tool that does not modify its environment.
+// openWorld should be true if the tool talks to an external service rather than local data.
+func ReadOnlyTool(title string, openWorld bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    true,
+		DestructiveHint: ptr(false),
+		IdempotentHint:  true,
+		OpenWorldHint:   ptr(openWorld),
+	}
+}
+
+// WriteTool returns annotations for a tool that modifies its environment.
+// destructive should be true if the tool may overwrite or delete existing data, rather than only add to it.
+func WriteTool(title string, destructive, idempotent, openWorld bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    false,
+		DestructiveHint: ptr(destructive),
+		IdempotentHint:  idempotent,
+		OpenWorldHint:   ptr(openWorld),
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,22 @@
+package mcputil
+
+import "github.com/modelcontextprotocol/go-sdk/mcp"
+
+// maxCompletionValues is the maximum number of values a completion result may contain
+const maxCompletionValues = 100
+
+// CompletionResult returns a completion result for values, truncated to the maximum allowed by the protocol
+func CompletionResult(values []string) *mcp.CompleteResult {
+	result := &mcp.CompleteResult{
+		Completion: mcp.CompletionResultDetails{
+			Values: []string{}, // avoid JSON null
+			Total:  len(values),
+		},
+	}
+	if len(values) > maxCompletionValues {
+		values = values[:maxCompletionValues]
+		result.Completion.HasMore = true
+	}
+	result.Completion.Values = append(result.Completion.Values, values...)
+	return result
+}
@@ -0,0 +1,157 @@
+package mcputil
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+)
+
+// ConfirmTokenArgument is the tool argument that carries the confirm token
+// for clients that do not support elicitation
+const ConfirmTokenArgument = "confirm_token"
+
+// DefaultConfirmTokenTTL is how long a confirm token remains valid
+const DefaultConfirmTokenTTL = 5 * time.Minute
+
+// Confirmer asks the human to confirm destructive tool calls before they run.
+//
+// Clients that support elicitation are asked directly. Other clients, and stateless sessions
+// that cannot make requests to the client, receive a confirm token from the first call that
+// must be passed back in the ConfirmTokenArgument of a second, otherwise identical, call.
+type Confirmer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewConfirmer creates a Confirmer with a random key, so confirm tokens do not survive a restart
+func NewConfirmer() *Confirmer {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Errorf("generate confirm token key: %w", err))
+	}
+	return &Confirmer{
+		key: key,
+		ttl: DefaultConfirmTokenTTL,
+		now: time.Now,
+	}
+}
+
+// Confirm asks for confirmation of the tool call, showing summary to the human.
+// If it returns true the call may proceed, otherwise the returned result should be sent back to the client.
+func (c *Confirmer) Confirm(ctx context.Context, req *mcp.CallToolRequest, summary string) (*mcp.CallToolResult, bool) {
+	args, token, err := splitConfirmToken(req.Params.Arguments)
+	if err != nil {
+		return errorResult(fmt.Sprintf("invalid arguments: %v", err)), false
+	}
+
+	if token == "" && supportsElicitation(req.Session) {
+		res, err := req.Session.Elicit(ctx, &mcp.ElicitParams{
+			Message: summary + "\n\nDo you want to proceed?",
+			RequestedSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+		})
+		if err == nil {
+			if res.Action == "accept" {
+				return nil, true
+			}
+			return errorResult(fmt.Sprintf("The user did not confirm the operation (%s): %s", res.Action, summary)), false
+		}
+		Logger(ctx).Warn("elicitation failed, falling back to confirm token", "error", err)
+	}
+
+	if token != "" {
+		if err := c.verify(ctx, req.Params.Name, args, token); err != nil {
+			return errorResult(fmt.Sprintf("Invalid %s: %v. Call the tool again without it to get a new one.", ConfirmTokenArgument, err)), false
+		}
+		return nil, true
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf(
+				"Confirmation required: %s\n\nAsk the user to confirm this operation. "+
+					"If they agree, call the tool again with the same arguments and %s=%q. The token expires in %s.",
+				summary, ConfirmTokenArgument, c.sign(ctx, req.Params.Name, args, c.now().Add(c.ttl)), c.ttl)},
+		},
+	}, false
+}
+
+// sign returns a token that binds the tool, its arguments and the caller until expiry
+func (c *Confirmer) sign(ctx context.Context, tool string, args []byte, expiry time.Time) string {
+	token := binary.BigEndian.AppendUint64(nil, uint64(expiry.Unix()))
+	token = append(token, c.mac(ctx, tool, args, token)...)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func (c *Confirmer) verify(ctx context.Context, tool string, args []byte, token string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != 8+sha256.Size {
+		return fmt.Errorf("malformed token")
+	}
+	expiry, mac := raw[:8], raw[8:]
+	if !hmac.Equal(mac, c.mac(ctx, tool, args, expiry)) {
+		return fmt.Errorf("token does not match this call")
+	}
+	if c.now().Unix() > int64(binary.BigEndian.Uint64(expiry)) {
+		return fmt.Errorf("token expired")
+	}
+	return nil
+}
+
+func (c *Confirmer) mac(ctx context.Context, tool string, args, expiry []byte) []byte {
+	var user string
+	if identity, ok := ctxutil.IdentityFromContext(ctx); ok {
+		user = identity.User
+	}
+	h := hmac.New(sha256.New, c.key)
+	for _, part := range [][]byte{[]byte(tool), []byte(user), args, expiry} {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// splitConfirmToken returns the canonical JSON encoding of the arguments without the confirm token, and the token
+func splitConfirmToken(raw json.RawMessage) ([]byte, string, error) {
+	args := make(map[string]any)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, "", err
+		}
+	}
+	token, _ := args[ConfirmTokenArgument].(string)
+	delete(args, ConfirmTokenArgument)
+	// maps are marshalled with sorted keys
+	canonical, err := json.Marshal(args)
+	return canonical, token, err
+}
+
+func supportsElicitation(ss *mcp.ServerSession) bool {
+	if ss == nil {
+		return false
+	}
+	params := ss.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
+
+func errorResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		IsError: true,
+	}
+}
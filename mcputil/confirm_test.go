@@ -0,0 +1,113 @@
+package mcputil
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+func newConfirmServer(confirmer *Confirmer, executed *atomic.Int32) *mcp.Server {
+	type deleteArgs struct {
+		ID           string `json:"id"`
+		ConfirmToken string `json:"confirm_token,omitempty"`
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "delete"}, func(ctx context.Context, req *mcp.CallToolRequest, args deleteArgs) (*mcp.CallToolResult, any, error) {
+		if result, ok := confirmer.Confirm(ctx, req, "will delete "+args.ID); !ok {
+			return result, nil, nil
+		}
+		executed.Add(1)
+		return Response("deleted"), nil, nil
+	})
+	return server
+}
+
+func TestConfirmElicitation(t *testing.T) {
+	for action, expected := range map[string]int32{"accept": 1, "decline": 0, "cancel": 0} {
+		t.Run(action, func(t *testing.T) {
+			ctx := context.Background()
+
+			var executed atomic.Int32
+			server := newConfirmServer(NewConfirmer(), &executed)
+
+			var message string
+			session := mcputiltest.Connect(ctx, t, server, &mcp.ClientOptions{
+				ElicitationHandler: func(_ context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+					message = req.Params.Message
+					return &mcp.ElicitResult{Action: action}, nil
+				},
+			})
+
+			res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "delete", Arguments: map[string]any{"id": "42"}})
+			if err != nil {
+				t.Fatalf("call tool: %v", err)
+			}
+			if !strings.Contains(message, "will delete 42") {
+				t.Errorf("expected elicitation to show the summary, got %q", message)
+			}
+			if executed.Load() != expected {
+				t.Errorf("expected %d executions, got %d", expected, executed.Load())
+			}
+			if res.IsError != (expected == 0) {
+				t.Errorf("unexpected error result %v", res.Content)
+			}
+		})
+	}
+}
+
+func TestConfirmToken(t *testing.T) {
+	ctx := context.Background()
+
+	var executed atomic.Int32
+	confirmer := NewConfirmer()
+	now := time.Now()
+	confirmer.now = func() time.Time { return now }
+	session := mcputiltest.Connect(ctx, t, newConfirmServer(confirmer, &executed), nil)
+
+	call := func(args map[string]any) string {
+		t.Helper()
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "delete", Arguments: args})
+		if err != nil {
+			t.Fatalf("call tool: %v", err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	text := call(map[string]any{"id": "42"})
+	if executed.Load() != 0 {
+		t.Fatal("expected the first call not to execute")
+	}
+	match := regexp.MustCompile(`confirm_token="([^"]+)"`).FindStringSubmatch(text)
+	if match == nil || !strings.Contains(text, "will delete 42") {
+		t.Fatalf("expected confirmation request with a token, got %q", text)
+	}
+	token := match[1]
+
+	call(map[string]any{"id": "43", "confirm_token": token})
+	if executed.Load() != 0 {
+		t.Error("expected the token to be rejected for different arguments")
+	}
+	call(map[string]any{"id": "42", "confirm_token": "garbage"})
+	if executed.Load() != 0 {
+		t.Error("expected a malformed token to be rejected")
+	}
+
+	call(map[string]any{"id": "42", "confirm_token": token})
+	if executed.Load() != 1 {
+		t.Error("expected the confirmed call to execute")
+	}
+
+	now = now.Add(DefaultConfirmTokenTTL + time.Second)
+	call(map[string]any{"id": "42", "confirm_token": token})
+	if executed.Load() != 1 {
+		t.Error("expected an expired token to be rejected")
+	}
+}
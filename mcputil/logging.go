@@ -0,0 +1,184 @@
+package mcputil
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// LogForwarder forwards the log records emitted while handling a request to the client
+// that made it as notifications/message, filtered by the level of its session.
+//
+// The client sets the session level with logging/setLevel, and the SDK keeps it in the session state,
+// independently of the process wide slog level. Stateless HTTP sessions do not outlive a single request,
+// and their session ID is not validated, so no level is remembered for them: the SDK forwards their
+// info records and above.
+type LogForwarder struct {
+	name string
+}
+
+// NewLogForwarder creates a LogForwarder, name is reported as the logger of forwarded records
+func NewLogForwarder(name string) *LogForwarder {
+	return &LogForwarder{name: name}
+}
+
+// Middleware is a receiving middleware that provides a request scoped logger in the context, see Logger.
+func (f *LogForwarder) Middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		ss, ok := req.GetSession().(*mcp.ServerSession)
+		if !ok || method == "initialize" || method == "logging/setLevel" || strings.HasPrefix(method, "notifications/") {
+			return next(ctx, method, req)
+		}
+
+		logger := slog.New(fanoutHandler{
+			slog.Default().Handler(),
+			requestHandler{
+				Handler: redactHandler{mcp.NewLoggingHandler(ss, &mcp.LoggingHandlerOptions{LoggerName: f.name})},
+				ctx:     ctx,
+			},
+		}).With("server", f.name, "method", method)
+		return next(WithLogger(ctx, logger), method, req)
+	}
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a new context with the logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the request scoped logger from the context, or the default logger
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// fanoutHandler sends records to every handler that is enabled for their level
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, 0, len(h))
+	for _, handler := range h {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, 0, len(h))
+	for _, handler := range h {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+	return handlers
+}
+
+// requestHandler handles records with the request context, even if they were logged without one,
+// as notifications are routed to the client by the request they relate to
+type requestHandler struct {
+	slog.Handler
+	ctx context.Context
+}
+
+func (h requestHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.Handler.Enabled(h.ctx, level)
+}
+
+func (h requestHandler) Handle(_ context.Context, r slog.Record) error {
+	return h.Handler.Handle(h.ctx, r)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{Handler: h.Handler.WithAttrs(attrs), ctx: h.ctx}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{Handler: h.Handler.WithGroup(name), ctx: h.ctx}
+}
+
+// sensitiveKeys are substrings of attribute keys whose values are never sent to clients
+var sensitiveKeys = []string{"authorization", "cookie", "password", "secret", "token"}
+
+var bearerRegexp = regexp.MustCompile(`(?i)bearer\s+[a-z0-9._~+/=-]+`)
+
+// redactHandler removes credentials from records before passing them on
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redacted = append(redacted, redactAttr(a))
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, "[REDACTED]")
+		}
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := v.Group()
+		attrs := make([]any, 0, len(group))
+		for _, ga := range group {
+			attrs = append(attrs, redactAttr(ga))
+		}
+		return slog.Group(a.Key, attrs...)
+	case slog.KindString:
+		return slog.String(a.Key, redactString(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func redactString(s string) string {
+	return bearerRegexp.ReplaceAllString(s, "Bearer [REDACTED]")
+}
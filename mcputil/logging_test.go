@@ -0,0 +1,111 @@
+package mcputil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestLogForwarder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "work"}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		Logger(ctx).Debug("debug record")
+		Logger(ctx).Warn("warning record", "access_token", "secret-value", "detail", "header Bearer abc.def")
+		return Response("done"), nil, nil
+	})
+	server.AddReceivingMiddleware(NewLogForwarder("test").Middleware)
+
+	connect := func(t *testing.T, stateless bool) (*mcp.ClientSession, func() []*mcp.LoggingMessageParams) {
+		srv := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+			return server
+		}, &mcp.StreamableHTTPOptions{Stateless: stateless}))
+		t.Cleanup(srv.Close)
+
+		var mu sync.Mutex
+		var messages []*mcp.LoggingMessageParams
+		client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "0.0.1"}, &mcp.ClientOptions{
+			LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) {
+				mu.Lock()
+				defer mu.Unlock()
+				messages = append(messages, req.Params)
+			},
+		})
+		session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: srv.URL}, nil)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { session.Close() })
+		return session, func() []*mcp.LoggingMessageParams {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]*mcp.LoggingMessageParams(nil), messages...)
+		}
+	}
+	// waitMessages calls the tool, and waits for its log messages
+	waitMessages := func(t *testing.T, session *mcp.ClientSession, received func() []*mcp.LoggingMessageParams, n int) []*mcp.LoggingMessageParams {
+		t.Helper()
+		if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "work"}); err != nil {
+			t.Fatalf("call tool: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for len(received()) < n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		msgs := received()
+		if len(msgs) != n {
+			t.Fatalf("expected %d log messages, got %d", n, len(msgs))
+		}
+		return msgs
+	}
+
+	t.Run("stateful", func(t *testing.T) {
+		session, received := connect(t, false)
+
+		// nothing is forwarded until the client sets a level
+		waitMessages(t, session, received, 0)
+
+		if err := session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "warning"}); err != nil {
+			t.Fatalf("set level: %v", err)
+		}
+		msgs := waitMessages(t, session, received, 1)
+		if msgs[0].Level != "warning" || msgs[0].Logger != "test" {
+			t.Errorf("unexpected message level %q and logger %q", msgs[0].Level, msgs[0].Logger)
+		}
+		data, err := json.Marshal(msgs[0].Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"warning record", `"access_token":"[REDACTED]"`, "Bearer [REDACTED]", `"method":"tools/call"`} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("expected log data to contain %s, got %s", want, data)
+			}
+		}
+		for _, unwanted := range []string{"secret-value", "abc.def"} {
+			if strings.Contains(string(data), unwanted) {
+				t.Errorf("log data was not redacted: %s", data)
+			}
+		}
+	})
+
+	t.Run("stateless", func(t *testing.T) {
+		session, received := connect(t, true)
+
+		// the level of a stateless session is not remembered, info records and above are forwarded
+		if err := session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "debug"}); err != nil {
+			t.Fatalf("set level: %v", err)
+		}
+		if msgs := waitMessages(t, session, received, 1); msgs[0].Level != "warning" {
+			t.Errorf("unexpected message level %q", msgs[0].Level)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package mcputil
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ProgressReporter reports the progress of a long-running request.
+// total is zero if unknown.
+type ProgressReporter func(progress, total float64, message string)
+
+type progressKey struct{}
+
+// progressState is the reporter of a context, with the last progress reported to it
+type progressState struct {
+	report ProgressReporter
+
+	mu   sync.Mutex
+	last float64
+}
+
+func (p *progressState) reportProgress(progress, total float64, message string) {
+	p.mu.Lock()
+	p.last = max(p.last, progress)
+	p.mu.Unlock()
+	p.report(progress, total, message)
+}
+
+// WithProgressReporter returns a new context that reports progress to r
+func WithProgressReporter(ctx context.Context, r ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressState{report: r})
+}
+
+// ContinueProgress returns a new context whose progress counts from the last progress reported to ctx, so that
+// a later step of a request, which counts its own progress from zero, keeps it increasing as MCP requires
+func ContinueProgress(ctx context.Context) context.Context {
+	parent, ok := ctx.Value(progressKey{}).(*progressState)
+	if !ok {
+		return ctx
+	}
+	parent.mu.Lock()
+	offset := parent.last
+	parent.mu.Unlock()
+	return context.WithValue(ctx, progressKey{}, &progressState{report: func(progress, total float64, message string) {
+		if total > 0 {
+			total += offset
+		}
+		parent.reportProgress(offset+progress, total, message)
+	}})
+}
+
+// WithProgress returns a new context that reports progress to the client that made the request,
+// if it asked for progress notifications by setting a progress token
+func WithProgress(ctx context.Context, req *mcp.CallToolRequest) context.Context {
+	if req == nil || req.Session == nil || req.Params == nil {
+		return ctx
+	}
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return ctx
+	}
+	return WithProgressReporter(ctx, func(progress, total float64, message string) {
+		err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      progress,
+			Total:         total,
+			Message:       message,
+		})
+		if err != nil {
+			slog.Debug("failed to send progress notification", "error", err)
+		}
+	})
+}
+
+// WithoutProgress returns a new context that reports no progress, for work whose own progress would interleave
+// with the progress of the request, such as concurrent fetches
+func WithoutProgress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, progressKey{}, nil)
+}
+
+// ReportProgress reports progress to the reporter in the context, if any
+func ReportProgress(ctx context.Context, progress, total float64, message string) {
+	if p, ok := ctx.Value(progressKey{}).(*progressState); ok {
+		p.reportProgress(progress, total, message)
+	}
+}
@@ -0,0 +1,30 @@
+package mcputil
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestContinueProgress(t *testing.T) {
+	var progress, totals []float64
+	ctx := WithProgressReporter(context.Background(), func(p, total float64, _ string) {
+		progress = append(progress, p)
+		totals = append(totals, total)
+	})
+
+	ReportProgress(ctx, 3, 0, "fetched")
+	next := ContinueProgress(ctx)
+	ReportProgress(next, 1, 2, "condensed")
+	ReportProgress(ContinueProgress(next), 1, 0, "done")
+	if !slices.Equal(progress, []float64{3, 4, 5}) || !slices.Equal(totals, []float64{0, 5, 0}) {
+		t.Errorf("unexpected progress %v of %v", progress, totals)
+	}
+
+	// without a reporter, nothing is reported
+	ReportProgress(ContinueProgress(context.Background()), 1, 0, "ignored")
+	ReportProgress(WithoutProgress(ctx), 10, 0, "ignored")
+	if len(progress) != 3 {
+		t.Errorf("expected no progress without a reporter, got %v", progress)
+	}
+}
@@ -0,0 +1,132 @@
+package mcputil
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ToolOptions customizes which tools a server instance exposes and how they are presented to clients
+type ToolOptions struct {
+	// Enabled is an allowlist of tool names, if empty all tools are enabled
+	Enabled []string
+	// Disabled is a denylist of tool names, applied after Enabled
+	Disabled []string
+	// Prefix is prepended to every tool name to avoid collisions in clients
+	Prefix string
+	// Descriptions overrides tool descriptions, keyed by the original tool name
+	Descriptions map[string]string
+}
+
+// ToolOptionsFromEnv reads tool options from the server instance environment:
+//
+//	TOOLS_ENABLED=a,b               only expose tools a and b
+//	TOOLS_DISABLED=c                hide tool c
+//	TOOLS_PREFIX=db_                expose tool a as db_a
+//	TOOL_DESCRIPTION_<NAME>=text    override the description of tool <name>
+func ToolOptionsFromEnv(env map[string]string) ToolOptions {
+	opts := ToolOptions{
+		Enabled:      splitList(env["TOOLS_ENABLED"]),
+		Disabled:     splitList(env["TOOLS_DISABLED"]),
+		Prefix:       env["TOOLS_PREFIX"],
+		Descriptions: make(map[string]string),
+	}
+	for k, v := range env {
+		if name, ok := strings.CutPrefix(k, "TOOL_DESCRIPTION_"); ok && name != "" {
+			opts.Descriptions[strings.ToLower(name)] = v
+		}
+	}
+	return opts
+}
+
+// ServerOptionsFromEnv returns the server options common to all server instances
+func ServerOptionsFromEnv(env map[string]string) *mcp.ServerOptions {
+	return &mcp.ServerOptions{
+		Instructions: env["INSTRUCTIONS"],
+	}
+}
+
+// IsZero reports whether the options leave the tools unchanged
+func (o ToolOptions) IsZero() bool {
+	return len(o.Enabled) == 0 && len(o.Disabled) == 0 && o.Prefix == "" && len(o.Descriptions) == 0
+}
+
+// ApplyToolOptions installs a middleware that applies the options to tools/list and tools/call
+func ApplyToolOptions(server *mcp.Server, opts ToolOptions) {
+	if opts.IsZero() {
+		return
+	}
+	server.AddReceivingMiddleware(opts.middleware)
+}
+
+func (o ToolOptions) isEnabled(name string) bool {
+	if len(o.Enabled) > 0 && !slices.Contains(o.Enabled, name) {
+		return false
+	}
+	return !slices.Contains(o.Disabled, name)
+}
+
+func (o ToolOptions) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		switch method {
+		case "tools/list":
+			res, err := next(ctx, method, req)
+			if err != nil {
+				return nil, err
+			}
+			list, ok := res.(*mcp.ListToolsResult)
+			if !ok {
+				return res, nil
+			}
+			return o.rewriteList(list), nil
+		case "tools/call":
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok || call.Params == nil {
+				return next(ctx, method, req)
+			}
+			name, ok := strings.CutPrefix(call.Params.Name, o.Prefix)
+			if !ok || !o.isEnabled(name) {
+				return nil, fmt.Errorf("unknown tool %q", call.Params.Name)
+			}
+			// copy the request, the original may be shared with other middleware
+			params := *call.Params
+			params.Name = name
+			rewritten := *call
+			rewritten.Params = &params
+			return next(ctx, method, &rewritten)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+func (o ToolOptions) rewriteList(list *mcp.ListToolsResult) *mcp.ListToolsResult {
+	tools := make([]*mcp.Tool, 0, len(list.Tools))
+	for _, t := range list.Tools {
+		if !o.isEnabled(t.Name) {
+			continue
+		}
+		// tools are owned by the server and must not be modified
+		tool := *t
+		tool.Name = o.Prefix + t.Name
+		if description, ok := o.Descriptions[t.Name]; ok {
+			tool.Description = description
+		}
+		tools = append(tools, &tool)
+	}
+	result := *list
+	result.Tools = tools
+	return &result
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
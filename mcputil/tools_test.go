@@ -0,0 +1,118 @@
+package mcputil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+func TestToolOptionsFromEnv(t *testing.T) {
+	opts := ToolOptionsFromEnv(map[string]string{
+		"TOOLS_ENABLED":                "a, b,,c",
+		"TOOLS_DISABLED":               "c",
+		"TOOLS_PREFIX":                 "db_",
+		"TOOL_DESCRIPTION_READ_QUERY":  "Run a query",
+		"TOOL_DESCRIPTION_":            "ignored",
+		"UNRELATED_TOOL_DESCRIPTION_X": "ignored",
+	})
+
+	if len(opts.Enabled) != 3 || opts.Enabled[0] != "a" || opts.Enabled[1] != "b" || opts.Enabled[2] != "c" {
+		t.Errorf("unexpected enabled tools: %q", opts.Enabled)
+	}
+	if len(opts.Disabled) != 1 || opts.Disabled[0] != "c" {
+		t.Errorf("unexpected disabled tools: %q", opts.Disabled)
+	}
+	if opts.Prefix != "db_" {
+		t.Errorf("unexpected prefix: %q", opts.Prefix)
+	}
+	if len(opts.Descriptions) != 1 || opts.Descriptions["read_query"] != "Run a query" {
+		t.Errorf("unexpected descriptions: %v", opts.Descriptions)
+	}
+	if !ToolOptionsFromEnv(nil).IsZero() {
+		t.Error("expected empty environment to produce zero options")
+	}
+}
+
+func TestApplyToolOptions(t *testing.T) {
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	for _, name := range []string{"list_tables", "read_query", "update"} {
+		mcp.AddTool(server, &mcp.Tool{
+			Name:        name,
+			Description: "original " + name,
+		}, func(context.Context, *mcp.CallToolRequest, struct{}) (*mcp.CallToolResult, any, error) {
+			return Response(name), nil, nil
+		})
+	}
+	ApplyToolOptions(server, ToolOptions{
+		Disabled:     []string{"update"},
+		Prefix:       "db_",
+		Descriptions: map[string]string{"read_query": "overridden"},
+	})
+
+	session := mcputiltest.Connect(ctx, t, server, nil)
+
+	list, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	descriptions := make(map[string]string)
+	for _, tool := range list.Tools {
+		descriptions[tool.Name] = tool.Description
+	}
+	expected := map[string]string{
+		"db_list_tables": "original list_tables",
+		"db_read_query":  "overridden",
+	}
+	if len(descriptions) != len(expected) {
+		t.Errorf("expected tools %v, got %v", expected, descriptions)
+	}
+	for name, description := range expected {
+		if descriptions[name] != description {
+			t.Errorf("expected %s description %q, got %q", name, description, descriptions[name])
+		}
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "db_read_query"})
+	if err != nil {
+		t.Fatalf("call db_read_query: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; text != `"read_query"` {
+		t.Errorf("expected read_query to be called, got %s", text)
+	}
+
+	for _, name := range []string{"read_query", "db_update", "db_missing"} {
+		if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name}); err == nil {
+			t.Errorf("expected call to %s to fail", name)
+		}
+	}
+}
+
+func TestApplyToolOptionsAllowlist(t *testing.T) {
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	for _, name := range []string{"search", "fetch"} {
+		mcp.AddTool(server, &mcp.Tool{Name: name}, func(context.Context, *mcp.CallToolRequest, struct{}) (*mcp.CallToolResult, any, error) {
+			return Response(name), nil, nil
+		})
+	}
+	ApplyToolOptions(server, ToolOptions{Enabled: []string{"search"}})
+
+	session := mcputiltest.Connect(ctx, t, server, nil)
+
+	list, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if len(list.Tools) != 1 || list.Tools[0].Name != "search" {
+		t.Errorf("expected only search tool, got %v", list.Tools)
+	}
+	if _, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "fetch"}); err == nil {
+		t.Error("expected call to fetch to fail")
+	}
+}
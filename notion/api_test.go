@@ -0,0 +1,267 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/drutil/drutiltest"
+	"github.com/pomerium/mcp-servers/mcputil"
+	"github.com/pomerium/mcp-servers/notion/notiontest"
+)
+
+// newWorkspace starts the stand-in API with the testdata workspace, and a provider that uses it
+func newWorkspace(t *testing.T, env map[string]string) (*notiontest.Server, drutil.Provider) {
+	t.Helper()
+	srv, n := newFixtureProvider(t, os.DirFS("testdata/workspace"), env)
+	// lists are paginated after two results, so that pagination is followed
+	srv.PageSize = 2
+	return srv, n
+}
+
+// newFixtureProvider starts the stand-in API with the fixtures, and a provider that uses it
+func newFixtureProvider(t testing.TB, fixtures fs.FS, env map[string]string) (*notiontest.Server, *notion) {
+	t.Helper()
+	srv := notiontest.NewServer(t, fixtures)
+	if env == nil {
+		env = make(map[string]string)
+	}
+	env["BASE_URL"] = srv.URL
+	p, err := NewProvider(context.Background(), env)
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	// the stand-in does not rate limit requests, so the provider does not need to either
+	p.(*notion).limiters = nil
+	return srv, p.(*notion)
+}
+
+// newFixtureClient starts the stand-in API with the fixtures, and returns a client of it for the page fetcher
+func newFixtureClient(t testing.TB, fixtures fs.FS) (*notiontest.Server, *notionapi.Client) {
+	t.Helper()
+	srv, n := newFixtureProvider(t, fixtures, nil)
+	client, err := n.getClient(testContext())
+	if err != nil {
+		t.Fatalf("get client: %v", err)
+	}
+	return srv, client
+}
+
+// fixtures returns the fixtures of the stand-in API from their JSON by file name, such as pages/<id>.json
+func fixtures(files map[string]string) fstest.MapFS {
+	fsys := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+// decodeBodies decodes the JSON request bodies recorded by the stand-in API
+func decodeBodies(t *testing.T, bodies []json.RawMessage) []map[string]any {
+	t.Helper()
+	decoded := make([]map[string]any, len(bodies))
+	for i, body := range bodies {
+		if err := json.Unmarshal(body, &decoded[i]); err != nil {
+			t.Fatalf("decode request body: %v", err)
+		}
+	}
+	return decoded
+}
+
+// tokenContext returns the context of a request authorized with the token
+func tokenContext(token string) context.Context {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return ctxutil.AuthorizationTokenFromRequest(context.Background(), req)
+}
+
+// testContext returns the context of a request authorized with the token of the stand-in API
+func testContext() context.Context {
+	return tokenContext(notiontest.Token)
+}
+
+func TestSearchAndFetch(t *testing.T) {
+	_, p := newWorkspace(t, map[string]string{"COMMENTS": "true"})
+	ctx := tokenContext(notiontest.Token)
+
+	results, err := p.Search(ctx, "launch")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	var titles []string
+	for _, doc := range results {
+		titles = append(titles, doc.Title)
+	}
+	if !slices.Equal(titles, []string{"Launch plan", "Write launch notes"}) {
+		t.Errorf("unexpected search results %q", titles)
+	}
+
+	doc, err := p.Fetch(ctx, "launch-plan")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	expected := strings.Join([]string{
+		"Ship the beta in March.",
+		"",
+		"1. Freeze the API",
+		"2. Announce",
+		"   - Blog post",
+		"",
+		"## Comments",
+		"",
+		"- **Ana** (2025-03-02 16:00 UTC): Can we ship earlier?",
+	}, "\n")
+	if doc.Text != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", doc.Text, expected)
+	}
+	if doc.Title != "Launch plan" || doc.Parent != "page:home" {
+		t.Errorf("unexpected document %+v", doc)
+	}
+
+	doc, err = p.Fetch(ctx, "tasks")
+	if err != nil {
+		t.Fatalf("fetch database: %v", err)
+	}
+	// null numbers are left empty rather than rendered as 0
+	if !strings.Contains(doc.Text, "| Write launch notes | In progress |  |") {
+		t.Errorf("expected the database rows, got:\n%s", doc.Text)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	srv, p := newWorkspace(t, map[string]string{})
+	ctx := tokenContext(notiontest.Token)
+
+	var apiErr *notionapi.Error
+	if _, err := p.Fetch(tokenContext("wrong-token"), "home"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+	if _, err := p.Fetch(ctx, "missing-page"); !errors.As(err, &apiErr) || apiErr.Code != "object_not_found" {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	// the database error is returned once the ID is known to be that of a database
+	srv.Fail("/v1/databases/tasks/query", http.StatusBadRequest, 1)
+	if _, err := p.Fetch(ctx, "tasks"); err == nil || !strings.Contains(err.Error(), "fetch database") {
+		t.Errorf("expected a database error, got %v", err)
+	}
+
+	// rate limited requests are retried
+	srv.Fail("/v1/pages/home", http.StatusTooManyRequests, 2)
+	before := len(srv.Requests())
+	if _, err := p.Fetch(ctx, "home"); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	attempts := 0
+	for _, r := range srv.Requests()[before:] {
+		if r == "GET /v1/pages/home" {
+			attempts++
+		}
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	_, p := newWorkspace(t, map[string]string{})
+	drutiltest.Run(t, p, drutiltest.Config{
+		Query:     "launch",
+		MissingID: "missing-page",
+		Context:   tokenContext(notiontest.Token),
+	})
+}
+
+func TestIndexedSearch(t *testing.T) {
+	_, p := newWorkspace(t, map[string]string{"INDEX_FILE": filepath.Join(t.TempDir(), "index.db")})
+	ix := p.(*notion).index
+	defer ix.close()
+	ctx := tokenContext(notiontest.Token)
+
+	search := func(query string) []string {
+		t.Helper()
+		q, err := drutil.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("parse query: %v", err)
+		}
+		results, err := p.(drutil.QuerySearcher).SearchQuery(ctx, q, drutil.SearchOptions{})
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		titles := []string{}
+		for _, doc := range results.Results {
+			titles = append(titles, doc.Title)
+		}
+		return titles
+	}
+	// the first search starts the crawl
+	search("ship")
+	ix.wg.Wait()
+
+	if titles := search("ship"); !slices.Equal(titles, []string{"Launch plan"}) {
+		t.Errorf("expected the page content to match, got %q", titles)
+	}
+	// the index only holds pages, the databases are matched by title
+	if titles := search("title:tasks"); !slices.Equal(titles, []string{"Tasks"}) {
+		t.Errorf("expected the database to match, got %q", titles)
+	}
+	if titles := search("type:page title:tasks"); len(titles) != 0 {
+		t.Errorf("expected no database, got %q", titles)
+	}
+}
+
+func TestIndexCrawlProgress(t *testing.T) {
+	_, p := newWorkspace(t, map[string]string{"INDEX_FILE": filepath.Join(t.TempDir(), "index.db")})
+	ix := p.(*notion).index
+	defer ix.close()
+
+	var mu sync.Mutex
+	returned, late := false, 0
+	ctx := mcputil.WithProgressReporter(testContext(), func(float64, float64, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if returned {
+			late++
+		}
+	})
+	q, _ := drutil.ParseQuery("ship")
+	// the search starts the crawl, that must not report to the request once it returned
+	if _, err := p.(drutil.QuerySearcher).SearchQuery(ctx, q, drutil.SearchOptions{}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	mu.Lock()
+	returned = true
+	mu.Unlock()
+	ix.wg.Wait()
+	if late > 0 {
+		t.Errorf("expected no progress after the search returned, got %d reports", late)
+	}
+}
+
+func TestNullNumbers(t *testing.T) {
+	_, p := newWorkspace(t, map[string]string{})
+	doc, err := p.Fetch(tokenContext(notiontest.Token), "task-1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if _, ok := doc.Metadata[propertyMetadataPrefix+"Weight"]; ok || strings.Contains(doc.Text, "Weight") {
+		t.Errorf("expected the null number to be left out, got %v\n%s", doc.Metadata, doc.Text)
+	}
+	if doc.Metadata[propertyMetadataPrefix+"Status"] != "In progress" {
+		t.Errorf("expected the other properties, got %v", doc.Metadata)
+	}
+}
@@ -0,0 +1,481 @@
+package notion
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jomei/notionapi"
+)
+
+const (
+	// maxRichTextLength is the maximum length of the content of a rich text object
+	maxRichTextLength = 2000
+	// maxBlockDepth is the number of levels of children a single request may create below its blocks
+	maxBlockDepth = 2
+	// maxAppendBlocks is the maximum number of blocks of a single request
+	maxAppendBlocks = 100
+)
+
+var (
+	headingLine    = regexp.MustCompile(`^(#{1,6})\s+(.*?)(\s+#+)?$`)
+	listItemLine   = regexp.MustCompile(`^([-*+]|\d+[.)])\s+(.*)$`)
+	todoItem       = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	dividerLine    = regexp.MustCompile(`^(-{3,}|\*{3,}|_{3,})$`)
+	imageLine      = regexp.MustCompile(`^!\[([^\]]*)\]\((\S+)\)$`)
+	tableSeparator = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// asciiPunctuation are the characters that can be escaped with a backslash
+const asciiPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// codeLanguages maps common fence languages to the languages of Notion code blocks, that are also accepted as is
+var codeLanguages = map[string]string{
+	"sh": "shell", "zsh": "shell", "console": "shell", "js": "javascript", "jsx": "javascript",
+	"ts": "typescript", "tsx": "typescript", "py": "python", "rb": "ruby", "rs": "rust",
+	"golang": "go", "yml": "yaml", "md": "markdown", "cpp": "c++", "cs": "c#", "csharp": "c#",
+	"dockerfile": "docker", "kt": "kotlin", "proto": "protobuf", "tex": "latex", "text": "plain text",
+	"abap": "abap", "arduino": "arduino", "bash": "bash", "basic": "basic", "c": "c", "clojure": "clojure",
+	"coffeescript": "coffeescript", "c++": "c++", "c#": "c#", "css": "css", "dart": "dart", "diff": "diff",
+	"docker": "docker", "elixir": "elixir", "elm": "elm", "erlang": "erlang", "flow": "flow", "fortran": "fortran",
+	"f#": "f#", "gherkin": "gherkin", "glsl": "glsl", "go": "go", "graphql": "graphql", "groovy": "groovy",
+	"haskell": "haskell", "html": "html", "java": "java", "javascript": "javascript", "json": "json",
+	"julia": "julia", "kotlin": "kotlin", "latex": "latex", "less": "less", "lisp": "lisp", "livescript": "livescript",
+	"lua": "lua", "makefile": "makefile", "markdown": "markdown", "markup": "markup", "matlab": "matlab",
+	"mermaid": "mermaid", "nix": "nix", "objective-c": "objective-c", "ocaml": "ocaml", "pascal": "pascal",
+	"perl": "perl", "php": "php", "plain text": "plain text", "powershell": "powershell", "prolog": "prolog",
+	"protobuf": "protobuf", "python": "python", "r": "r", "reason": "reason", "ruby": "ruby", "rust": "rust",
+	"sass": "sass", "scala": "scala", "scheme": "scheme", "scss": "scss", "shell": "shell", "sql": "sql",
+	"swift": "swift", "typescript": "typescript", "vb.net": "vb.net", "verilog": "verilog", "vhdl": "vhdl",
+	"visual basic": "visual basic", "webassembly": "webassembly", "xml": "xml", "yaml": "yaml",
+}
+
+// openItem is a list item whose more indented lines become its children
+type openItem struct {
+	indent   int
+	depth    int
+	children *notionapi.Blocks
+}
+
+// blockParser converts Markdown to Notion blocks, line by line
+type blockParser struct {
+	lines  []string
+	blocks notionapi.Blocks
+	items  []openItem
+}
+
+// markdownToBlocks converts Markdown to Notion blocks: headings, nested lists, to-dos, quotes,
+// code blocks, equations, dividers, tables, images and paragraphs with inline formatting.
+// Lists nested deeper than the API accepts in a single request are flattened.
+func markdownToBlocks(text string) []notionapi.Block {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	p := &blockParser{lines: strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n")}
+	var paragraph []string
+	var paragraphTarget *notionapi.Blocks
+	flush := func() {
+		if len(paragraph) > 0 {
+			*paragraphTarget = append(*paragraphTarget, &notionapi.ParagraphBlock{
+				BasicBlock: basicBlock(notionapi.BlockTypeParagraph),
+				Paragraph:  notionapi.Paragraph{RichText: markdownRichText(strings.Join(paragraph, "\n"))},
+			})
+		}
+		paragraph = nil
+	}
+
+	for i := 0; i < len(p.lines); i++ {
+		line := strings.TrimRight(p.lines[i], " ")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		target, depth := p.target(indent)
+		if paragraph != nil && target != paragraphTarget {
+			flush()
+		}
+
+		if m := listItemLine.FindStringSubmatch(trimmed); m != nil && !dividerLine.MatchString(trimmed) {
+			flush()
+			block, children := listItemBlock(m[1], m[2])
+			*target = append(*target, block)
+			p.items = append(p.items, openItem{indent: indent, depth: depth + 1, children: children})
+			continue
+		}
+
+		var block notionapi.Block
+		switch {
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			block, i = p.codeBlock(i, indent, trimmed)
+		case strings.HasPrefix(trimmed, "$$"):
+			block, i = p.equationBlock(i, trimmed)
+		case strings.HasPrefix(trimmed, ">"):
+			block, i = p.quoteBlock(i)
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(p.lines) && tableSeparator.MatchString(strings.TrimSpace(p.lines[i+1])):
+			block, i = p.tableBlock(i)
+		case dividerLine.MatchString(trimmed):
+			block = &notionapi.DividerBlock{BasicBlock: basicBlock(notionapi.BlockTypeDivider)}
+		default:
+			if m := headingLine.FindStringSubmatch(trimmed); m != nil {
+				block = headingBlock(len(m[1]), m[2])
+			} else if m := imageLine.FindStringSubmatch(trimmed); m != nil {
+				block = imageBlock(m[1], m[2])
+			}
+		}
+		if block == nil {
+			paragraph, paragraphTarget = append(paragraph, trimmed), target
+			continue
+		}
+		flush()
+		*target = append(*target, block)
+	}
+	flush()
+	return p.blocks
+}
+
+// target closes the list items that are not less indented than the line, and returns where the line's block goes
+func (p *blockParser) target(indent int) (*notionapi.Blocks, int) {
+	for len(p.items) > 0 && p.items[len(p.items)-1].indent >= indent {
+		p.items = p.items[:len(p.items)-1]
+	}
+	for i := len(p.items) - 1; i >= 0; i-- {
+		if p.items[i].depth <= maxBlockDepth {
+			return p.items[i].children, p.items[i].depth
+		}
+	}
+	return &p.blocks, 0
+}
+
+// codeBlock reads a fenced code block starting at line i, and returns the index of its last line
+func (p *blockParser) codeBlock(i, indent int, fence string) (notionapi.Block, int) {
+	marker := fence[:3]
+	language := strings.ToLower(strings.TrimSpace(strings.TrimLeft(fence, marker[:1])))
+	if l, ok := codeLanguages[language]; ok {
+		language = l
+	} else {
+		language = "plain text"
+	}
+	var code []string
+	for i++; i < len(p.lines); i++ {
+		line := p.lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), marker) {
+			break
+		}
+		// remove the indentation of the fence from the code
+		code = append(code, line[min(indent, len(line)-len(strings.TrimLeft(line, " "))):])
+	}
+	return &notionapi.CodeBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeCode),
+		Code:       notionapi.Code{RichText: plainRichText(strings.Join(code, "\n")), Language: language},
+	}, i
+}
+
+// equationBlock reads a $$ block starting at line i, that may be on a single line
+func (p *blockParser) equationBlock(i int, line string) (notionapi.Block, int) {
+	expression := strings.TrimPrefix(line, "$$")
+	if e, ok := strings.CutSuffix(expression, "$$"); ok {
+		expression = e
+	} else {
+		lines := []string{expression}
+		for i++; i < len(p.lines) && strings.TrimSpace(p.lines[i]) != "$$"; i++ {
+			lines = append(lines, p.lines[i])
+		}
+		expression = strings.Join(lines, "\n")
+	}
+	return &notionapi.EquationBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeEquation),
+		Equation:   notionapi.Equation{Expression: strings.TrimSpace(expression)},
+	}, i
+}
+
+// quoteBlock reads the consecutive quoted lines starting at line i
+func (p *blockParser) quoteBlock(i int) (notionapi.Block, int) {
+	var lines []string
+	for ; i < len(p.lines); i++ {
+		line, ok := strings.CutPrefix(strings.TrimSpace(p.lines[i]), ">")
+		if !ok {
+			break
+		}
+		lines = append(lines, strings.TrimPrefix(line, " "))
+	}
+	return &notionapi.QuoteBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeQuote),
+		Quote:      notionapi.Quote{RichText: markdownRichText(strings.Join(lines, "\n"))},
+	}, i - 1
+}
+
+// tableBlock reads a table whose header starts at line i. A header of empty cells is not a column header.
+func (p *blockParser) tableBlock(i int) (notionapi.Block, int) {
+	header := tableCells(p.lines[i])
+	rows := [][]string{header}
+	for i += 2; i < len(p.lines) && strings.HasPrefix(strings.TrimSpace(p.lines[i]), "|"); i++ {
+		rows = append(rows, tableCells(p.lines[i]))
+	}
+	hasHeader := strings.Join(header, "") != ""
+	if !hasHeader {
+		rows = rows[1:]
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	table := &notionapi.TableBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeTableBlock),
+		Table:      notionapi.Table{TableWidth: width, HasColumnHeader: hasHeader},
+	}
+	for _, row := range rows {
+		cells := make([][]notionapi.RichText, width)
+		for j := range cells {
+			cells[j] = []notionapi.RichText{}
+			if j < len(row) {
+				cells[j] = markdownRichText(strings.ReplaceAll(row[j], "<br>", "\n"))
+			}
+		}
+		table.Table.Children = append(table.Table.Children, &notionapi.TableRowBlock{
+			BasicBlock: basicBlock(notionapi.BlockTypeTableRowBlock),
+			TableRow:   notionapi.TableRow{Cells: cells},
+		})
+	}
+	return table, i - 1
+}
+
+// tableCells splits a table row on the pipes that are not escaped
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// listItemBlock returns the block of a list item and its children
+func listItemBlock(marker, text string) (notionapi.Block, *notionapi.Blocks) {
+	if m := todoItem.FindStringSubmatch(text); m != nil && (marker == "-" || marker == "*" || marker == "+") {
+		b := &notionapi.ToDoBlock{
+			BasicBlock: basicBlock(notionapi.BlockTypeToDo),
+			ToDo:       notionapi.ToDo{RichText: markdownRichText(m[2]), Checked: m[1] != " "},
+		}
+		return b, &b.ToDo.Children
+	}
+	if marker == "-" || marker == "*" || marker == "+" {
+		b := &notionapi.BulletedListItemBlock{
+			BasicBlock:       basicBlock(notionapi.BlockTypeBulletedListItem),
+			BulletedListItem: notionapi.ListItem{RichText: markdownRichText(text)},
+		}
+		return b, &b.BulletedListItem.Children
+	}
+	b := &notionapi.NumberedListItemBlock{
+		BasicBlock:       basicBlock(notionapi.BlockTypeNumberedListItem),
+		NumberedListItem: notionapi.ListItem{RichText: markdownRichText(text)},
+	}
+	return b, &b.NumberedListItem.Children
+}
+
+func headingBlock(level int, text string) notionapi.Block {
+	heading := notionapi.Heading{RichText: markdownRichText(text)}
+	switch level {
+	case 1:
+		return &notionapi.Heading1Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading1), Heading1: heading}
+	case 2:
+		return &notionapi.Heading2Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading2), Heading2: heading}
+	default:
+		// Notion has no headings below the third level
+		return &notionapi.Heading3Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading3), Heading3: heading}
+	}
+}
+
+func imageBlock(alt, url string) notionapi.Block {
+	image := notionapi.Image{Type: notionapi.FileTypeExternal, External: &notionapi.FileObject{URL: url}}
+	if alt != "" {
+		image.Caption = plainRichText(alt)
+	}
+	return &notionapi.ImageBlock{BasicBlock: basicBlock(notionapi.BlockTypeImage), Image: image}
+}
+
+func basicBlock(typ notionapi.BlockType) notionapi.BasicBlock {
+	return notionapi.BasicBlock{Object: notionapi.ObjectTypeBlock, Type: typ}
+}
+
+// plainRichText returns unformatted rich text, split in objects the API accepts
+func plainRichText(text string) []notionapi.RichText {
+	var p inlineParser
+	p.text.WriteString(text)
+	p.flush()
+	if p.runs == nil {
+		return []notionapi.RichText{}
+	}
+	return p.runs
+}
+
+// markdownRichText parses the inline Markdown of text: code spans, bold, italic, strikethrough,
+// links and backslash escapes
+func markdownRichText(text string) []notionapi.RichText {
+	var p inlineParser
+	p.parse(text)
+	p.flush()
+	if p.runs == nil {
+		return []notionapi.RichText{}
+	}
+	return p.runs
+}
+
+// inlineParser accumulates text in the current style, and starts a new run when the style changes
+type inlineParser struct {
+	runs        []notionapi.RichText
+	text        strings.Builder
+	annotations notionapi.Annotations
+	link        string
+}
+
+func (p *inlineParser) parse(text string) {
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(asciiPunctuation, text[i+1]) >= 0:
+			p.text.WriteByte(text[i+1])
+			i += 2
+
+		case c == '`':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			fence := text[i : i+n]
+			end := strings.Index(text[i+n:], fence)
+			if end < 0 {
+				p.text.WriteString(fence)
+				i += n
+				continue
+			}
+			code := text[i+n : i+n+end]
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			p.flush()
+			p.annotations.Code = true
+			p.text.WriteString(code)
+			p.flush()
+			p.annotations.Code = false
+			i += n + end + n
+
+		case c == '[':
+			label, url, n, ok := inlineLink(text[i:])
+			if !ok {
+				p.text.WriteByte(c)
+				i++
+				continue
+			}
+			p.flush()
+			previous := p.link
+			p.link = url
+			p.parse(label)
+			p.flush()
+			p.link = previous
+			i += n
+
+		case c == '*' || c == '_' || c == '~' && strings.HasPrefix(text[i:], "~~"):
+			marker := text[i : i+1]
+			if i+1 < len(text) && text[i+1] == c {
+				marker = text[i : i+2]
+			}
+			flag := p.flag(marker)
+			before, _ := utf8.DecodeLastRuneInString(text[:i])
+			after, _ := utf8.DecodeRuneInString(text[i+len(marker):])
+			switch {
+			case *flag && i > 0 && !unicode.IsSpace(before) && (c != '_' || !isWordRune(after)):
+				p.flush()
+				*flag = false
+			case !*flag && after != utf8.RuneError && !unicode.IsSpace(after) && (c != '_' || i == 0 || !isWordRune(before)) &&
+				strings.Contains(text[i+len(marker):], marker):
+				p.flush()
+				*flag = true
+			default:
+				p.text.WriteString(marker)
+			}
+			i += len(marker)
+
+		default:
+			p.text.WriteByte(c)
+			i++
+		}
+	}
+}
+
+// flag returns the annotation of an emphasis marker
+func (p *inlineParser) flag(marker string) *bool {
+	switch marker {
+	case "**", "__":
+		return &p.annotations.Bold
+	case "~~":
+		return &p.annotations.Strikethrough
+	default:
+		return &p.annotations.Italic
+	}
+}
+
+// flush ends the current run, splitting it in objects of at most maxRichTextLength characters
+func (p *inlineParser) flush() {
+	content := []rune(p.text.String())
+	p.text.Reset()
+	for len(content) > 0 {
+		n := min(len(content), maxRichTextLength)
+		t := notionapi.RichText{
+			Type: notionapi.ObjectTypeText,
+			Text: &notionapi.Text{Content: string(content[:n])},
+		}
+		if p.link != "" {
+			t.Text.Link = &notionapi.Link{Url: p.link}
+		}
+		if p.annotations != (notionapi.Annotations{}) {
+			annotations := p.annotations
+			t.Annotations = &annotations
+		}
+		p.runs = append(p.runs, t)
+		content = content[n:]
+	}
+}
+
+// inlineLink parses a [label](url) link at the start of text, and returns its length
+func inlineLink(text string) (label, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth > 0 {
+				continue
+			}
+			rest := text[i+1:]
+			if !strings.HasPrefix(rest, "(") {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			return text[1:i], strings.TrimSpace(rest[1:end]), i + 1 + end + 1, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
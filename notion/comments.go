@@ -0,0 +1,153 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+const (
+	// maxCommentedBlocks is the maximum number of blocks whose inline comments are fetched, as each takes a request
+	maxCommentedBlocks = 100
+	// maxExcerptLength is the maximum length of the excerpt of the block an inline comment is on
+	maxExcerptLength = 60
+)
+
+// commentTarget is a rendered block that may have inline comments
+type commentTarget struct {
+	id      notionapi.BlockID
+	excerpt string
+}
+
+// addCommentTarget records a rendered block, so that its inline comments can be fetched
+func (f *pageFetcher) addCommentTarget(block notionapi.Block, text string) {
+	if !f.comments {
+		return
+	}
+	if len(f.commentTargets) >= maxCommentedBlocks {
+		f.commentsCapped = true
+		return
+	}
+	line, _, _ := strings.Cut(text, "\n")
+	line = strings.TrimLeft(line, "#>-*[] ")
+	if runes := []rune(line); len(runes) > maxExcerptLength {
+		line = string(runes[:maxExcerptLength]) + "…"
+	}
+	f.commentTargets = append(f.commentTargets, commentTarget{id: block.GetID(), excerpt: line})
+}
+
+// renderComments fetches the comments on the page, then on its blocks with up to f.concurrency requests at
+// a time, and renders them in order as a Comments section. Replies are nested under the first comment of
+// their discussion.
+func (f *pageFetcher) renderComments(ctx context.Context) string {
+	// the blocks are only fetched if the integration can read the comments of the page
+	root, err := f.fetchComments(ctx, f.root)
+	if err != nil {
+		f.partial(ctx, "comments", f.root, err)
+		return ""
+	}
+	blocks := f.fetchBlockComments(ctx)
+	if f.commentsCapped {
+		drutil.Warn(ctx, fmt.Sprintf("only the inline comments of the first %d blocks were fetched", maxCommentedBlocks))
+	}
+
+	var lines []string
+	for i, target := range append([]commentTarget{{id: f.root}}, f.commentTargets...) {
+		comments := root
+		if i > 0 {
+			comments = blocks[i-1]
+		}
+		discussions := make(map[notionapi.DiscussionID]bool)
+		for _, c := range comments {
+			line := "**" + escapeMarkdown(f.userName(ctx, c.CreatedBy)) + "** (" + c.CreatedTime.UTC().Format("2006-01-02 15:04 UTC") + ")"
+			if target.excerpt != "" && !discussions[c.DiscussionID] {
+				line += " on “" + target.excerpt + "”"
+			}
+			line += ": " + f.richText(ctx, c.RichText)
+			marker := "- "
+			if discussions[c.DiscussionID] {
+				marker = "  - "
+			}
+			lines = append(lines, marker+strings.ReplaceAll(line, "\n", "\n"+strings.Repeat(" ", len(marker))))
+			discussions[c.DiscussionID] = true
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "## Comments\n\n" + strings.Join(lines, "\n")
+}
+
+// fetchBlockComments fetches the comments on the comment targets concurrently, the comments of the
+// blocks that cannot be fetched are left out with a warning
+func (f *pageFetcher) fetchBlockComments(ctx context.Context) [][]notionapi.Comment {
+	concurrency := f.concurrency
+	if concurrency == 0 {
+		concurrency = maxConcurrentFetches
+	}
+	results := make([][]notionapi.Comment, len(f.commentTargets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range f.commentTargets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			comments, err := f.fetchComments(ctx, target.id)
+			<-sem
+			if err != nil {
+				f.partial(ctx, "comments", target.id, err)
+				return
+			}
+			results[i] = comments
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// fetchComments fetches the unresolved comments on a page or block, following pagination
+func (f *pageFetcher) fetchComments(ctx context.Context, id notionapi.BlockID) ([]notionapi.Comment, error) {
+	var comments []notionapi.Comment
+	pagination := &notionapi.Pagination{}
+	for {
+		resp, err := f.client.Comment.Get(ctx, id, pagination)
+		if err != nil {
+			return nil, fmt.Errorf("get comments: %w", err)
+		}
+		comments = append(comments, resp.Results...)
+		if !resp.HasMore {
+			return comments, nil
+		}
+		pagination.StartCursor = resp.NextCursor
+	}
+}
+
+// userName returns the name of a user, that comments only reference by ID
+func (f *pageFetcher) userName(ctx context.Context, u notionapi.User) string {
+	if u.Name != "" {
+		return u.Name
+	}
+	id := u.ID.String()
+	if name, ok := f.users[id]; ok {
+		return name
+	}
+	name := id
+	if user, err := f.client.User.Get(ctx, notionapi.UserID(id)); err == nil && user.Name != "" {
+		name = user.Name
+	}
+	if f.users == nil {
+		f.users = make(map[string]string)
+	}
+	f.users[id] = name
+	return name
+}
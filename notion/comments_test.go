@@ -0,0 +1,58 @@
+package notion
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestFetchComments(t *testing.T) {
+	n := newPageServer(t, map[string]string{
+		"row-1": `{"object":"comment","id":"c-1","discussion_id":"d-1","created_time":"2025-03-01T10:00:00.000Z",
+			"created_by":{"object":"user","id":"u-1","name":"Ana"},"rich_text":[{"type":"text","plain_text":"Needs a **timeline**"}]}`,
+		"b-1": `{"object":"comment","id":"c-2","discussion_id":"d-2","created_time":"2025-03-01T11:00:00.000Z",
+			"created_by":{"object":"user","id":"u-2"},"rich_text":[{"type":"text","plain_text":"Closer to two hours"}]},
+			{"object":"comment","id":"c-3","discussion_id":"d-2","created_time":"2025-03-01T12:30:00.000Z",
+			"created_by":{"object":"user","id":"u-1","name":"Ana"},"rich_text":[{"type":"text","plain_text":"Fixed"}]}`,
+	})
+	n.comments = true
+
+	doc, err := n.Fetch(testContext(), "row-1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	expected := strings.Join([]string{
+		"The API was down for an hour.",
+		"",
+		"## Comments",
+		"",
+		`- **Ana** (2025-03-01 10:00 UTC): Needs a \*\*timeline\*\*`,
+		"- **Ben** (2025-03-01 11:00 UTC) on “The API was down for an hour.”: Closer to two hours",
+		"  - **Ana** (2025-03-01 12:30 UTC): Fixed",
+	}, "\n")
+	if !strings.HasSuffix(doc.Text, expected) {
+		t.Errorf("got:\n%s\nexpected suffix:\n%s", doc.Text, expected)
+	}
+
+	// comments are only fetched when enabled
+	n.comments = false
+	if doc, err := n.Fetch(testContext(), "row-1"); err != nil || strings.Contains(doc.Text, "## Comments") {
+		t.Errorf("expected no comments, got %v %q", err, doc.Text)
+	}
+}
+
+func TestCommentTargetsCap(t *testing.T) {
+	f := &pageFetcher{comments: true}
+	block := &notionapi.ParagraphBlock{BasicBlock: notionapi.BasicBlock{ID: "b-1"}}
+	for range maxCommentedBlocks {
+		f.addCommentTarget(block, "text")
+	}
+	if f.commentsCapped {
+		t.Errorf("expected the targets not to be capped yet")
+	}
+	f.addCommentTarget(block, "text")
+	if len(f.commentTargets) != maxCommentedBlocks || !f.commentsCapped {
+		t.Errorf("expected %d targets and the cap to be recorded, got %d %v", maxCommentedBlocks, len(f.commentTargets), f.commentsCapped)
+	}
+}
@@ -0,0 +1,527 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	// defaultDatabaseRows is the number of rows returned by query_database and by fetching a database
+	defaultDatabaseRows = 100
+	// maxDatabaseRows is the maximum number of rows returned by a single query_database call
+	maxDatabaseRows = 1000
+	// maxQueryPageSize is the maximum page size of the database query API
+	maxQueryPageSize = 100
+)
+
+type queryDatabaseArgs struct {
+	DatabaseID string           `json:"database_id" jsonschema:"The ID of the database, such as a search result of type database"`
+	Filter     []databaseFilter `json:"filter,omitempty" jsonschema:"Conditions that every returned row matches"`
+	Sort       []databaseSort   `json:"sort,omitempty" jsonschema:"Properties to order the rows by, the first one takes precedence"`
+	Limit      int              `json:"limit,omitempty" jsonschema:"Maximum number of rows to return, defaults to 100 and cannot exceed 1000"`
+	Cursor     string           `json:"cursor,omitempty" jsonschema:"The next_cursor of a previous query, to continue from"`
+}
+
+type databaseFilter struct {
+	Property string `json:"property" jsonschema:"Name of the database property"`
+	Operator string `json:"operator" jsonschema:"One of equals, does_not_equal, contains, does_not_contain, starts_with, ends_with, greater_than, less_than, on_or_after, on_or_before, is_empty or is_not_empty. The operators the property type supports are listed in the Notion filter documentation"`
+	Value    string `json:"value,omitempty" jsonschema:"Value to compare to: a number, true or false for checkboxes, a date as YYYY-MM-DD, or text. Not used by is_empty and is_not_empty"`
+}
+
+type databaseSort struct {
+	Property  string `json:"property" jsonschema:"Name of the database property"`
+	Direction string `json:"direction,omitempty" jsonschema:"ascending (the default) or descending"`
+}
+
+// databaseTable holds database rows with their property values typed after the property types
+type databaseTable struct {
+	Title      string           `json:"title"`
+	Columns    []databaseColumn `json:"columns"`
+	Rows       []databaseRow    `json:"rows"`
+	NextCursor string           `json:"next_cursor,omitempty" jsonschema:"Pass as cursor to get the next rows, empty if there are no more"`
+}
+
+type databaseColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type databaseRow struct {
+	ID     string         `json:"id"`
+	URL    string         `json:"url"`
+	Values map[string]any `json:"values"`
+}
+
+// addQueryDatabaseTool adds the query_database tool to the server
+func (n *notion) addQueryDatabaseTool(server *mcp.Server) {
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "query_database",
+		Description: "Query the rows of a Notion database, such as a tracker or a roadmap, with optional filters and sorts. " +
+			"Returns the rows as a Markdown table, and their typed property values as structured content",
+		Annotations: mcputil.ReadOnlyTool("Query database", true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args queryDatabaseArgs) (*mcp.CallToolResult, *databaseTable, error) {
+		table, err := n.queryDatabase(mcputil.WithProgress(ctx, req), args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("query database: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: table.markdown()}},
+		}, table, nil
+	})
+}
+
+// queryDatabase translates the filters and sorts to the database query API and follows its pagination up to the limit
+func (n *notion) queryDatabase(ctx context.Context, args queryDatabaseArgs) (*databaseTable, error) {
+	if args.Limit < 0 || args.Limit > maxDatabaseRows {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxDatabaseRows)
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = defaultDatabaseRows
+	}
+
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get notion client: %w", err)
+	}
+	db, err := client.Database.Get(ctx, notionapi.DatabaseID(args.DatabaseID))
+	if err != nil {
+		return nil, fmt.Errorf("get database: %w", err)
+	}
+	req, err := databaseQuery(db, args.Filter, args.Sort)
+	if err != nil {
+		return nil, err
+	}
+	req.StartCursor = notionapi.Cursor(args.Cursor)
+	return queryRows(ctx, client, db, req, limit)
+}
+
+// queryRows runs the query until it returns limit rows or has no more
+func queryRows(ctx context.Context, client *notionapi.Client, db *notionapi.Database, req *notionapi.DatabaseQueryRequest, limit int) (*databaseTable, error) {
+	ctx = withNullNumbers(ctx)
+	table := newDatabaseTable(db)
+	for {
+		req.PageSize = min(limit-len(table.Rows), maxQueryPageSize)
+		resp, err := client.Database.Query(ctx, notionapi.DatabaseID(db.ID), req)
+		if err != nil {
+			return nil, fmt.Errorf("database query api: %w", err)
+		}
+		for _, page := range resp.Results {
+			table.addRow(ctx, &page)
+		}
+		mcputil.ReportProgress(ctx, float64(len(table.Rows)), float64(limit), fmt.Sprintf("fetched %d rows", len(table.Rows)))
+
+		if !resp.HasMore {
+			return table, nil
+		}
+		if len(table.Rows) >= limit {
+			table.NextCursor = resp.NextCursor.String()
+			return table, nil
+		}
+		req.StartCursor = resp.NextCursor
+	}
+}
+
+// databaseQuery builds a query request, using the database property types to pick the filter conditions
+func databaseQuery(db *notionapi.Database, filters []databaseFilter, sorts []databaseSort) (*notionapi.DatabaseQueryRequest, error) {
+	req := &notionapi.DatabaseQueryRequest{}
+	var and notionapi.AndCompoundFilter
+	for _, f := range filters {
+		config, ok := db.Properties[f.Property]
+		if !ok {
+			return nil, fmt.Errorf("unknown property %q, expected one of %s", f.Property, strings.Join(slices.Sorted(maps.Keys(db.Properties)), ", "))
+		}
+		filter, err := propertyFilter(f, config.GetType())
+		if err != nil {
+			return nil, fmt.Errorf("filter on %q: %w", f.Property, err)
+		}
+		and = append(and, filter)
+	}
+	switch len(and) {
+	case 0:
+	case 1:
+		req.Filter = and[0]
+	default:
+		req.Filter = and
+	}
+
+	for _, s := range sorts {
+		if _, ok := db.Properties[s.Property]; !ok {
+			return nil, fmt.Errorf("unknown sort property %q", s.Property)
+		}
+		direction := notionapi.SortOrderASC
+		switch s.Direction {
+		case "", string(notionapi.SortOrderASC):
+		case string(notionapi.SortOrderDESC):
+			direction = notionapi.SortOrderDESC
+		default:
+			return nil, fmt.Errorf("invalid sort direction %q, expected ascending or descending", s.Direction)
+		}
+		req.Sorts = append(req.Sorts, notionapi.SortObject{Property: s.Property, Direction: direction})
+	}
+	return req, nil
+}
+
+// propertyFilter translates a filter to the condition of the property type
+func propertyFilter(f databaseFilter, typ notionapi.PropertyConfigType) (notionapi.PropertyFilter, error) {
+	filter := notionapi.PropertyFilter{Property: f.Property}
+	isEmpty, isNotEmpty := f.Operator == "is_empty", f.Operator == "is_not_empty"
+	unsupported := fmt.Errorf("operator %q is not supported by %s properties", f.Operator, typ)
+
+	switch typ {
+	case notionapi.PropertyConfigTypeTitle, notionapi.PropertyConfigTypeRichText, notionapi.PropertyConfigTypeURL,
+		notionapi.PropertyConfigTypeEmail, notionapi.PropertyConfigTypePhoneNumber:
+		c := &notionapi.TextFilterCondition{IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		switch f.Operator {
+		case "equals":
+			c.Equals = f.Value
+		case "does_not_equal":
+			c.DoesNotEqual = f.Value
+		case "contains":
+			c.Contains = f.Value
+		case "does_not_contain":
+			c.DoesNotContain = f.Value
+		case "starts_with":
+			c.StartsWith = f.Value
+		case "ends_with":
+			c.EndsWith = f.Value
+		case "is_empty", "is_not_empty":
+		default:
+			return filter, unsupported
+		}
+		// the API expects the rich_text condition for all text property types
+		filter.RichText = c
+
+	case notionapi.PropertyConfigTypeNumber:
+		c := &notionapi.NumberFilterCondition{IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		var v float64
+		if !isEmpty && !isNotEmpty {
+			var err error
+			if v, err = strconv.ParseFloat(f.Value, 64); err != nil {
+				return filter, fmt.Errorf("invalid number %q", f.Value)
+			}
+		}
+		switch f.Operator {
+		case "equals":
+			c.Equals = &v
+		case "does_not_equal":
+			c.DoesNotEqual = &v
+		case "greater_than":
+			c.GreaterThan = &v
+		case "less_than":
+			c.LessThan = &v
+		case "is_empty", "is_not_empty":
+		default:
+			return filter, unsupported
+		}
+		filter.Number = c
+
+	case notionapi.PropertyConfigTypeCheckbox:
+		v, err := strconv.ParseBool(f.Value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid checkbox value %q, expected true or false", f.Value)
+		}
+		switch f.Operator {
+		case "equals":
+		case "does_not_equal":
+			v = !v
+		default:
+			return filter, unsupported
+		}
+		// false values are omitted from the request, so match on the negation instead
+		if v {
+			filter.Checkbox = &notionapi.CheckboxFilterCondition{Equals: true}
+		} else {
+			filter.Checkbox = &notionapi.CheckboxFilterCondition{DoesNotEqual: true}
+		}
+
+	case notionapi.PropertyConfigTypeSelect, notionapi.PropertyConfigStatus:
+		c := &notionapi.SelectFilterCondition{IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		switch f.Operator {
+		case "equals":
+			c.Equals = f.Value
+		case "does_not_equal":
+			c.DoesNotEqual = f.Value
+		case "is_empty", "is_not_empty":
+		default:
+			return filter, unsupported
+		}
+		if typ == notionapi.PropertyConfigStatus {
+			filter.Status = (*notionapi.StatusFilterCondition)(c)
+		} else {
+			filter.Select = c
+		}
+
+	case notionapi.PropertyConfigTypeMultiSelect, notionapi.PropertyConfigTypePeople, notionapi.PropertyConfigTypeRelation:
+		var contains, doesNotContain string
+		switch f.Operator {
+		case "contains":
+			contains = f.Value
+		case "does_not_contain":
+			doesNotContain = f.Value
+		case "is_empty", "is_not_empty":
+		default:
+			return filter, unsupported
+		}
+		switch typ {
+		case notionapi.PropertyConfigTypeMultiSelect:
+			filter.MultiSelect = &notionapi.MultiSelectFilterCondition{Contains: contains, DoesNotContain: doesNotContain, IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		case notionapi.PropertyConfigTypePeople:
+			filter.People = &notionapi.PeopleFilterCondition{Contains: contains, DoesNotContain: doesNotContain, IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		default:
+			filter.Relation = &notionapi.RelationFilterCondition{Contains: contains, DoesNotContain: doesNotContain, IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		}
+
+	case notionapi.PropertyConfigTypeDate, notionapi.PropertyConfigCreatedTime, notionapi.PropertyConfigLastEditedTime:
+		c := &notionapi.DateFilterCondition{IsEmpty: isEmpty, IsNotEmpty: isNotEmpty}
+		var d notionapi.Date
+		if !isEmpty && !isNotEmpty {
+			if err := d.UnmarshalText([]byte(f.Value)); err != nil {
+				return filter, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", f.Value)
+			}
+		}
+		switch f.Operator {
+		case "equals":
+			c.Equals = &d
+		case "greater_than":
+			c.After = &d
+		case "less_than":
+			c.Before = &d
+		case "on_or_after":
+			c.OnOrAfter = &d
+		case "on_or_before":
+			c.OnOrBefore = &d
+		case "is_empty", "is_not_empty":
+		default:
+			return filter, unsupported
+		}
+		filter.Date = c
+
+	default:
+		return filter, fmt.Errorf("filtering %s properties is not supported", typ)
+	}
+	return filter, nil
+}
+
+func newDatabaseTable(db *notionapi.Database) *databaseTable {
+	table := &databaseTable{Title: richTextToPlain(db.Title)}
+	// the API does not return the column order of the database views, so the title comes first, then the names in order
+	for _, name := range slices.Sorted(maps.Keys(db.Properties)) {
+		column := databaseColumn{Name: name, Type: string(db.Properties[name].GetType())}
+		if db.Properties[name].GetType() == notionapi.PropertyConfigTypeTitle {
+			table.Columns = slices.Insert(table.Columns, 0, column)
+		} else {
+			table.Columns = append(table.Columns, column)
+		}
+	}
+	return table
+}
+
+func (t *databaseTable) addRow(ctx context.Context, page *notionapi.Page) {
+	row := databaseRow{ID: page.ID.String(), URL: page.URL, Values: make(map[string]any, len(page.Properties))}
+	for name, p := range page.Properties {
+		if v := propertyValue(p); v != nil && !isNullNumber(ctx, page.ID, name) {
+			row.Values[name] = v
+		}
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// markdown renders the rows as a Markdown table, with a row ID column to fetch them
+func (t *databaseTable) markdown() string {
+	var b strings.Builder
+	b.WriteString("| ")
+	for _, c := range t.Columns {
+		b.WriteString(tableCell(c.Name) + " | ")
+	}
+	b.WriteString("ID |\n|")
+	b.WriteString(strings.Repeat(" --- |", len(t.Columns)+1))
+	b.WriteString("\n")
+	for _, row := range t.Rows {
+		b.WriteString("| ")
+		for _, c := range t.Columns {
+			b.WriteString(tableCell(formatValue(row.Values[c.Name])) + " | ")
+		}
+		b.WriteString(row.ID + " |\n")
+	}
+	fmt.Fprintf(&b, "\n%d rows", len(t.Rows))
+	if t.NextCursor != "" {
+		fmt.Fprintf(&b, ", more rows are available with cursor %s", t.NextCursor)
+	}
+	return b.String()
+}
+
+// propertyValue returns the value of a page property as a string, number, bool or list of strings,
+// or nil if it is empty. Null numbers are decoded as 0, callers leave them out with isNullNumber.
+func propertyValue(p notionapi.Property) any {
+	switch p := p.(type) {
+	case *notionapi.TitleProperty:
+		return nonEmpty(extractRichText(p.Title))
+	case *notionapi.RichTextProperty:
+		return nonEmpty(extractRichText(p.RichText))
+	case *notionapi.TextProperty:
+		return nonEmpty(extractRichText(p.Text))
+	case *notionapi.NumberProperty:
+		return p.Number
+	case *notionapi.CheckboxProperty:
+		return p.Checkbox
+	case *notionapi.SelectProperty:
+		return nonEmpty(p.Select.Name)
+	case *notionapi.StatusProperty:
+		return nonEmpty(p.Status.Name)
+	case *notionapi.MultiSelectProperty:
+		var names []string
+		for _, o := range p.MultiSelect {
+			names = append(names, o.Name)
+		}
+		return nonEmptyList(names)
+	case *notionapi.DateProperty:
+		return dateValue(p.Date)
+	case *notionapi.PeopleProperty:
+		var names []string
+		for _, u := range p.People {
+			names = append(names, userName(u))
+		}
+		return nonEmptyList(names)
+	case *notionapi.RelationProperty:
+		var ids []string
+		for _, r := range p.Relation {
+			ids = append(ids, r.ID.String())
+		}
+		return nonEmptyList(ids)
+	case *notionapi.FilesProperty:
+		var names []string
+		for _, f := range p.Files {
+			names = append(names, f.Name)
+		}
+		return nonEmptyList(names)
+	case *notionapi.URLProperty:
+		return nonEmpty(p.URL)
+	case *notionapi.EmailProperty:
+		return nonEmpty(p.Email)
+	case *notionapi.PhoneNumberProperty:
+		return nonEmpty(p.PhoneNumber)
+	case *notionapi.FormulaProperty:
+		switch p.Formula.Type {
+		case notionapi.FormulaTypeString:
+			return nonEmpty(p.Formula.String)
+		case notionapi.FormulaTypeNumber:
+			return p.Formula.Number
+		case notionapi.FormulaTypeBoolean:
+			return p.Formula.Boolean
+		case notionapi.FormulaTypeDate:
+			return dateValue(p.Formula.Date)
+		}
+	case *notionapi.RollupProperty:
+		switch p.Rollup.Type {
+		case notionapi.RollupTypeNumber:
+			return p.Rollup.Number
+		case notionapi.RollupTypeDate:
+			return dateValue(p.Rollup.Date)
+		case notionapi.RollupTypeArray:
+			var values []string
+			for _, item := range p.Rollup.Array {
+				if v := propertyValue(item); v != nil {
+					values = append(values, formatValue(v))
+				}
+			}
+			return nonEmptyList(values)
+		}
+	case *notionapi.UniqueIDProperty:
+		return p.UniqueID.String()
+	case *notionapi.CreatedTimeProperty:
+		return formatTime(p.CreatedTime)
+	case *notionapi.LastEditedTimeProperty:
+		return formatTime(p.LastEditedTime)
+	case *notionapi.CreatedByProperty:
+		return userName(p.CreatedBy)
+	case *notionapi.LastEditedByProperty:
+		return userName(p.LastEditedBy)
+	}
+	return nil
+}
+
+// dateValue returns the start of the date, followed by its end for date ranges
+func dateValue(d *notionapi.DateObject) any {
+	if d == nil || d.Start == nil {
+		return nil
+	}
+	v := formatTime(time.Time(*d.Start))
+	if d.End != nil {
+		v += " → " + formatTime(time.Time(*d.End))
+	}
+	return v
+}
+
+// formatTime formats dates without a time of day as YYYY-MM-DD, and others as RFC3339
+func formatTime(t time.Time) string {
+	if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// tableCell escapes the characters that break a Markdown table row
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+func nonEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nonEmptyList(values []string) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// isDatabaseError reports whether fetching a page failed because the ID may be that of a database
+func isDatabaseError(err error) bool {
+	var apiErr *notionapi.Error
+	return errors.As(err, &apiErr) && (apiErr.Status == http.StatusBadRequest || apiErr.Status == http.StatusNotFound)
+}
+
+// databaseText returns the description and first rows of a database as text
+func databaseText(ctx context.Context, client *notionapi.Client, db *notionapi.Database) (string, error) {
+	table, err := queryRows(ctx, client, db, &notionapi.DatabaseQueryRequest{}, defaultDatabaseRows)
+	if err != nil {
+		return "", err
+	}
+	text := table.markdown()
+	if description := richTextToPlain(db.Description); description != "" {
+		text = description + "\n\n" + text
+	}
+	return text, nil
+}
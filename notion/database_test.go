@@ -0,0 +1,166 @@
+package notion
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/notion/notiontest"
+)
+
+const testDatabase = `{"object":"database","id":"db-1","title":[{"type":"text","plain_text":"Incidents"}],
+	"description":[{"type":"text","plain_text":"Production incidents"}],"url":"https://notion.so/db-1",
+	"properties":{
+		"Name":{"id":"title","type":"title","title":{}},
+		"Status":{"id":"s","type":"status","status":{}},
+		"Severity":{"id":"n","type":"number","number":{}},
+		"Resolved":{"id":"c","type":"checkbox","checkbox":{}},
+		"Date":{"id":"d","type":"date","date":{}},
+		"Tags":{"id":"t","type":"multi_select","multi_select":{}}
+	}}`
+
+// testRow returns a page of the test database
+func testRow(id, title string, severity int) string {
+	return fmt.Sprintf(`{"object":"page","id":%q,"url":"https://notion.so/%s","parent":{"type":"database_id","database_id":"db-1"},"properties":{
+		"Name":{"type":"title","title":[{"type":"text","plain_text":%q}]},
+		"Status":{"type":"status","status":{"name":"Done"}},
+		"Severity":{"type":"number","number":%d},
+		"Resolved":{"type":"checkbox","checkbox":true},
+		"Date":{"type":"date","date":{"start":"2025-03-01","end":null}},
+		"Tags":{"type":"multi_select","multi_select":[{"name":"api"},{"name":"db"}]}
+	}}`, id, id, title, severity)
+}
+
+// newDatabaseServer serves the database and its three rows, one per result page
+func newDatabaseServer(t *testing.T) (*notiontest.Server, *notion) {
+	t.Helper()
+	srv, n := newFixtureProvider(t, fixtures(map[string]string{
+		"databases/db-1.json": testDatabase,
+		"pages/row-1.json":    testRow("row-1", "API | outage", 2),
+		"pages/row-2.json":    testRow("row-2", "Slow queries", 3),
+		"pages/row-3.json":    testRow("row-3", "Incidents review", 1),
+	}), nil)
+	srv.PageSize = 1
+	return srv, n
+}
+
+func TestQueryDatabase(t *testing.T) {
+	srv, n := newDatabaseServer(t)
+
+	table, err := n.queryDatabase(testContext(), queryDatabaseArgs{
+		DatabaseID: "db-1",
+		Filter: []databaseFilter{
+			{Property: "Severity", Operator: "greater_than", Value: "1"},
+			{Property: "Resolved", Operator: "equals", Value: "false"},
+			{Property: "Status", Operator: "does_not_equal", Value: "Open"},
+		},
+		Sort:  []databaseSort{{Property: "Date", Direction: "descending"}},
+		Limit: 2,
+	})
+	if err != nil {
+		t.Fatalf("query database: %v", err)
+	}
+
+	queries := decodeBodies(t, srv.Bodies("POST /v1/databases/db-1/query"))
+	if len(queries) != 2 {
+		t.Fatalf("expected the query to follow pagination, got %d requests", len(queries))
+	}
+	expected := map[string]any{
+		"filter": map[string]any{"and": []any{
+			map[string]any{"property": "Severity", "number": map[string]any{"greater_than": float64(1)}},
+			map[string]any{"property": "Resolved", "checkbox": map[string]any{"does_not_equal": true}},
+			map[string]any{"property": "Status", "status": map[string]any{"does_not_equal": "Open"}},
+		}},
+		"sorts":     []any{map[string]any{"property": "Date", "direction": "descending"}},
+		"page_size": float64(2),
+	}
+	if !reflect.DeepEqual(queries[0], expected) {
+		t.Errorf("unexpected query %v, expected %v", queries[0], expected)
+	}
+	if queries[1]["start_cursor"] != "1" || queries[1]["page_size"] != float64(1) {
+		t.Errorf("unexpected second query %v", queries[1])
+	}
+
+	if table.NextCursor != "2" || len(table.Rows) != 2 {
+		t.Fatalf("unexpected table %+v", table)
+	}
+	if expected := map[string]any{
+		"Name": "API | outage", "Status": "Done", "Severity": float64(2), "Resolved": true,
+		"Date": "2025-03-01", "Tags": []string{"api", "db"},
+	}; !reflect.DeepEqual(table.Rows[0].Values, expected) {
+		t.Errorf("unexpected row values %v, expected %v", table.Rows[0].Values, expected)
+	}
+
+	markdown := table.markdown()
+	for _, line := range []string{
+		"| Name | Date | Resolved | Severity | Status | Tags | ID |",
+		"| API \\| outage | 2025-03-01 | true | 2 | Done | api, db | row-1 |",
+		"2 rows, more rows are available with cursor 2",
+	} {
+		if !strings.Contains(markdown, line) {
+			t.Errorf("expected table to contain %q, got:\n%s", line, markdown)
+		}
+	}
+}
+
+func TestQueryDatabaseInvalid(t *testing.T) {
+	srv, n := newDatabaseServer(t)
+
+	for _, args := range []queryDatabaseArgs{
+		{DatabaseID: "db-1", Filter: []databaseFilter{{Property: "Missing", Operator: "equals", Value: "x"}}},
+		{DatabaseID: "db-1", Filter: []databaseFilter{{Property: "Severity", Operator: "contains", Value: "1"}}},
+		{DatabaseID: "db-1", Filter: []databaseFilter{{Property: "Severity", Operator: "equals", Value: "high"}}},
+		{DatabaseID: "db-1", Filter: []databaseFilter{{Property: "Date", Operator: "equals", Value: "March"}}},
+		{DatabaseID: "db-1", Sort: []databaseSort{{Property: "Name", Direction: "up"}}},
+		{DatabaseID: "db-1", Limit: maxDatabaseRows + 1},
+	} {
+		if _, err := n.queryDatabase(testContext(), args); err == nil {
+			t.Errorf("expected an error for %+v", args)
+		}
+	}
+	if queries := srv.Bodies("POST /v1/databases/db-1/query"); len(queries) != 0 {
+		t.Errorf("expected invalid queries not to be sent, got %s", queries)
+	}
+}
+
+func TestFetchDatabase(t *testing.T) {
+	srv, n := newDatabaseServer(t)
+
+	doc, err := n.Fetch(testContext(), "db-1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if doc.Title != "Incidents" || doc.ContentType != "database" {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	if !strings.HasPrefix(doc.Text, "Production incidents\n\n| Name |") || !strings.HasSuffix(doc.Text, "\n3 rows") {
+		t.Errorf("unexpected text %q", doc.Text)
+	}
+	if queries := srv.Bodies("POST /v1/databases/db-1/query"); len(queries) != 3 {
+		t.Errorf("expected all the rows to be queried, got %d requests", len(queries))
+	}
+}
+
+func TestSearchDatabases(t *testing.T) {
+	srv, n := newDatabaseServer(t)
+	srv.PageSize = 0
+
+	results, err := n.SearchWithOptions(testContext(), "incidents", drutil.SearchOptions{})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if body := decodeBodies(t, srv.Bodies("POST /v1/search")); !reflect.DeepEqual(body, []map[string]any{{"query": "incidents"}}) {
+		t.Errorf("expected a search without type filter, got %v", body)
+	}
+	if len(results.Results) != 2 {
+		t.Fatalf("expected the page and the database, got %+v", results.Results)
+	}
+	if page := results.Results[0]; page.Title != "Incidents review" {
+		t.Errorf("expected the title of the database page, got %+v", page)
+	}
+	if db := results.Results[1]; db.ID != "db-1" || db.Title != "Incidents" || db.ContentType != "database" {
+		t.Errorf("unexpected database result %+v", db)
+	}
+}
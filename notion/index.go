@@ -0,0 +1,468 @@
+package notion
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+	_ "modernc.org/sqlite" // SQLite driver
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+const (
+	defaultIndexInterval = 15 * time.Minute
+	// indexCrawlTimeout bounds a single crawl, pages left out are indexed by the next one
+	indexCrawlTimeout = 30 * time.Minute
+	// maxIndexPages is the maximum number of pages fetched by a single crawl, the next one fetches the others
+	maxIndexPages = 1000
+	// indexSweepInterval is the interval of the full crawls, that list all the pages to find the removed ones.
+	// The crawls in between stop listing at the pages edited before the watermark.
+	indexSweepInterval = 24 * time.Hour
+	// defaultIndexResults is the number of index search results when no limit is requested
+	defaultIndexResults = 20
+	// indexCursorPrefix marks the cursors of index searches, other cursors belong to the Search API
+	indexCursorPrefix = "index:"
+	// indexTimeFormat has a fixed width so that the stored times sort as text
+	indexTimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+const indexSchema = `
+CREATE TABLE IF NOT EXISTS pages (
+	identity TEXT NOT NULL,
+	id TEXT NOT NULL,
+	last_edited TEXT NOT NULL,
+	document TEXT NOT NULL,
+	PRIMARY KEY (identity, id)
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS content USING fts5(
+	identity UNINDEXED, id UNINDEXED, title, text, tokenize = 'porter unicode61'
+);
+CREATE TABLE IF NOT EXISTS crawls (
+	identity TEXT PRIMARY KEY,
+	watermark TEXT NOT NULL
+);`
+
+// contentIndex is a full-text index of the pages each user can see, stored in a sqlite FTS5 database.
+// Every row holds the identity of the user whose token crawled it, and searches only match the rows of the caller.
+type contentIndex struct {
+	n        *notion
+	db       *sql.DB
+	interval time.Duration
+	// ctx is the context of the server, crawls are cancelled when it is done
+	ctx context.Context
+
+	mu sync.Mutex
+	// started holds the start time of the last crawl of each identity
+	started map[string]time.Time
+	// swept holds the start time of the last complete full crawl of each identity
+	swept map[string]time.Time
+	// running holds the identities being crawled
+	running map[string]bool
+	closed  bool
+	// wg tracks the running crawls
+	wg sync.WaitGroup
+}
+
+// newContentIndex opens the index in the file, that is closed once ctx is done
+func newContentIndex(ctx context.Context, n *notion, file string, interval time.Duration) (*contentIndex, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, fmt.Errorf("open index %s: %w", file, err)
+	}
+	// a single connection serializes the writes of concurrent crawls, and keeps in-memory databases alive
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(indexSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create index schema: %w", err)
+	}
+	if interval == 0 {
+		interval = defaultIndexInterval
+	}
+	ix := &contentIndex{
+		n:        n,
+		db:       db,
+		interval: interval,
+		ctx:      ctx,
+		started:  make(map[string]time.Time),
+		swept:    make(map[string]time.Time),
+		running:  make(map[string]bool),
+	}
+	go func() {
+		<-ctx.Done()
+		if err := ix.close(); err != nil {
+			slog.Warn("failed to close notion index", "error", err)
+		}
+	}()
+	return ix, nil
+}
+
+// indexIdentity returns the partition of the index of the caller: the Pomerium user if known, or a hash of the token
+func indexIdentity(ctx context.Context) (string, error) {
+	if identity, ok := ctxutil.IdentityFromContext(ctx); ok && identity.User != "" {
+		return "user:" + identity.User, nil
+	}
+	token, err := ctxutil.AuthorizationTokenFromContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get token from context: %w", err)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:]), nil
+}
+
+// refresh starts a background crawl for the identity of the caller, unless one is running or ran within the interval
+func (ix *contentIndex) refresh(ctx context.Context, identity string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.closed || ix.running[identity] || time.Since(ix.started[identity]) < ix.interval {
+		return
+	}
+	ix.running[identity] = true
+	ix.started[identity] = time.Now()
+
+	// the crawl outlives the request, and only keeps its credentials: its progress reporter, logger and warnings
+	// belong to the request
+	ctx, cancel := context.WithTimeout(ctxutil.WithCredentials(ix.ctx, ctx), indexCrawlTimeout)
+	ix.wg.Add(1)
+	go func() {
+		defer ix.wg.Done()
+		defer cancel()
+		if err := ix.crawl(ctx, identity); err != nil {
+			slog.Warn("failed to index notion pages", "identity", identity, "error", err)
+		}
+		ix.mu.Lock()
+		delete(ix.running, identity)
+		ix.mu.Unlock()
+	}()
+}
+
+// crawl lists the pages of the caller, most recently edited first, and indexes those whose last edited time changed
+// since they were indexed. The watermark holds the newest indexed edit, and tells searches that the identity is
+// indexed. Incremental crawls stop listing at the pages edited before the watermark. Full crawls, the first one
+// and then every indexSweepInterval, list all the pages, and remove the rows of those that were not listed because
+// they were deleted, archived or are no longer shared with the integration. A crawl that leaves edited pages out,
+// because it reached maxIndexPages or fetched incomplete content, makes the next one full.
+func (ix *contentIndex) crawl(ctx context.Context, identity string) error {
+	client, err := ix.n.getClient(ctx)
+	if err != nil {
+		return fmt.Errorf("get notion client: %w", err)
+	}
+	// the crawl has its own request budget, that leaves the interactive calls of the token first
+	ctx = withBackgroundRequests(ctx)
+	var watermark string
+	err = ix.db.QueryRowContext(ctx, `SELECT watermark FROM crawls WHERE identity = ?`, identity).Scan(&watermark)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("get watermark: %w", err)
+	}
+	start := time.Now()
+	ix.mu.Lock()
+	full := watermark == "" || start.Sub(ix.swept[identity]) >= indexSweepInterval
+	ix.mu.Unlock()
+
+	req := &notionapi.SearchRequest{
+		Filter:   notionapi.SearchFilter{Value: string(notionapi.ObjectTypePage), Property: "object"},
+		Sort:     &notionapi.SortObject{Timestamp: notionapi.TimestampLastEdited, Direction: notionapi.SortOrderDESC},
+		PageSize: maxQueryPageSize,
+	}
+	listed := make(map[string]bool)
+	var fetched int
+	// left tells whether edited pages were left out
+	left := false
+	done := false
+	for !done {
+		resp, err := client.Search.Do(ctx, req)
+		if err != nil {
+			return fmt.Errorf("search api: %w", err)
+		}
+		for _, res := range resp.Results {
+			page, ok := res.(*notionapi.Page)
+			if !ok {
+				continue
+			}
+			edited := page.LastEditedTime.UTC().Format(indexTimeFormat)
+			if !full && edited < watermark {
+				// the pages left were indexed by previous crawls
+				done = true
+				break
+			}
+			// pages in the trash are archived as well
+			if page.Archived {
+				continue
+			}
+			listed[page.ID.String()] = true
+			if fetched == maxIndexPages {
+				// the pages left are indexed by the next crawl, but still listed so that they are not removed
+				left = true
+				continue
+			}
+			indexed, complete, err := ix.indexPage(ctx, client, identity, page, edited)
+			if err != nil {
+				return err
+			}
+			if indexed {
+				fetched++
+				watermark = max(watermark, edited)
+			}
+			left = left || !complete
+		}
+		if !resp.HasMore {
+			break
+		}
+		req.StartCursor = resp.NextCursor
+	}
+	if full {
+		if err := ix.sweep(ctx, identity, listed); err != nil {
+			return err
+		}
+	}
+	if err := ix.setWatermark(ctx, identity, watermark); err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	switch {
+	case left:
+		delete(ix.swept, identity)
+	case full:
+		ix.swept[identity] = start
+	}
+	return nil
+}
+
+// indexPage fetches and stores the content of the page, unless it is indexed at the same last edited time.
+// Content fetched with warnings is incomplete and not stored, the page keeps its previous row until the next crawl.
+// It returns whether the page was fetched, and whether its content is complete.
+func (ix *contentIndex) indexPage(ctx context.Context, client *notionapi.Client, identity string, page *notionapi.Page, edited string) (bool, bool, error) {
+	var indexed string
+	err := ix.db.QueryRowContext(ctx, `SELECT last_edited FROM pages WHERE identity = ? AND id = ?`, identity, page.ID.String()).Scan(&indexed)
+	if err == nil && indexed == edited {
+		return false, true, nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, false, fmt.Errorf("get indexed page: %w", err)
+	}
+
+	fetchCtx, warnings := drutil.CollectWarnings(ctx)
+	f := &pageFetcher{client: client}
+	text, err := f.fetchPageContent(fetchCtx, notionapi.BlockID(page.ID))
+	if err != nil {
+		return false, false, fmt.Errorf("fetch page content %s: %w", page.ID, err)
+	}
+	if w := warnings(); len(w) > 0 {
+		slog.Warn("not indexing incomplete notion page", "identity", identity, "page", page.ID, "warnings", w)
+		return true, false, nil
+	}
+	doc := pageToDocument(ctx, page)
+	doc.Text = ""
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return false, false, fmt.Errorf("marshal document: %w", err)
+	}
+
+	tx, err := ix.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT OR REPLACE INTO pages (identity, id, last_edited, document) VALUES (?, ?, ?, ?)`, []any{identity, doc.ID, edited, string(document)}},
+		{`DELETE FROM content WHERE identity = ? AND id = ?`, []any{identity, doc.ID}},
+		{`INSERT INTO content (identity, id, title, text) VALUES (?, ?, ?, ?)`, []any{identity, doc.ID, doc.Title, text}},
+	} {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return false, false, fmt.Errorf("index page %s: %w", doc.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, false, fmt.Errorf("commit page %s: %w", doc.ID, err)
+	}
+	return true, true, nil
+}
+
+// sweep removes the indexed pages of the identity that were not listed by a complete crawl
+func (ix *contentIndex) sweep(ctx context.Context, identity string, listed map[string]bool) error {
+	rows, err := ix.db.QueryContext(ctx, `SELECT id FROM pages WHERE identity = ?`, identity)
+	if err != nil {
+		return fmt.Errorf("list indexed pages: %w", err)
+	}
+	var removed []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan indexed page: %w", err)
+		}
+		if !listed[id] {
+			removed = append(removed, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list indexed pages: %w", err)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	tx, err := ix.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, id := range removed {
+		for _, query := range []string{
+			`DELETE FROM pages WHERE identity = ? AND id = ?`,
+			`DELETE FROM content WHERE identity = ? AND id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, identity, id); err != nil {
+				return fmt.Errorf("remove page %s: %w", id, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit removed pages: %w", err)
+	}
+	return nil
+}
+
+func (ix *contentIndex) setWatermark(ctx context.Context, identity, watermark string) error {
+	_, err := ix.db.ExecContext(ctx, `INSERT OR REPLACE INTO crawls (identity, watermark) VALUES (?, ?)`, identity, watermark)
+	if err != nil {
+		return fmt.Errorf("set watermark: %w", err)
+	}
+	return nil
+}
+
+// search returns the indexed pages of the caller that match the query, ranked by relevance or sorted by edit time,
+// with a snippet of the matching text. It returns false if the index cannot answer the query, because the
+// pages of the caller are not indexed yet, the query has no words, or the cursor belongs to the Search API.
+func (ix *contentIndex) search(ctx context.Context, q *drutil.Query, opts drutil.SearchOptions) (*drutil.SearchResults, bool, error) {
+	identity, err := indexIdentity(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	ix.refresh(ctx, identity)
+
+	match := matchExpression(q)
+	if match == "" || (opts.Cursor != "" && !strings.HasPrefix(opts.Cursor, indexCursorPrefix)) {
+		return nil, false, nil
+	}
+	var watermark string
+	err = ix.db.QueryRowContext(ctx, `SELECT watermark FROM crawls WHERE identity = ?`, identity).Scan(&watermark)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get watermark: %w", err)
+	}
+
+	offset := 0
+	if opts.Cursor != "" {
+		if offset, err = strconv.Atoi(strings.TrimPrefix(opts.Cursor, indexCursorPrefix)); err != nil || offset < 0 {
+			return nil, false, fmt.Errorf("invalid cursor %q", opts.Cursor)
+		}
+	}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = defaultIndexResults
+	}
+
+	query := `SELECT pages.document, snippet(content, -1, '**', '**', '…', 24)
+		FROM content JOIN pages ON pages.identity = content.identity AND pages.id = content.id
+		WHERE content MATCH ? AND content.identity = ?`
+	args := []any{match, identity}
+	if !q.After.IsZero() {
+		query += ` AND pages.last_edited >= ?`
+		args = append(args, q.After.UTC().Format(indexTimeFormat))
+	}
+	if !q.Before.IsZero() {
+		query += ` AND pages.last_edited < ?`
+		args = append(args, q.Before.UTC().Format(indexTimeFormat))
+	}
+	switch opts.Sort {
+	case drutil.SortLastEditedDesc:
+		query += ` ORDER BY pages.last_edited DESC`
+	case drutil.SortLastEditedAsc:
+		query += ` ORDER BY pages.last_edited ASC`
+	default:
+		query += ` ORDER BY rank`
+	}
+	// one more row than the limit tells whether there is a next page
+	query += ` LIMIT ? OFFSET ?`
+	args = append(args, limit+1, offset)
+
+	rows, err := ix.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("search index: %w", err)
+	}
+	defer rows.Close()
+
+	results := &drutil.SearchResults{}
+	for rows.Next() {
+		var document, snippet string
+		if err := rows.Scan(&document, &snippet); err != nil {
+			return nil, false, fmt.Errorf("scan index result: %w", err)
+		}
+		if len(results.Results) == limit {
+			results.NextCursor = indexCursorPrefix + strconv.Itoa(offset+limit)
+			break
+		}
+		var doc drutil.Document
+		if err := json.Unmarshal([]byte(document), &doc); err != nil {
+			return nil, false, fmt.Errorf("unmarshal indexed document: %w", err)
+		}
+		doc.Text = snippet
+		results.Results = append(results.Results, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("search index: %w", err)
+	}
+	return results, true, nil
+}
+
+// matchExpression translates the words, phrases and title filters of the query to an FTS5 query
+func matchExpression(q *drutil.Query) string {
+	var parts []string
+	for _, term := range q.Terms {
+		parts = append(parts, quoteMatch(term))
+	}
+	for _, phrase := range q.Phrases {
+		parts = append(parts, quoteMatch(phrase))
+	}
+	for _, title := range q.Title {
+		parts = append(parts, "title : "+quoteMatch(title))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// quoteMatch quotes a string as an FTS5 phrase, so that its punctuation is not parsed as query syntax
+func quoteMatch(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// close stops starting crawls, waits for the running ones and closes the database
+func (ix *contentIndex) close() error {
+	ix.mu.Lock()
+	if ix.closed {
+		ix.mu.Unlock()
+		return nil
+	}
+	ix.closed = true
+	ix.mu.Unlock()
+	ix.wg.Wait()
+	return ix.db.Close()
+}
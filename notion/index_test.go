@@ -0,0 +1,210 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+// indexPage returns a page edited at the time
+func indexPage(id, title, edited string, archived bool) string {
+	return fmt.Sprintf(`{"object":"page","id":%q,"last_edited_time":%q,"url":"https://notion.so/%s","archived":%t,
+		"properties":{"title":{"type":"title","title":[{"type":"text","plain_text":%q}]}}}`, id, edited, id, archived, title)
+}
+
+// indexBlocks returns the blocks of a page, a paragraph with the text whose children cannot be fetched if partial
+func indexBlocks(id, text string, partial bool) string {
+	return fmt.Sprintf(`[{"object":"block","id":"b-%s","type":"paragraph","has_children":%t,
+		"paragraph":{"rich_text":[{"type":"text","plain_text":%q}]}}]`, id, partial, text)
+}
+
+// searchIndex searches the index and returns the IDs and text of the results, or nil if the index cannot answer
+func searchIndex(ctx context.Context, t *testing.T, ix *contentIndex, query string) []string {
+	t.Helper()
+	q, err := drutil.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("parse query: %v", err)
+	}
+	results, ok, err := ix.search(ctx, q, drutil.SearchOptions{})
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	if !ok {
+		return nil
+	}
+	found := []string{}
+	for _, doc := range results.Results {
+		found = append(found, doc.ID+": "+doc.Text)
+	}
+	return found
+}
+
+func TestContentIndex(t *testing.T) {
+	srv, n := newFixtureProvider(t, fixtures(map[string]string{
+		"pages/page-1.json":  indexPage("page-1", "Billing", "2025-03-02T10:00:00.000Z", false),
+		"blocks/page-1.json": indexBlocks("page-1", "We will run the Q3 migration of the billing database.", false),
+		"pages/page-2.json":  indexPage("page-2", "Offsite", "2025-03-01T10:00:00.000Z", false),
+		"blocks/page-2.json": indexBlocks("page-2", "Agenda of the team offsite.", false),
+		"pages/page-3.json":  indexPage("page-3", "Notes", "2025-03-01T10:00:00.000Z", false),
+		"blocks/page-3.json": indexBlocks("page-3", "Nothing about databases.", false),
+	}), nil)
+	srv.Share("alice", "page-1", "page-2")
+	srv.Share("bob", "page-3")
+	fetches := func(id string) int {
+		return countRequests(srv.Requests(), "GET /v1/blocks/"+id+"/children")
+	}
+
+	ix, err := newContentIndex(t.Context(), n, filepath.Join(t.TempDir(), "index.db"), 0)
+	if err != nil {
+		t.Fatalf("new content index: %v", err)
+	}
+	defer ix.close()
+	alice, bob := tokenContext("alice"), tokenContext("bob")
+
+	// the first search starts the crawl, and is answered by the Search API
+	if found := searchIndex(alice, t, ix, "migration"); found != nil {
+		t.Fatalf("expected the index not to be ready, got %v", found)
+	}
+	ix.wg.Wait()
+
+	found := searchIndex(alice, t, ix, "migrations billing")
+	if len(found) != 1 || found[0] != "page-1: We will run the Q3 **migration** of the **billing** database." {
+		t.Errorf("unexpected results %v", found)
+	}
+	if found := searchIndex(alice, t, ix, `"team offsite" title:offsite`); len(found) != 1 || !strings.HasPrefix(found[0], "page-2:") {
+		t.Errorf("unexpected results %v", found)
+	}
+
+	// pages of other users never match
+	searchIndex(bob, t, ix, "migration")
+	ix.wg.Wait()
+	if found := searchIndex(bob, t, ix, "migration"); len(found) != 0 {
+		t.Errorf("expected no results for another user, got %v", found)
+	}
+	if found := searchIndex(bob, t, ix, "databases"); len(found) != 1 || !strings.HasPrefix(found[0], "page-3:") {
+		t.Errorf("unexpected results %v", found)
+	}
+
+	// unchanged pages are not fetched again
+	identity, _ := indexIdentity(alice)
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if fetches("page-1") != 1 || fetches("page-2") != 1 {
+		t.Errorf("expected each page to be fetched once, got %d and %d", fetches("page-1"), fetches("page-2"))
+	}
+
+	srv.Set("pages/page-1.json", indexPage("page-1", "Billing", "2025-03-03T10:00:00.000Z", false))
+	srv.Set("blocks/page-1.json", indexBlocks("page-1", "The Q3 upgrade is done.", false))
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if fetches("page-1") != 2 || fetches("page-2") != 1 {
+		t.Errorf("expected only the edited page to be fetched again, got %d and %d", fetches("page-1"), fetches("page-2"))
+	}
+	if found := searchIndex(alice, t, ix, "migration"); len(found) != 0 {
+		t.Errorf("expected the previous content to be replaced, got %v", found)
+	}
+	if found := searchIndex(alice, t, ix, "upgrade"); len(found) != 1 {
+		t.Errorf("expected the new content to be indexed, got %v", found)
+	}
+
+	// incomplete content is not stored, and the previous one is kept
+	srv.Set("pages/page-1.json", indexPage("page-1", "Billing", "2025-03-04T10:00:00.000Z", false))
+	srv.Set("blocks/page-1.json", indexBlocks("page-1", "The Q3 rollback is done.", true))
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if found := searchIndex(alice, t, ix, "rollback"); len(found) != 0 {
+		t.Errorf("expected the incomplete content not to be indexed, got %v", found)
+	}
+	if found := searchIndex(alice, t, ix, "upgrade"); len(found) != 1 {
+		t.Errorf("expected the previous content to be kept, got %v", found)
+	}
+	// and the next crawl fetches it again
+	srv.Set("blocks/page-1.json", indexBlocks("page-1", "The Q3 rollback is done.", false))
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if found := searchIndex(alice, t, ix, "rollback"); len(found) != 1 {
+		t.Errorf("expected the complete content to be indexed, got %v", found)
+	}
+
+	// archived pages and pages no longer listed are kept by incremental crawls, that stop at the watermark
+	srv.Set("pages/page-2.json", indexPage("page-2", "Offsite", "2025-03-05T10:00:00.000Z", true))
+	srv.Delete("pages/page-1.json")
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if found := searchIndex(alice, t, ix, "offsite"); len(found) != 1 {
+		t.Errorf("expected an incremental crawl to keep the pages, got %v", found)
+	}
+	// and removed by the full crawls
+	ix.mu.Lock()
+	ix.swept[identity] = time.Now().Add(-indexSweepInterval)
+	ix.mu.Unlock()
+	if err := ix.crawl(alice, identity); err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	for _, query := range []string{"upgrade", "offsite"} {
+		if found := searchIndex(alice, t, ix, query); len(found) != 0 {
+			t.Errorf("expected %q to match no removed page, got %v", query, found)
+		}
+	}
+	if found := searchIndex(bob, t, ix, "databases"); len(found) != 1 {
+		t.Errorf("expected the pages of other users to be kept, got %v", found)
+	}
+}
+
+func TestContentIndexClose(t *testing.T) {
+	_, n := newFixtureProvider(t, fixtures(nil), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	ix, err := newContentIndex(ctx, n, filepath.Join(t.TempDir(), "index.db"), 0)
+	if err != nil {
+		t.Fatalf("new content index: %v", err)
+	}
+
+	// the index is closed with the server
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for ix.db.Ping() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ix.db.Ping(); err == nil {
+		t.Fatal("expected the database to be closed")
+	}
+	ix.refresh(testContext(), "token:test")
+	if len(ix.running) != 0 {
+		t.Errorf("expected no crawl to start once closed, got %v", ix.running)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	q, err := drutil.ParseQuery(`q3 "data migration" title:plan AND-OR`)
+	if err != nil {
+		t.Fatalf("parse query: %v", err)
+	}
+	expected := `"q3" AND "AND-OR" AND "data migration" AND title : "plan"`
+	if got := matchExpression(q); got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+	if got, expected := quoteMatch(`say "hi"`), `"say ""hi"""`; got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+// countRequests returns the number of requests, such as "GET /v1/pages/<id>"
+func countRequests(requests []string, request string) int {
+	n := 0
+	for _, r := range requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,641 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	// tocPlaceholder marks a table_of_contents block, replaced by the outline of the page once it is rendered
+	tocPlaceholder = "\x00table_of_contents\x00"
+	// maxBreadcrumbDepth is the maximum number of parents of a breadcrumb block
+	maxBreadcrumbDepth = 10
+)
+
+// pageFetcher fetches the content blocks of a single page and renders them as Markdown
+type pageFetcher struct {
+	client *notionapi.Client
+	// mu guards blocks and prefetched, that are updated by concurrent fetches
+	mu sync.Mutex
+	// blocks is the number of blocks fetched so far
+	blocks int
+	// progressMu is held while reporting progress, reported is the number of blocks last reported
+	progressMu sync.Mutex
+	reported   int
+	// prefetched holds the children fetched ahead of rendering, by parent block ID
+	prefetched map[notionapi.BlockID]prefetchedChildren
+	// concurrency is the maximum number of concurrent prefetches, defaults to maxConcurrentFetches
+	concurrency int
+	// root is the page being fetched
+	root notionapi.BlockID
+	// links caches the titles and URLs of the linked pages and databases
+	links map[string]link
+	// users caches the names of the users by ID
+	users map[string]string
+	// comments enables recording the rendered blocks, to fetch their comments
+	comments       bool
+	commentTargets []commentTarget
+	// commentsCapped is set when blocks were left out of commentTargets, as it holds maxCommentedBlocks
+	commentsCapped bool
+	// depth is the number of levels of child pages to inline, level the level of the page being fetched
+	depth, level int
+	// subtree is shared by the fetchers of the pages inlined in the same fetch
+	subtree *subtree
+}
+
+// link is the title and URL of a page or database
+type link struct {
+	title, url string
+}
+
+// fetchPageContent recursively fetches all blocks of the page and renders them as Markdown
+func (f *pageFetcher) fetchPageContent(ctx context.Context, pageID notionapi.BlockID) (string, error) {
+	f.root = pageID
+	blocks, err := f.fetchChildren(ctx, pageID)
+	if err != nil {
+		return "", err
+	}
+	// the nested blocks are fetched concurrently up front, then rendered in order
+	f.prefetch(ctx, blocks)
+	content := f.renderBlocks(ctx, blocks)
+
+	// nested blocks may have been cut short by cancellation, don't return partial content
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return resolveTableOfContents(content), nil
+}
+
+// fetchChildren fetches all the children blocks of a block, following pagination
+func (f *pageFetcher) fetchChildren(ctx context.Context, blockID notionapi.BlockID) ([]notionapi.Block, error) {
+	if children, ok := f.takePrefetched(blockID); ok {
+		return children.blocks, children.err
+	}
+
+	var blocks []notionapi.Block
+	cursor := ""
+	hasMore := true
+
+	for hasMore {
+		// stop walking the tree as soon as the request is cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		pagination := &notionapi.Pagination{}
+		if cursor != "" {
+			pagination.StartCursor = notionapi.Cursor(cursor)
+		}
+
+		response, err := f.client.Block.GetChildren(ctx, blockID, pagination)
+		if err != nil {
+			return nil, fmt.Errorf("get block children: %w", err)
+		}
+		f.mu.Lock()
+		f.blocks += len(response.Results)
+		f.mu.Unlock()
+		f.reportProgress(ctx)
+
+		blocks = append(blocks, response.Results...)
+		hasMore = response.HasMore
+		cursor = response.NextCursor
+	}
+	return blocks, nil
+}
+
+// reportProgress reports the number of blocks fetched so far, unless another fetch is reporting it. A slow client
+// then delays no fetch, and the progress still increases as the next report carries the new blocks.
+func (f *pageFetcher) reportProgress(ctx context.Context) {
+	if !f.progressMu.TryLock() {
+		return
+	}
+	defer f.progressMu.Unlock()
+	f.mu.Lock()
+	blocks := f.blocks
+	f.mu.Unlock()
+	if blocks > f.reported {
+		f.reported = blocks
+		mcputil.ReportProgress(ctx, float64(blocks), 0, fmt.Sprintf("fetched %d blocks", blocks))
+	}
+}
+
+// renderChildren fetches and renders the children blocks of a block
+func (f *pageFetcher) renderChildren(ctx context.Context, blockID notionapi.BlockID) (string, error) {
+	blocks, err := f.fetchChildren(ctx, blockID)
+	if err != nil {
+		return "", err
+	}
+	return f.renderBlocks(ctx, blocks), nil
+}
+
+// renderBlocks renders sibling blocks, numbering consecutive numbered list items and separating
+// the blocks other than list items of the same list by blank lines
+func (f *pageFetcher) renderBlocks(ctx context.Context, blocks []notionapi.Block) string {
+	var b strings.Builder
+	var previous notionapi.Block
+	var number int
+	for _, block := range blocks {
+		if _, ok := block.(*notionapi.NumberedListItemBlock); ok {
+			number++
+		} else {
+			number = 0
+		}
+		text := f.renderBlock(ctx, block, number)
+		if text == "" {
+			continue
+		}
+		f.addCommentTarget(block, text)
+		if b.Len() > 0 {
+			if kind := listKind(block); kind != "" && kind == listKind(previous) {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(text)
+		previous = block
+	}
+	return b.String()
+}
+
+// listKind returns the kind of list of list item blocks, items of the same kind are rendered as a single list
+func listKind(block notionapi.Block) string {
+	switch block.(type) {
+	case *notionapi.BulletedListItemBlock, *notionapi.ToDoBlock:
+		return "bulleted"
+	case *notionapi.NumberedListItemBlock:
+		return "numbered"
+	}
+	return ""
+}
+
+// renderBlock renders a block and its children, number is the position of numbered list items in their list
+func (f *pageFetcher) renderBlock(ctx context.Context, block notionapi.Block, number int) string {
+	switch b := block.(type) {
+	case *notionapi.ParagraphBlock:
+		return joinBlocks(f.richText(ctx, b.Paragraph.RichText), f.children(ctx, block))
+
+	case *notionapi.Heading1Block:
+		return joinBlocks("# "+f.richText(ctx, b.Heading1.RichText), f.children(ctx, block))
+
+	case *notionapi.Heading2Block:
+		return joinBlocks("## "+f.richText(ctx, b.Heading2.RichText), f.children(ctx, block))
+
+	case *notionapi.Heading3Block:
+		return joinBlocks("### "+f.richText(ctx, b.Heading3.RichText), f.children(ctx, block))
+
+	case *notionapi.BulletedListItemBlock:
+		return listItem("- ", f.richText(ctx, b.BulletedListItem.RichText), f.children(ctx, block))
+
+	case *notionapi.NumberedListItemBlock:
+		return listItem(fmt.Sprintf("%d. ", max(number, 1)), f.richText(ctx, b.NumberedListItem.RichText), f.children(ctx, block))
+
+	case *notionapi.ToDoBlock:
+		checkbox := "- [ ] "
+		if b.ToDo.Checked {
+			checkbox = "- [x] "
+		}
+		return listItem(checkbox, f.richText(ctx, b.ToDo.RichText), f.children(ctx, block))
+
+	case *notionapi.ToggleBlock:
+		return "<details>\n<summary>" + f.richText(ctx, b.Toggle.RichText) + "</summary>\n\n" +
+			joinBlocks(f.children(ctx, block), "</details>")
+
+	case *notionapi.CalloutBlock:
+		text := f.richText(ctx, b.Callout.RichText)
+		if b.Callout.Icon != nil && b.Callout.Icon.Emoji != nil {
+			text = string(*b.Callout.Icon.Emoji) + " " + text
+		}
+		return quoteText(joinBlocks(text, f.children(ctx, block)))
+
+	case *notionapi.QuoteBlock:
+		return quoteText(joinBlocks(f.richText(ctx, b.Quote.RichText), f.children(ctx, block)))
+
+	case *notionapi.CodeBlock:
+		language := b.Code.Language
+		if language == "plain text" {
+			language = ""
+		}
+		return "```" + language + "\n" + extractRichText(b.Code.RichText) + "\n```"
+
+	case *notionapi.EquationBlock:
+		return "$$\n" + b.Equation.Expression + "\n$$"
+
+	case *notionapi.DividerBlock:
+		return "---"
+
+	case *notionapi.TableBlock:
+		return f.renderTable(ctx, b)
+
+	case *notionapi.TableRowBlock:
+		return f.tableRow(ctx, b.TableRow.Cells, len(b.TableRow.Cells))
+
+	case *notionapi.ChildPageBlock:
+		if text, ok := f.inlineChildPage(ctx, b); ok {
+			return text
+		}
+		return "📄 " + markdownLink(escapeMarkdown(b.ChildPage.Title), notionURL(b.ID.String()))
+
+	case *notionapi.ChildDatabaseBlock:
+		return "🗃 " + markdownLink(escapeMarkdown(b.ChildDatabase.Title), notionURL(b.ID.String()))
+
+	case *notionapi.LinkToPageBlock:
+		var l link
+		switch b.LinkToPage.Type {
+		case notionapi.BlockType(notionapi.ParentTypeDatabaseID):
+			l = f.resolve(ctx, notionapi.ObjectTypeDatabase, b.LinkToPage.DatabaseID.String())
+		default:
+			l = f.resolve(ctx, notionapi.ObjectTypePage, b.LinkToPage.PageID.String())
+		}
+		return "↗ " + markdownLink(escapeMarkdown(l.title), l.url)
+
+	case *notionapi.SyncedBlock:
+		// duplicates of a synced block hold no content, their children are those of the original block
+		if from := b.SyncedBlock.SyncedFrom; from != nil {
+			content, err := f.renderChildren(ctx, from.BlockID)
+			if err != nil {
+				f.partial(ctx, "synced content", from.BlockID, err)
+			}
+			return content
+		}
+		return f.children(ctx, block)
+
+	case *notionapi.ColumnListBlock, *notionapi.ColumnBlock:
+		// Markdown has no columns, so they are rendered one after the other
+		return f.children(ctx, block)
+
+	case *notionapi.BreadcrumbBlock:
+		return f.breadcrumb(ctx)
+
+	case *notionapi.TableOfContentsBlock:
+		return tocPlaceholder
+
+	case *notionapi.BookmarkBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.Bookmark.Caption), b.Bookmark.URL), b.Bookmark.URL)
+
+	case *notionapi.EmbedBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.Embed.Caption), b.Embed.URL), b.Embed.URL)
+
+	case *notionapi.LinkPreviewBlock:
+		return markdownLink(b.LinkPreview.URL, b.LinkPreview.URL)
+
+	case *notionapi.ImageBlock:
+		return "!" + markdownLink(f.richText(ctx, b.Image.Caption), fileURL(b.Image.File, b.Image.External))
+
+	case *notionapi.VideoBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.Video.Caption), "Video"), fileURL(b.Video.File, b.Video.External))
+
+	case *notionapi.AudioBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.Audio.Caption), "Audio"), fileURL(b.Audio.File, b.Audio.External))
+
+	case *notionapi.FileBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.File.Caption), "File"), fileURL(b.File.File, b.File.External))
+
+	case *notionapi.PdfBlock:
+		return markdownLink(captionOr(f.richText(ctx, b.Pdf.Caption), "PDF"), fileURL(b.Pdf.File, b.Pdf.External))
+	}
+
+	// blocks without text, such as templates, may still have children
+	return f.children(ctx, block)
+}
+
+// children renders the children of the block, they are left out with a warning if they cannot be fetched
+func (f *pageFetcher) children(ctx context.Context, block notionapi.Block) string {
+	if !block.GetHasChildren() {
+		return ""
+	}
+	content, err := f.renderChildren(ctx, block.GetID())
+	if err != nil {
+		f.partial(ctx, "child blocks", block.GetID(), err)
+		return ""
+	}
+	return content
+}
+
+// partial reports content of a block left out of the page as it could not be fetched, unless the whole
+// fetch was cancelled
+func (f *pageFetcher) partial(ctx context.Context, content string, id notionapi.BlockID, err error) {
+	mcputil.Logger(ctx).Warn("failed to fetch "+content, "block_id", id, "error", err)
+	if ctx.Err() == nil {
+		drutil.Warn(ctx, fmt.Sprintf("the page is incomplete, the %s of block %s could not be fetched: %v", content, id, err))
+	}
+}
+
+// renderTable renders a table as a GFM table. Tables without a header row get an empty one,
+// as GFM requires it.
+func (f *pageFetcher) renderTable(ctx context.Context, table *notionapi.TableBlock) string {
+	blocks, err := f.fetchChildren(ctx, table.GetID())
+	if err != nil {
+		f.partial(ctx, "table rows", table.GetID(), err)
+		return ""
+	}
+	var rows [][][]notionapi.RichText
+	width := table.Table.TableWidth
+	for _, block := range blocks {
+		if row, ok := block.(*notionapi.TableRowBlock); ok {
+			cells := row.TableRow.Cells
+			if table.Table.HasRowHeader && len(cells) > 0 && len(cells[0]) > 0 {
+				cells = append([][]notionapi.RichText{boldRichText(cells[0])}, cells[1:]...)
+			}
+			rows = append(rows, cells)
+			width = max(width, len(cells))
+		}
+	}
+	if width == 0 {
+		return ""
+	}
+
+	var lines []string
+	if table.Table.HasColumnHeader && len(rows) > 0 {
+		lines = append(lines, f.tableRow(ctx, rows[0], width))
+		rows = rows[1:]
+	} else {
+		lines = append(lines, f.tableRow(ctx, nil, width))
+	}
+	lines = append(lines, "|"+strings.Repeat(" --- |", width))
+	for _, row := range rows {
+		lines = append(lines, f.tableRow(ctx, row, width))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f *pageFetcher) tableRow(ctx context.Context, cells [][]notionapi.RichText, width int) string {
+	var b strings.Builder
+	b.WriteString("|")
+	for i := range width {
+		var cell string
+		if i < len(cells) {
+			cell = tableCell(f.richText(ctx, cells[i]))
+		}
+		b.WriteString(" " + cell + " |")
+	}
+	return b.String()
+}
+
+// boldRichText returns a copy of the rich text in bold
+func boldRichText(text []notionapi.RichText) []notionapi.RichText {
+	bold := make([]notionapi.RichText, len(text))
+	for i, t := range text {
+		var annotations notionapi.Annotations
+		if t.Annotations != nil {
+			annotations = *t.Annotations
+		}
+		annotations.Bold = true
+		t.Annotations = &annotations
+		bold[i] = t
+	}
+	return bold
+}
+
+// breadcrumb renders the path from the top level page to the page being fetched
+func (f *pageFetcher) breadcrumb(ctx context.Context) string {
+	var path []string
+	parent := notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: notionapi.PageID(f.root)}
+	for range maxBreadcrumbDepth {
+		var l link
+		switch parent.Type {
+		case notionapi.ParentTypePageID:
+			page, err := f.client.Page.Get(ctx, parent.PageID)
+			if err != nil {
+				break
+			}
+			l = link{title: getTitleText(ctx, page), url: page.URL}
+			parent = page.Parent
+		case notionapi.ParentTypeDatabaseID:
+			db, err := f.client.Database.Get(ctx, parent.DatabaseID)
+			if err != nil {
+				break
+			}
+			l = link{title: richTextToPlain(db.Title), url: db.URL}
+			parent = db.Parent
+		}
+		if l.url == "" {
+			// the workspace, a block or a parent that cannot be read ends the path
+			break
+		}
+		path = append([]string{markdownLink(escapeMarkdown(l.title), l.url)}, path...)
+	}
+	return strings.Join(path, " / ")
+}
+
+// resolve returns the title and URL of a page or database, or its ID and URL if it cannot be read
+func (f *pageFetcher) resolve(ctx context.Context, object notionapi.ObjectType, id string) link {
+	if l, ok := f.links[id]; ok {
+		return l
+	}
+	l := link{title: id, url: notionURL(id)}
+	switch object {
+	case notionapi.ObjectTypeDatabase:
+		if db, err := f.client.Database.Get(ctx, notionapi.DatabaseID(id)); err == nil {
+			l = link{title: richTextToPlain(db.Title), url: db.URL}
+		}
+	default:
+		if page, err := f.client.Page.Get(ctx, notionapi.PageID(id)); err == nil {
+			l = link{title: getTitleText(ctx, page), url: page.URL}
+		}
+	}
+	if f.links == nil {
+		f.links = make(map[string]link)
+	}
+	f.links[id] = l
+	return l
+}
+
+// richText renders rich text as Markdown, with its annotations, links, equations and mentions
+func (f *pageFetcher) richText(ctx context.Context, text []notionapi.RichText) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		// runs of text with the same style are rendered together, so that their markers do not repeat
+		j := i + 1
+		for j < len(text) && sameStyle(&text[i], &text[j]) {
+			j++
+		}
+		b.WriteString(f.styledText(ctx, text[i:j]))
+		i = j
+	}
+	return b.String()
+}
+
+// styledText renders a run of rich text that shares the same annotations and link
+func (f *pageFetcher) styledText(ctx context.Context, run []notionapi.RichText) string {
+	var annotations notionapi.Annotations
+	if run[0].Annotations != nil {
+		annotations = *run[0].Annotations
+	}
+	var content strings.Builder
+	for _, t := range run {
+		switch {
+		case t.Equation != nil:
+			content.WriteString("$" + t.Equation.Expression + "$")
+		case t.Mention != nil:
+			content.WriteString(escapeMarkdown(f.mentionText(ctx, &t)))
+		case annotations.Code:
+			content.WriteString(t.PlainText)
+		default:
+			content.WriteString(escapeMarkdown(t.PlainText))
+		}
+	}
+
+	// markers must be next to the text, so surrounding spaces are moved out of them
+	text := content.String()
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	leading, trailing := text[:strings.Index(text, trimmed)], text[strings.Index(text, trimmed)+len(trimmed):]
+	if annotations.Code {
+		trimmed = codeSpan(trimmed)
+	}
+	if annotations.Strikethrough {
+		trimmed = "~~" + trimmed + "~~"
+	}
+	if annotations.Italic {
+		trimmed = "*" + trimmed + "*"
+	}
+	if annotations.Bold {
+		trimmed = "**" + trimmed + "**"
+	}
+	if href := run[0].Href; href != "" {
+		trimmed = markdownLink(trimmed, href)
+	}
+	return leading + trimmed + trailing
+}
+
+// mentionText returns the text of a mention, resolving the pages and databases whose title is not readable
+func (f *pageFetcher) mentionText(ctx context.Context, t *notionapi.RichText) string {
+	m := t.Mention
+	switch {
+	case m.User != nil && m.User.Name != "":
+		return "@" + m.User.Name
+	case t.PlainText != "" && t.PlainText != "Untitled":
+		return t.PlainText
+	case m.Page != nil:
+		return f.resolve(ctx, notionapi.ObjectTypePage, m.Page.ID.String()).title
+	case m.Database != nil:
+		return f.resolve(ctx, notionapi.ObjectTypeDatabase, m.Database.ID.String()).title
+	}
+	return t.PlainText
+}
+
+func sameStyle(a, b *notionapi.RichText) bool {
+	var x, y notionapi.Annotations
+	if a.Annotations != nil {
+		x = *a.Annotations
+	}
+	if b.Annotations != nil {
+		y = *b.Annotations
+	}
+	return a.Href == b.Href && x.Bold == y.Bold && x.Italic == y.Italic &&
+		x.Strikethrough == y.Strikethrough && x.Code == y.Code
+}
+
+// codeSpan wraps text in backticks, using a double backtick if it contains one
+func codeSpan(text string) string {
+	if strings.Contains(text, "`") {
+		return "`` " + text + " ``"
+	}
+	return "`" + text + "`"
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+// escapeMarkdown escapes the characters of plain text that would be read as Markdown emphasis, code or links
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+func markdownLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return "[" + text + "](" + strings.ReplaceAll(url, " ", "%20") + ")"
+}
+
+// notionURL returns the URL of a page or database from its ID
+func notionURL(id string) string {
+	return "https://www.notion.so/" + strings.ReplaceAll(id, "-", "")
+}
+
+func fileURL(file, external *notionapi.FileObject) string {
+	if file != nil {
+		return file.URL
+	}
+	if external != nil {
+		return external.URL
+	}
+	return ""
+}
+
+func captionOr(caption, fallback string) string {
+	if caption != "" {
+		return caption
+	}
+	return fallback
+}
+
+// joinBlocks joins the non-empty Markdown blocks with blank lines
+func joinBlocks(blocks ...string) string {
+	var nonEmpty []string
+	for _, b := range blocks {
+		if b != "" {
+			nonEmpty = append(nonEmpty, b)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
+// listItem renders a list item, with its children indented to the text after the marker
+func listItem(marker, text, children string) string {
+	if children == "" {
+		return marker + text
+	}
+	return marker + text + "\n" + indentLines(children, strings.Repeat(" ", len(marker)))
+}
+
+// quoteText prefixes the lines of the text as a block quote
+func quoteText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentLines prefixes the non-empty lines of the text
+func indentLines(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveTableOfContents replaces the table_of_contents blocks by the outline of the page
+func resolveTableOfContents(content string) string {
+	if !strings.Contains(content, tocPlaceholder) {
+		return content
+	}
+	sections := drutil.Outline(content)
+	top := 6
+	for _, s := range sections {
+		top = min(top, s.Level)
+	}
+	var toc []string
+	for _, s := range sections {
+		toc = append(toc, strings.Repeat("  ", s.Level-top)+"- "+markdownLink(s.Heading, "#"+s.Anchor))
+	}
+	return strings.ReplaceAll(content, tocPlaceholder, strings.Join(toc, "\n"))
+}
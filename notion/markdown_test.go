@@ -0,0 +1,78 @@
+package notion
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// markdownFixture holds the Notion objects of a golden test, by ID
+type markdownFixture struct {
+	Children  map[string][]json.RawMessage `json:"children"`
+	Pages     map[string]json.RawMessage   `json:"pages"`
+	Databases map[string]json.RawMessage   `json:"databases"`
+}
+
+// files returns the fixtures of the stand-in API with the objects
+func (f *markdownFixture) files() fstest.MapFS {
+	fsys := make(fstest.MapFS)
+	for id, children := range f.Children {
+		data, _ := json.Marshal(children)
+		fsys["blocks/"+id+".json"] = &fstest.MapFile{Data: data}
+	}
+	for id, page := range f.Pages {
+		fsys["pages/"+id+".json"] = &fstest.MapFile{Data: page}
+	}
+	for id, database := range f.Databases {
+		fsys["databases/"+id+".json"] = &fstest.MapFile{Data: database}
+	}
+	return fsys
+}
+
+// TestMarkdownGolden renders the blocks of testdata/markdown/*.json, whose page is root,
+// and compares them to the .md files. Run with -update to rewrite them.
+func TestMarkdownGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "markdown", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden files: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fixture markdownFixture
+			if err := json.Unmarshal(data, &fixture); err != nil {
+				t.Fatalf("parse %s: %v", file, err)
+			}
+			_, client := newFixtureClient(t, fixture.files())
+			f := &pageFetcher{client: client}
+			got, err := f.fetchPageContent(testContext(), "root")
+			if err != nil {
+				t.Fatalf("fetch page content: %v", err)
+			}
+
+			golden := strings.TrimSuffix(file, ".json") + ".md"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got+"\n" != string(expected) {
+				t.Errorf("%s does not match, got:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// Package notiontest provides a stand-in for the Notion API, serving a workspace from JSON fixtures,
+// to test the Notion provider end to end
+package notiontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token is the bearer token the server accepts
+const Token = "notiontest-token"
+
+// defaultPageSize is the page size of the lists when the request does not set one, as in the Notion API
+const defaultPageSize = 100
+
+// Server is a stand-in for the Notion API. It serves the objects of a workspace loaded from fixtures:
+//
+//   - pages/<id>.json and databases/<id>.json: page and database objects, returned by ID, by search,
+//     and for pages whose parent is a database, by the database query
+//   - blocks/<id>.json: the array of children blocks of a page or block
+//   - users/<id>.json: user objects
+//   - comments/<id>.json: the array of comments on a page or block
+//
+// Search matches titles, and sorts by last edited time if asked. The database query ignores filters and sorts.
+// Pages can be created and updated, blocks appended and comments added, the workspace keeps the changes.
+// Tests can also edit it with Set and Delete, and inspect the requests with Requests and Bodies.
+// IDs are matched without dashes and case insensitively. Requests without the bearer Token, or another token
+// given access with Share, get a 401 error, unknown objects a 404 error, and Fail injects errors such as 429.
+type Server struct {
+	*httptest.Server
+	// PageSize is the maximum number of results of list responses, to test pagination.
+	// It defaults to the page size of the request.
+	PageSize int
+	// Latency delays every response, to test concurrent and cancelled requests
+	Latency time.Duration
+
+	tb testing.TB
+
+	mu      sync.Mutex
+	objects map[string]map[string]json.RawMessage
+	// order holds the IDs of the pages and databases in fixture order, the order of search results
+	order []searchObject
+	// shared holds the IDs of the pages and databases each token other than Token can see
+	shared   map[string]map[string]bool
+	requests []string
+	bodies   []json.RawMessage
+	failures []failure
+	// created counts the created objects, to give them IDs
+	created int
+}
+
+type searchObject struct {
+	kind, id string
+}
+
+type failure struct {
+	path   string
+	status int
+	times  int
+}
+
+// NewServer starts a server with the fixtures, that is closed at the end of the test
+func NewServer(t testing.TB, fixtures fs.FS) *Server {
+	t.Helper()
+	s := &Server{
+		tb:      t,
+		objects: make(map[string]map[string]json.RawMessage),
+		shared:  make(map[string]map[string]bool),
+	}
+	for _, kind := range kinds {
+		s.objects[kind] = make(map[string]json.RawMessage)
+		files, err := fs.Glob(fixtures, kind+"/*.json")
+		if err != nil {
+			t.Fatalf("list %s fixtures: %v", kind, err)
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fixtures, file)
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			s.set(file, data)
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// kinds are the directories of the fixtures
+var kinds = []string{"pages", "databases", "blocks", "users", "comments"}
+
+// Set adds or replaces the object of a fixture file, such as pages/<id>.json, as if it was edited in the workspace
+func (s *Server) Set(file, data string) {
+	s.tb.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(file, []byte(data))
+}
+
+// Delete removes the object of a fixture file, such as pages/<id>.json, as if it was deleted from the workspace
+func (s *Server) Delete(file string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kind, id := fixtureKey(file)
+	delete(s.objects[kind], id)
+	s.order = slices.DeleteFunc(s.order, func(o searchObject) bool { return o == searchObject{kind: kind, id: id} })
+}
+
+func (s *Server) set(file string, data []byte) {
+	kind, id := fixtureKey(file)
+	if _, ok := s.objects[kind]; !ok {
+		s.tb.Fatalf("fixture %s is not in a directory of %v", file, kinds)
+	}
+	if !json.Valid(data) {
+		s.tb.Fatalf("fixture %s is not valid JSON", file)
+	}
+	_, exists := s.objects[kind][id]
+	s.objects[kind][id] = data
+	if !exists && (kind == "pages" || kind == "databases") {
+		s.order = append(s.order, searchObject{kind: kind, id: id})
+	}
+}
+
+// fixtureKey returns the kind and normalized ID of the object of a fixture file
+func fixtureKey(file string) (kind, id string) {
+	return path.Dir(file), normalizeID(strings.TrimSuffix(path.Base(file), ".json"))
+}
+
+// Share gives another token access to the pages and databases with the IDs, as sharing them with another
+// integration. Tokens other than Token only get and find the pages and databases shared with them.
+func (s *Server) Share(token string, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared[token] == nil {
+		s.shared[token] = make(map[string]bool)
+	}
+	for _, id := range ids {
+		s.shared[token][normalizeID(id)] = true
+	}
+}
+
+// Fail makes the next requests to the path, such as /v1/pages/<id>, or to any path if empty, fail with the status.
+// Rate limited responses ask to retry after 0 seconds.
+func (s *Server) Fail(path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{path: path, status: status, times: times})
+}
+
+// Requests returns the method and path of the requests received so far, such as "GET /v1/pages/<id>"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Bodies returns the bodies of the requests received so far with the method and path, such as
+// "POST /v1/databases/<id>/query"
+func (s *Server) Bodies(request string) []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var bodies []json.RawMessage
+	for i, r := range s.requests {
+		if r == request {
+			bodies = append(bodies, s.bodies[i])
+		}
+	}
+	return bodies
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Latency > 0 {
+		select {
+		case <-time.After(s.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.bodies = append(s.bodies, body)
+
+	w.Header().Set("Content-Type", "application/json")
+	// authentication comes first, so that failures are only spent on the requests that would reach the API
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token != Token && s.shared[token] == nil {
+		writeError(w, http.StatusUnauthorized, "API token is invalid.")
+		return
+	}
+	for i := range s.failures {
+		if f := &s.failures[i]; f.times > 0 && (f.path == "" || f.path == r.URL.Path) {
+			f.times--
+			if f.status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			writeError(w, f.status, http.StatusText(f.status))
+			return
+		}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/search":
+		s.search(w, r, token)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/comments":
+		s.list(w, r, s.objects["comments"][normalizeID(r.URL.Query().Get("block_id"))])
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/comments":
+		s.createComment(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/pages":
+		s.createPage(w, r, token)
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "pages":
+		s.object(w, token, "pages", parts[1])
+	case r.Method == http.MethodPatch && len(parts) == 2 && parts[0] == "pages":
+		s.updatePage(w, r, token, parts[1])
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "databases":
+		s.object(w, token, "databases", parts[1])
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "users":
+		s.object(w, token, "users", parts[1])
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "blocks" && parts[2] == "children":
+		if children, ok := s.objects["blocks"][normalizeID(parts[1])]; ok {
+			s.list(w, r, children)
+		} else if _, ok := s.objects["pages"][normalizeID(parts[1])]; ok {
+			s.list(w, r, nil)
+		} else {
+			writeError(w, http.StatusNotFound, "Could not find block with ID: "+parts[1])
+		}
+	case r.Method == http.MethodPatch && len(parts) == 3 && parts[0] == "blocks" && parts[2] == "children":
+		s.appendBlocks(w, r, parts[1])
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "databases" && parts[2] == "query":
+		s.query(w, r, token, parts[1])
+	default:
+		writeError(w, http.StatusBadRequest, "notiontest does not support "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// visible returns whether the token can see the object
+func (s *Server) visible(token, kind, id string) bool {
+	if token == Token || (kind != "pages" && kind != "databases") {
+		return true
+	}
+	return s.shared[token][normalizeID(id)]
+}
+
+func (s *Server) object(w http.ResponseWriter, token, kind, id string) {
+	data, ok := s.objects[kind][normalizeID(id)]
+	if !ok || !s.visible(token, kind, id) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not find %s with ID: %s", strings.TrimSuffix(kind, "s"), id))
+		return
+	}
+	w.Write(data)
+}
+
+// list writes a page of the array of results, after the start_cursor of the request
+func (s *Server) list(w http.ResponseWriter, r *http.Request, results json.RawMessage) {
+	var items []json.RawMessage
+	if results != nil {
+		if err := json.Unmarshal(results, &items); err != nil {
+			writeError(w, http.StatusInternalServerError, "invalid fixture: "+err.Error())
+			return
+		}
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	s.writeList(w, items, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+// search returns the pages and databases whose title contains the query, of the type of the filter if any
+func (s *Server) search(w http.ResponseWriter, r *http.Request, token string) {
+	var req struct {
+		Query  string `json:"query"`
+		Filter struct {
+			Value string `json:"value"`
+		} `json:"filter"`
+		Sort struct {
+			Timestamp string `json:"timestamp"`
+			Direction string `json:"direction"`
+		} `json:"sort"`
+		StartCursor string `json:"start_cursor"`
+		PageSize    int    `json:"page_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var results []json.RawMessage
+	for _, o := range s.order {
+		if (req.Filter.Value != "" && req.Filter.Value+"s" != o.kind) || !s.visible(token, o.kind, o.id) {
+			continue
+		}
+		data := s.objects[o.kind][o.id]
+		if strings.Contains(strings.ToLower(title(data)), strings.ToLower(req.Query)) {
+			results = append(results, data)
+		}
+	}
+	if req.Sort.Timestamp == "last_edited_time" {
+		slices.SortStableFunc(results, func(a, b json.RawMessage) int {
+			if req.Sort.Direction == "descending" {
+				a, b = b, a
+			}
+			return strings.Compare(lastEditedTime(a), lastEditedTime(b))
+		})
+	}
+	s.writeList(w, results, req.StartCursor, req.PageSize)
+}
+
+// query returns the pages whose parent is the database
+func (s *Server) query(w http.ResponseWriter, r *http.Request, token, id string) {
+	if _, ok := s.objects["databases"][normalizeID(id)]; !ok || !s.visible(token, "databases", id) {
+		writeError(w, http.StatusNotFound, "Could not find database with ID: "+id)
+		return
+	}
+	var req struct {
+		StartCursor string `json:"start_cursor"`
+		PageSize    int    `json:"page_size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var rows []json.RawMessage
+	for _, o := range s.order {
+		if o.kind != "pages" || !s.visible(token, o.kind, o.id) {
+			continue
+		}
+		var page struct {
+			Parent struct {
+				DatabaseID string `json:"database_id"`
+			} `json:"parent"`
+		}
+		data := s.objects["pages"][o.id]
+		if json.Unmarshal(data, &page) == nil && normalizeID(page.Parent.DatabaseID) == normalizeID(id) {
+			rows = append(rows, data)
+		}
+	}
+	s.writeList(w, rows, req.StartCursor, req.PageSize)
+}
+
+// writeList writes the results from the cursor, that is their offset, up to the page size
+func (s *Server) writeList(w http.ResponseWriter, results []json.RawMessage, cursor string, pageSize int) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if s.PageSize > 0 {
+		pageSize = min(pageSize, s.PageSize)
+	}
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > len(results) {
+			writeError(w, http.StatusBadRequest, "invalid start_cursor")
+			return
+		}
+	}
+	end := min(start+pageSize, len(results))
+	resp := map[string]any{
+		"object":   "list",
+		"results":  append([]json.RawMessage{}, results[start:end]...),
+		"has_more": end < len(results),
+	}
+	if end < len(results) {
+		resp["next_cursor"] = strconv.Itoa(end)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// title returns the plain text title of a page or database object
+func title(data json.RawMessage) string {
+	var object struct {
+		Title []struct {
+			PlainText string `json:"plain_text"`
+		} `json:"title"`
+		// the title property of a database schema is an object, and that of a page its value
+		Properties map[string]struct {
+			Type  string          `json:"type"`
+			Title json.RawMessage `json:"title"`
+		} `json:"properties"`
+	}
+	if json.Unmarshal(data, &object) != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, t := range object.Title {
+		b.WriteString(t.PlainText)
+	}
+	for _, p := range object.Properties {
+		var value []struct {
+			PlainText string `json:"plain_text"`
+		}
+		if p.Type == "title" && json.Unmarshal(p.Title, &value) == nil {
+			for _, t := range value {
+				b.WriteString(t.PlainText)
+			}
+		}
+	}
+	return b.String()
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	code := map[int]string{
+		http.StatusBadRequest:      "validation_error",
+		http.StatusUnauthorized:    "unauthorized",
+		http.StatusNotFound:        "object_not_found",
+		http.StatusTooManyRequests: "rate_limited",
+	}[status]
+	if code == "" {
+		code = "internal_server_error"
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"object": "error", "status": status, "code": code, "message": message})
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+// lastEditedTime returns the last edited time of an object, that sorts as text
+func lastEditedTime(data json.RawMessage) string {
+	var object struct {
+		LastEditedTime string `json:"last_edited_time"`
+	}
+	json.Unmarshal(data, &object)
+	return object.LastEditedTime
+}
@@ -0,0 +1,174 @@
+package notiontest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// do sends a request with the token and JSON body, and returns the status and decoded body of the response
+func do(t *testing.T, srv *Server, method, path, token, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(t, fstest.MapFS{
+		"pages/page-1.json":  {Data: []byte(`{"object":"page","id":"page-1","properties":{"title":{"type":"title","title":[{"plain_text":"Roadmap"}]}}}`)},
+		"blocks/page-1.json": {Data: []byte(`[{"id":"a"},{"id":"b"},{"id":"c"}]`)},
+	})
+	srv.PageSize = 2
+
+	get := func(path, token string) (int, map[string]any) {
+		t.Helper()
+		return do(t, srv, http.MethodGet, path, token, "")
+	}
+
+	// IDs match without dashes, and lists are paginated
+	status, body := get("/v1/blocks/PAGE1/children", Token)
+	if status != http.StatusOK || len(body["results"].([]any)) != 2 || body["next_cursor"] != "2" {
+		t.Errorf("unexpected first page %d %v", status, body)
+	}
+	status, body = get("/v1/blocks/page-1/children?start_cursor=2", Token)
+	if status != http.StatusOK || len(body["results"].([]any)) != 1 || body["has_more"] != false {
+		t.Errorf("unexpected last page %d %v", status, body)
+	}
+
+	if status, body := get("/v1/pages/page-1", "wrong"); status != http.StatusUnauthorized || body["code"] != "unauthorized" {
+		t.Errorf("expected unauthorized, got %d %v", status, body)
+	}
+	if status, body := get("/v1/pages/page-2", Token); status != http.StatusNotFound || body["code"] != "object_not_found" {
+		t.Errorf("expected not found, got %d %v", status, body)
+	}
+	srv.Fail("/v1/pages/page-1", http.StatusTooManyRequests, 1)
+	// unauthorized requests do not spend the failure
+	if status, _ := get("/v1/pages/page-1", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized, got %d", status)
+	}
+	if status, _ := get("/v1/pages/page-1", Token); status != http.StatusTooManyRequests {
+		t.Errorf("expected rate limited, got %d", status)
+	}
+	if status, _ := get("/v1/pages/page-1", Token); status != http.StatusOK {
+		t.Errorf("expected the failure to be spent, got %d", status)
+	}
+
+	if requests := srv.Requests(); len(requests) != 7 || !strings.HasPrefix(requests[0], "GET /v1/blocks/") {
+		t.Errorf("unexpected requests %q", requests)
+	}
+}
+
+func TestServerShare(t *testing.T) {
+	srv := NewServer(t, fstest.MapFS{
+		"pages/page-1.json": {Data: []byte(`{"object":"page","id":"page-1","properties":{"title":{"type":"title","title":[{"plain_text":"Roadmap"}]}}}`)},
+		"pages/page-2.json": {Data: []byte(`{"object":"page","id":"page-2","properties":{"title":{"type":"title","title":[{"plain_text":"Road trip"}]}}}`)},
+	})
+	srv.Share("alice", "page2")
+
+	if status, _ := do(t, srv, http.MethodGet, "/v1/pages/page-1", "alice", ""); status != http.StatusNotFound {
+		t.Errorf("expected a page not shared to be hidden, got %d", status)
+	}
+	if status, _ := do(t, srv, http.MethodGet, "/v1/pages/page-2", "alice", ""); status != http.StatusOK {
+		t.Errorf("expected the shared page, got %d", status)
+	}
+	if _, body := do(t, srv, http.MethodPost, "/v1/search", "alice", `{"query":"road"}`); len(body["results"].([]any)) != 1 {
+		t.Errorf("expected only the shared page to be found, got %v", body)
+	}
+	if _, body := do(t, srv, http.MethodPost, "/v1/search", Token, `{"query":"road"}`); len(body["results"].([]any)) != 2 {
+		t.Errorf("expected all the pages to be found with Token, got %v", body)
+	}
+}
+
+func TestServerEdits(t *testing.T) {
+	srv := NewServer(t, fstest.MapFS{
+		"pages/page-1.json": {Data: []byte(`{"object":"page","id":"page-1","properties":{}}`)},
+	})
+
+	srv.Set("pages/page-2.json", `{"object":"page","id":"page-2","properties":{}}`)
+	if status, _ := do(t, srv, http.MethodGet, "/v1/pages/page-2", Token, ""); status != http.StatusOK {
+		t.Errorf("expected the added page, got %d", status)
+	}
+	srv.Delete("pages/page-1.json")
+	if status, _ := do(t, srv, http.MethodGet, "/v1/pages/page-1", Token, ""); status != http.StatusNotFound {
+		t.Errorf("expected the deleted page to be gone, got %d", status)
+	}
+	if _, body := do(t, srv, http.MethodPost, "/v1/search", Token, `{}`); len(body["results"].([]any)) != 1 {
+		t.Errorf("expected the deleted page not to be found, got %v", body)
+	}
+	srv.Set("pages/page-3.json", `{"object":"page","id":"page-3","last_edited_time":"2025-03-01T10:00:00.000Z","properties":{}}`)
+	srv.Set("pages/page-2.json", `{"object":"page","id":"page-2","last_edited_time":"2025-03-02T10:00:00.000Z","properties":{}}`)
+	_, body := do(t, srv, http.MethodPost, "/v1/search", Token, `{"sort":{"timestamp":"last_edited_time","direction":"descending"}}`)
+	if results := body["results"].([]any); len(results) != 2 || results[0].(map[string]any)["id"] != "page-2" {
+		t.Errorf("expected the most recently edited page first, got %v", body)
+	}
+	if bodies := srv.Bodies("POST /v1/search"); len(bodies) != 2 || string(bodies[0]) != `{}` {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+}
+
+func TestServerWrites(t *testing.T) {
+	srv := NewServer(t, fstest.MapFS{
+		"pages/page-1.json": {Data: []byte(`{"object":"page","id":"page-1","properties":{}}`)},
+	})
+
+	status, page := do(t, srv, http.MethodPost, "/v1/pages", Token, `{"parent":{"type":"page_id","page_id":"page-1"},
+		"properties":{"title":{"title":[{"text":{"content":"Notes"}}]}},
+		"children":[{"type":"paragraph","paragraph":{"rich_text":[]}}]}`)
+	if status != http.StatusOK || page["id"] != "created-1" || page["properties"].(map[string]any)["title"].(map[string]any)["type"] != "title" {
+		t.Fatalf("unexpected created page %d %v", status, page)
+	}
+	if _, body := do(t, srv, http.MethodGet, "/v1/blocks/created-1/children", Token, ""); len(body["results"].([]any)) != 1 {
+		t.Errorf("expected the children of the created page, got %v", body)
+	}
+	if status, _ := do(t, srv, http.MethodPost, "/v1/pages", Token, `{"parent":{"type":"page_id","page_id":"missing"}}`); status != http.StatusNotFound {
+		t.Errorf("expected a missing parent to be rejected, got %d", status)
+	}
+
+	do(t, srv, http.MethodPatch, "/v1/blocks/created-1/children", Token, `{"children":[{"type":"divider","divider":{}}]}`)
+	if _, body := do(t, srv, http.MethodGet, "/v1/blocks/created-1/children", Token, ""); len(body["results"].([]any)) != 2 {
+		t.Errorf("expected the appended block, got %v", body)
+	}
+
+	if status, _ := do(t, srv, http.MethodPatch, "/v1/pages/created-1", Token, `{"archived":true}`); status != http.StatusOK {
+		t.Errorf("expected the page to be archived, got %d", status)
+	}
+	if status, _ := do(t, srv, http.MethodPatch, "/v1/pages/created-1", Token, `{"properties":{}}`); status != http.StatusBadRequest {
+		t.Errorf("expected an archived page not to be edited, got %d", status)
+	}
+
+	status, comment := do(t, srv, http.MethodPost, "/v1/comments", Token, `{"parent":{"page_id":"page-1"},"rich_text":[]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected comment %d %v", status, comment)
+	}
+	do(t, srv, http.MethodPost, "/v1/comments", Token, `{"discussion_id":"`+comment["discussion_id"].(string)+`","rich_text":[]}`)
+	if _, body := do(t, srv, http.MethodGet, "/v1/comments?block_id=page-1", Token, ""); len(body["results"].([]any)) != 2 {
+		t.Errorf("expected the comment and its reply, got %v", body)
+	}
+	if status, _ := do(t, srv, http.MethodPost, "/v1/comments", Token, `{"discussion_id":"missing","rich_text":[]}`); status != http.StatusNotFound {
+		t.Errorf("expected a missing discussion to be rejected, got %d", status)
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	srv := NewServer(t, fstest.MapFS{})
+	srv.Latency = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/users/u-1", nil)
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Error("expected the request to time out")
+	}
+}
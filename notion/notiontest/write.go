@@ -0,0 +1,220 @@
+package notiontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// timeFormat is the format of the times of the Notion API
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// createPage creates a page in a page or database, with its title, properties and children blocks
+func (s *Server) createPage(w http.ResponseWriter, r *http.Request, token string) {
+	var req struct {
+		Parent     map[string]any            `json:"parent"`
+		Properties map[string]map[string]any `json:"properties"`
+		Children   []map[string]any          `json:"children"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var kind, parentID string
+	switch req.Parent["type"] {
+	case "page_id":
+		kind, parentID = "pages", fmt.Sprint(req.Parent["page_id"])
+	case "database_id":
+		kind, parentID = "databases", fmt.Sprint(req.Parent["database_id"])
+	default:
+		writeError(w, http.StatusBadRequest, "body.parent should be a page_id or a database_id")
+		return
+	}
+	if _, ok := s.objects[kind][normalizeID(parentID)]; !ok || !s.visible(token, kind, parentID) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not find %s with ID: %s", kind[:len(kind)-1], parentID))
+		return
+	}
+
+	s.created++
+	id := fmt.Sprintf("created-%d", s.created)
+	now := time.Now().UTC().Format(timeFormat)
+	page := map[string]any{
+		"object":           "page",
+		"id":               id,
+		"created_time":     now,
+		"last_edited_time": now,
+		"parent":           req.Parent,
+		"url":              "https://www.notion.so/" + normalizeID(id),
+		"archived":         false,
+		"properties":       properties(req.Properties),
+	}
+	data, _ := json.Marshal(page)
+	s.set("pages/"+id+".json", data)
+	if token != Token {
+		s.shared[token][normalizeID(id)] = true
+	}
+	s.addBlocks(id, req.Children)
+	w.Write(data)
+}
+
+// updatePage sets the properties of a page, and archives or restores it
+func (s *Server) updatePage(w http.ResponseWriter, r *http.Request, token, id string) {
+	data, ok := s.objects["pages"][normalizeID(id)]
+	if !ok || !s.visible(token, "pages", id) {
+		writeError(w, http.StatusNotFound, "Could not find page with ID: "+id)
+		return
+	}
+	var req struct {
+		Properties map[string]map[string]any `json:"properties"`
+		Archived   *bool                     `json:"archived"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	var page map[string]any
+	if err := json.Unmarshal(data, &page); err != nil {
+		writeError(w, http.StatusInternalServerError, "invalid fixture: "+err.Error())
+		return
+	}
+	if page["archived"] == true && (req.Archived == nil || *req.Archived) {
+		writeError(w, http.StatusBadRequest, "Can't edit block that is archived. You must unarchive the block before editing.")
+		return
+	}
+	current, _ := page["properties"].(map[string]any)
+	if current == nil {
+		current = make(map[string]any)
+	}
+	for name, value := range properties(req.Properties) {
+		current[name] = value
+	}
+	page["properties"] = current
+	if req.Archived != nil {
+		page["archived"] = *req.Archived
+	}
+	page["last_edited_time"] = time.Now().UTC().Format(timeFormat)
+	data, _ = json.Marshal(page)
+	s.set("pages/"+id+".json", data)
+	w.Write(data)
+}
+
+// appendBlocks appends children blocks to a page or block
+func (s *Server) appendBlocks(w http.ResponseWriter, r *http.Request, id string) {
+	_, isPage := s.objects["pages"][normalizeID(id)]
+	_, isBlock := s.objects["blocks"][normalizeID(id)]
+	if !isPage && !isBlock {
+		writeError(w, http.StatusNotFound, "Could not find block with ID: "+id)
+		return
+	}
+	var req struct {
+		Children []map[string]any `json:"children"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	added := s.addBlocks(id, req.Children)
+	json.NewEncoder(w).Encode(map[string]any{"object": "list", "results": added, "has_more": false})
+}
+
+// addBlocks appends the blocks to the children of the page or block, and returns them with their IDs.
+// Their own children are left out.
+func (s *Server) addBlocks(parentID string, blocks []map[string]any) []map[string]any {
+	var children []map[string]any
+	if data, ok := s.objects["blocks"][normalizeID(parentID)]; ok {
+		json.Unmarshal(data, &children)
+	}
+	now := time.Now().UTC().Format(timeFormat)
+	for _, block := range blocks {
+		s.created++
+		block["object"] = "block"
+		block["id"] = fmt.Sprintf("created-%d", s.created)
+		block["created_time"] = now
+		block["last_edited_time"] = now
+		block["has_children"] = false
+		if typ, ok := block["type"].(string); ok {
+			if content, ok := block[typ].(map[string]any); ok {
+				delete(content, "children")
+			}
+		}
+		children = append(children, block)
+	}
+	data, _ := json.Marshal(children)
+	s.set("blocks/"+parentID+".json", data)
+	return blocks
+}
+
+// createComment adds a comment to a page, or to an existing discussion
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Parent       map[string]any  `json:"parent"`
+		DiscussionID string          `json:"discussion_id"`
+		RichText     json.RawMessage `json:"rich_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	// the comments of a discussion are stored with the first one
+	var target string
+	if req.DiscussionID != "" {
+		for id, data := range s.objects["comments"] {
+			var comments []struct {
+				DiscussionID string `json:"discussion_id"`
+			}
+			json.Unmarshal(data, &comments)
+			for _, c := range comments {
+				if c.DiscussionID == req.DiscussionID {
+					target = id
+				}
+			}
+		}
+		if target == "" {
+			writeError(w, http.StatusNotFound, "Could not find discussion with ID: "+req.DiscussionID)
+			return
+		}
+	} else {
+		target = fmt.Sprint(req.Parent["page_id"])
+		if _, ok := s.objects["pages"][normalizeID(target)]; !ok {
+			writeError(w, http.StatusNotFound, "Could not find page with ID: "+target)
+			return
+		}
+		s.created++
+		req.DiscussionID = fmt.Sprintf("discussion-%d", s.created)
+	}
+
+	s.created++
+	comment := map[string]any{
+		"object":        "comment",
+		"id":            fmt.Sprintf("comment-%d", s.created),
+		"discussion_id": req.DiscussionID,
+		"parent":        map[string]any{"type": "page_id", "page_id": target},
+		"created_time":  time.Now().UTC().Format(timeFormat),
+		"created_by":    map[string]any{"object": "user", "id": "notiontest"},
+		"rich_text":     req.RichText,
+	}
+	var comments []any
+	json.Unmarshal(s.objects["comments"][normalizeID(target)], &comments)
+	data, _ := json.Marshal(append(comments, comment))
+	s.set("comments/"+target+".json", data)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// properties returns the property values of a request with their type, that the responses include
+func properties(values map[string]map[string]any) map[string]any {
+	result := make(map[string]any, len(values))
+	for name, value := range values {
+		if _, ok := value["type"]; !ok {
+			for key := range maps.Keys(value) {
+				if key != "id" {
+					value["type"] = key
+					break
+				}
+			}
+		}
+		result[name] = value
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package notion
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jomei/notionapi"
+)
+
+// maxConcurrentFetches is the maximum number of block children, or comments, requests in flight for a page.
+// The rate limit of the token still applies, so more would only wait on it.
+const maxConcurrentFetches = 4
+
+// prefetchedChildren is the result of fetching the children of a block ahead of rendering
+type prefetchedChildren struct {
+	blocks []notionapi.Block
+	err    error
+}
+
+// prefetch fetches the children of the blocks, and theirs down the tree, with up to f.concurrency
+// requests at a time. Rendering then takes them from f.prefetched in document order.
+func (f *pageFetcher) prefetch(ctx context.Context, blocks []notionapi.Block) {
+	concurrency := f.concurrency
+	if concurrency == 0 {
+		concurrency = maxConcurrentFetches
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var walk func(blocks []notionapi.Block)
+	walk = func(blocks []notionapi.Block) {
+		for _, block := range blocks {
+			id, ok := childrenID(block)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				children, err := f.fetchChildren(ctx, id)
+				<-sem
+
+				f.mu.Lock()
+				if f.prefetched == nil {
+					f.prefetched = make(map[notionapi.BlockID]prefetchedChildren)
+				}
+				f.prefetched[id] = prefetchedChildren{blocks: children, err: err}
+				f.mu.Unlock()
+				if err == nil {
+					walk(children)
+				}
+			}()
+		}
+	}
+	walk(blocks)
+	wg.Wait()
+}
+
+// takePrefetched returns the prefetched children of a block, and forgets them as they are rendered once
+func (f *pageFetcher) takePrefetched(id notionapi.BlockID) (prefetchedChildren, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	children, ok := f.prefetched[id]
+	delete(f.prefetched, id)
+	return children, ok
+}
+
+// childrenID returns the ID of the block whose children are rendered within the block, if any.
+// Child pages and databases are rendered as links, their content is not part of the page.
+func childrenID(block notionapi.Block) (notionapi.BlockID, bool) {
+	switch b := block.(type) {
+	case *notionapi.ChildPageBlock, *notionapi.ChildDatabaseBlock:
+		return "", false
+	case *notionapi.SyncedBlock:
+		if from := b.SyncedBlock.SyncedFrom; from != nil {
+			return from.BlockID, true
+		}
+	}
+	return block.GetID(), block.GetHasChildren()
+}
@@ -0,0 +1,119 @@
+package notion
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+	"github.com/pomerium/mcp-servers/notion/notiontest"
+)
+
+const (
+	// syntheticFanout and syntheticDepth shape the block tree of the synthetic page
+	syntheticFanout = 4
+	syntheticDepth  = 4
+	// syntheticLatency is the response time of the stand-in API
+	syntheticLatency = 5 * time.Millisecond
+)
+
+// newSyntheticServer serves a page whose blocks are toggles of nested bulleted lists, syntheticDepth levels deep
+func newSyntheticServer(tb testing.TB) (*notiontest.Server, *notionapi.Client) {
+	tb.Helper()
+	files := make(map[string]string)
+	var addChildren func(parent string, level int)
+	addChildren = func(parent string, level int) {
+		blocks := make([]string, syntheticFanout)
+		for i := range blocks {
+			id := fmt.Sprintf("%s-%d", parent, i)
+			typ := "bulleted_list_item"
+			if level == 0 {
+				typ = "toggle"
+			}
+			blocks[i] = fmt.Sprintf(`{"object":"block","id":%q,"type":%q,"has_children":%t,%q:{"rich_text":[{"type":"text","plain_text":%q}]}}`,
+				id, typ, level+1 < syntheticDepth, typ, "Item "+id)
+			if level+1 < syntheticDepth {
+				addChildren(id, level+1)
+			}
+		}
+		files["blocks/"+parent+".json"] = "[" + strings.Join(blocks, ",") + "]"
+	}
+	addChildren("page", 0)
+	srv, client := newFixtureClient(tb, fixtures(files))
+	srv.Latency = syntheticLatency
+	return srv, client
+}
+
+func TestPrefetchOrder(t *testing.T) {
+	_, client := newSyntheticServer(t)
+
+	sequential, err := (&pageFetcher{client: client, concurrency: 1}).fetchPageContent(testContext(), "page")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	f := &pageFetcher{client: client}
+	concurrent, err := f.fetchPageContent(testContext(), "page")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if concurrent != sequential {
+		t.Errorf("concurrent fetch differs from sequential fetch:\n%s\n\n%s", concurrent, sequential)
+	}
+	if !strings.Contains(concurrent, "<summary>Item page-3</summary>\n\n- Item page-3-0\n  - Item page-3-0-0") {
+		t.Errorf("unexpected content:\n%s", concurrent)
+	}
+	if expected := 4 + 16 + 64 + 256; f.blocks != expected {
+		t.Errorf("fetched %d blocks, expected %d", f.blocks, expected)
+	}
+	if len(f.prefetched) != 0 {
+		t.Errorf("expected all prefetched blocks to be rendered, %d left", len(f.prefetched))
+	}
+}
+
+func TestPrefetchProgress(t *testing.T) {
+	srv, client := newSyntheticServer(t)
+
+	var progress []float64
+	blocked := false
+	ctx := mcputil.WithProgressReporter(testContext(), func(p, _ float64, _ string) {
+		progress = append(progress, p)
+		// the first report is made before the prefetch, the second one by a prefetch
+		if len(progress) != 2 {
+			return
+		}
+		// a slow client does not delay the other prefetches, that go on with more requests than they run at once
+		start := len(srv.Requests())
+		deadline := time.Now().Add(5 * time.Second)
+		for len(srv.Requests()) < start+2*maxConcurrentFetches && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		blocked = len(srv.Requests()) < start+2*maxConcurrentFetches
+	})
+	if _, err := (&pageFetcher{client: client}).fetchPageContent(ctx, "page"); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if blocked {
+		t.Error("expected the prefetches to go on while progress is reported")
+	}
+	if !slices.IsSorted(progress) || len(slices.Compact(slices.Clone(progress))) != len(progress) {
+		t.Errorf("expected increasing progress, got %v", progress)
+	}
+}
+
+func BenchmarkFetchPageContent(b *testing.B) {
+	_, client := newSyntheticServer(b)
+	for _, concurrency := range []int{1, maxConcurrentFetches} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for b.Loop() {
+				f := &pageFetcher{client: client, concurrency: concurrency}
+				if _, err := f.fetchPageContent(testContext(), "page"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package notion
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+const (
+	// propertyMetadataPrefix prefixes the names of page properties in the document metadata
+	propertyMetadataPrefix = "property:"
+	// maxRelationTitles is the maximum number of related pages whose titles are fetched for a page
+	maxRelationTitles = 25
+)
+
+// plainYAML matches the strings that YAML reads back as the same string without quotes
+var plainYAML = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} _./@+-]*$`)
+
+// pageProperties returns the values of the page properties other than its title, by name.
+// Related pages are shown by title, followed by their ID.
+func (f *pageFetcher) pageProperties(ctx context.Context, page *notionapi.Page) map[string]any {
+	values := make(map[string]any, len(page.Properties))
+	resolved := 0
+	for _, name := range slices.Sorted(maps.Keys(page.Properties)) {
+		switch p := page.Properties[name].(type) {
+		case *notionapi.TitleProperty:
+			continue
+		case *notionapi.RelationProperty:
+			var pages []string
+			for _, r := range p.Relation {
+				id := r.ID.String()
+				if resolved < maxRelationTitles {
+					resolved++
+					if l := f.resolve(ctx, notionapi.ObjectTypePage, id); l.title != id {
+						id = l.title + " (" + id + ")"
+					}
+				}
+				pages = append(pages, id)
+			}
+			if len(pages) > 0 {
+				values[name] = pages
+			}
+		default:
+			if v := propertyValue(p); v != nil && !isNullNumber(ctx, page.ID, name) {
+				values[name] = v
+			}
+		}
+	}
+	return values
+}
+
+// propertyMetadata returns the property values as document metadata
+func propertyMetadata(values map[string]any) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(values))
+	for name, v := range values {
+		metadata[propertyMetadataPrefix+name] = formatValue(v)
+	}
+	return metadata
+}
+
+// frontMatter renders the property values as a YAML front matter block, in name order
+func frontMatter(values map[string]any) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		b.WriteString(yamlString(name) + ": " + yamlValue(values[name]) + "\n")
+	}
+	b.WriteString("---")
+	return b.String()
+}
+
+func yamlValue(v any) string {
+	switch v := v.(type) {
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = yamlString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case string:
+		return yamlString(v)
+	}
+	return formatValue(v)
+}
+
+// yamlString quotes the strings that YAML would read as another string, a number or a boolean.
+// Quoted Go strings are valid YAML double quoted strings.
+func yamlString(s string) string {
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "y", "n":
+		return strconv.Quote(s)
+	}
+	if !plainYAML.MatchString(s) || strings.HasSuffix(s, " ") {
+		return strconv.Quote(s)
+	}
+	return s
+}
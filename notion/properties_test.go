@@ -0,0 +1,104 @@
+package notion
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPropertiesPage = `{"object":"page","id":"row-1","url":"https://notion.so/row-1","parent":{"type":"database_id","database_id":"db-1"},
+	"properties":{
+		"Name":{"type":"title","title":[{"type":"text","plain_text":"API outage"}]},
+		"Status":{"type":"status","status":{"name":"In progress"}},
+		"Severity":{"type":"number","number":2},
+		"Resolved":{"type":"checkbox","checkbox":false},
+		"Due":{"type":"date","date":{"start":"2025-03-01","end":"2025-03-05"}},
+		"Tags":{"type":"multi_select","multi_select":[{"name":"api"},{"name":"on: call"}]},
+		"Owner":{"type":"people","people":[{"object":"user","id":"u-1","name":"Ana"}]},
+		"Postmortem":{"type":"relation","relation":[{"id":"page-2"}],"has_more":false},
+		"Runbook":{"type":"url","url":"https://example.com/runbook"},
+		"Score":{"type":"formula","formula":{"type":"string","string":"true"}},
+		"Notes":{"type":"rich_text","rich_text":[]}
+	}}`
+
+// newPageServer serves row-1 with a single paragraph, its related page-2, and the given comments by block ID
+func newPageServer(t *testing.T, comments map[string]string) *notion {
+	t.Helper()
+	files := map[string]string{
+		"pages/row-1.json": testPropertiesPage,
+		"pages/page-2.json": `{"object":"page","id":"page-2","url":"https://notion.so/page-2","properties":{
+			"title":{"type":"title","title":[{"type":"text","plain_text":"Postmortem"}]}}}`,
+		"blocks/row-1.json": `[{"object":"block","id":"b-1","type":"paragraph",
+			"paragraph":{"rich_text":[{"type":"text","plain_text":"The API was down for an hour."}]}}]`,
+		"users/u-2.json": `{"object":"user","id":"u-2","name":"Ben"}`,
+	}
+	for id, results := range comments {
+		files["comments/"+id+".json"] = "[" + results + "]"
+	}
+	_, n := newFixtureProvider(t, fixtures(files), nil)
+	return n
+}
+
+func TestFetchProperties(t *testing.T) {
+	n := newPageServer(t, nil)
+
+	doc, err := n.Fetch(testContext(), "row-1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	expected := strings.Join([]string{
+		"---",
+		"Due: \"2025-03-01 → 2025-03-05\"",
+		"Owner: [Ana]",
+		"Postmortem: [\"Postmortem (page-2)\"]",
+		"Resolved: false",
+		"Runbook: \"https://example.com/runbook\"",
+		"Score: \"true\"",
+		"Severity: 2",
+		"Status: In progress",
+		"Tags: [api, \"on: call\"]",
+		"---",
+		"",
+		"The API was down for an hour.",
+	}, "\n")
+	if doc.Text != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", doc.Text, expected)
+	}
+
+	if expected := map[string]string{
+		"property:Due":        "2025-03-01 → 2025-03-05",
+		"property:Owner":      "Ana",
+		"property:Postmortem": "Postmortem (page-2)",
+		"property:Resolved":   "false",
+		"property:Runbook":    "https://example.com/runbook",
+		"property:Score":      "true",
+		"property:Severity":   "2",
+		"property:Status":     "In progress",
+		"property:Tags":       "api, on: call",
+	}; !reflect.DeepEqual(doc.Metadata, expected) {
+		t.Errorf("unexpected metadata %v", doc.Metadata)
+	}
+	if doc.Title != "API outage" {
+		t.Errorf("unexpected title %q", doc.Title)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	for input, expected := range map[string]string{
+		"Done":         "Done",
+		"In progress":  "In progress",
+		"v1.2":         "v1.2",
+		"42":           `"42"`,
+		"yes":          `"yes"`,
+		"a: b":         `"a: b"`,
+		"- item":       `"- item"`,
+		`say "hi"`:     `"say \"hi\""`,
+		"":             `""`,
+		"trailing ":    `"trailing "`,
+		"[not a list]": `"[not a list]"`,
+	} {
+		if got := yamlString(input); got != expected {
+			t.Errorf("%q: got %s, expected %s", input, got, expected)
+		}
+	}
+}
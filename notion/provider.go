@@ -4,9 +4,13 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jomei/notionapi"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -14,25 +18,95 @@ import (
 	"github.com/pomerium/mcp-servers/ctxutil"
 	"github.com/pomerium/mcp-servers/drutil"
 	"github.com/pomerium/mcp-servers/httputil"
+	"github.com/pomerium/mcp-servers/mcputil"
 )
 
 func New(context.Context) drutil.Provider {
 	return &notion{
-		http: httputil.NewDebugHTTPClient(func(s string) { fmt.Println(s) }),
+		http:     &http.Client{},
+		limiters: newTokenLimiters(),
 	}
 }
 
-func NewServer(ctx context.Context, _ map[string]string) (*mcp.Server, error) {
-	provider := New(ctx)
-	mcpServer := drutil.BuildMCPServer("Notion", provider)
+// NewProvider creates the provider with the options of its environment variables, without their prefix
+func NewProvider(ctx context.Context, env map[string]string) (drutil.Provider, error) {
+	provider := New(ctx).(*notion)
+	debug, ok, err := httputil.DebugOptionsFromEnv(env)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		provider.http = httputil.NewDebugHTTPClient(debug)
+	}
+	if v := env["BASE_URL"]; v != "" {
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid BASE_URL %q", v)
+		}
+		provider.baseURL = u
+	}
+	if file := env["INDEX_FILE"]; file != "" {
+		var interval time.Duration
+		if v, ok := env["INDEX_INTERVAL"]; ok {
+			var err error
+			if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid INDEX_INTERVAL %q", v)
+			}
+		}
+		index, err := newContentIndex(ctx, provider, file, interval)
+		if err != nil {
+			return nil, err
+		}
+		provider.index = index
+	}
+	if v, ok := env["COMMENTS"]; ok {
+		comments, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid COMMENTS %q", v)
+		}
+		provider.comments = comments
+	}
+	return provider, nil
+}
+
+func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error) {
+	provider, err := NewProvider(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	opts := drutil.OptionsFromEnv(env)
+	opts.ResourceTemplate = "notion://page/{id}"
+	mcpServer := drutil.BuildMCPServer("Notion", provider, opts)
+	provider.(*notion).addQueryDatabaseTool(mcpServer)
+	provider.(*notion).addSitemapTool(mcpServer)
+	provider.(*notion).addWriteTools(mcpServer)
 	return mcpServer, nil
 }
 
 //go:embed search.txt
 var searchDescription string
 
+var (
+	_ drutil.DocumentCompleter = (*notion)(nil)
+	_ drutil.DocumentLister    = (*notion)(nil)
+	_ drutil.DocumentVersioner = (*notion)(nil)
+	_ drutil.PagedSearcher     = (*notion)(nil)
+	_ drutil.QuerySearcher     = (*notion)(nil)
+)
+
+// recentPages is the number of recently edited pages listed as resources
+const recentPages = 20
+
 type notion struct {
 	http *http.Client
+	// index is the optional full-text index of the page contents
+	index *contentIndex
+	// comments appends the comments of fetched pages to their text
+	comments bool
+	// limiters holds the request budget of each token
+	limiters *tokenLimiters
+	// baseURL replaces the URL of the Notion API if set
+	baseURL *url.URL
 }
 
 func (n *notion) GetSearchSyntax() string {
@@ -44,310 +118,350 @@ func (n *notion) getClient(ctx context.Context) (*notionapi.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("get token from context: %w", err)
 	}
+	httpClient := *n.http
+	base := n.http.Transport
+	if n.baseURL != nil {
+		base = baseURLTransport{base: base, url: n.baseURL}
+	}
+	httpClient.Transport = nullNumberTransport{
+		base: retryTransport{
+			base:     searchFilterTransport{base: base},
+			limiters: n.limiters,
+		},
+	}
 	return notionapi.NewClient(
 		notionapi.Token(token),
-		notionapi.WithHTTPClient(n.http),
+		notionapi.WithHTTPClient(&httpClient),
+		// retryTransport retries rate limited requests, notionapi would resend them without their body
+		notionapi.WithRetry(1),
 	), nil
 }
 
 func (n *notion) Search(ctx context.Context, query string) ([]drutil.Document, error) {
+	if query == "" {
+		return nil, fmt.Errorf("query cannot be empty")
+	}
+	results, err := n.SearchWithOptions(ctx, query, drutil.SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return results.Results, nil
+}
+
+// SearchTypes returns the Notion object types that can be searched
+func (n *notion) SearchTypes() []string {
+	return []string{string(notionapi.ObjectTypePage), string(notionapi.ObjectTypeDatabase)}
+}
+
+// SearchFilters returns the query filters supported by the Search API, and by the content index if enabled,
+// the others are applied to the results
+func (n *notion) SearchFilters() (pushdown, local []string) {
+	if n.index != nil {
+		return []string{drutil.FilterAfter, drutil.FilterBefore, drutil.FilterType, drutil.FilterPhrase, drutil.FilterTitle},
+			[]string{drutil.FilterAuthor}
+	}
+	return []string{drutil.FilterAfter, drutil.FilterBefore, drutil.FilterType},
+		[]string{drutil.FilterPhrase, drutil.FilterTitle, drutil.FilterAuthor}
+}
+
+// SearchQuery searches the page contents in the index if enabled and built for the caller,
+// or the titles for the words, phrases and title filters of the query.
+// As the index only holds pages, the first page of its results also holds the databases whose title matches,
+// unless the query is restricted to pages.
+func (n *notion) SearchQuery(ctx context.Context, q *drutil.Query, opts drutil.SearchOptions) (*drutil.SearchResults, error) {
+	if n.index != nil && q.Type != string(notionapi.ObjectTypeDatabase) {
+		results, ok, err := n.index.search(ctx, q, opts)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if q.Type == "" && opts.Cursor == "" {
+				opts.Type = string(notionapi.ObjectTypeDatabase)
+				databases, err := n.searchTitles(ctx, q, opts)
+				if err != nil {
+					drutil.Warn(ctx, fmt.Sprintf("databases are missing from the results: %v", err))
+				} else {
+					results.Results = append(results.Results, databases.Results...)
+				}
+			}
+			return results, nil
+		}
+	}
+
+	opts.Type = q.Type
+	return n.searchTitles(ctx, q, opts)
+}
+
+// searchTitles searches the titles for the words, phrases and title filters of the query, in the date range of the query
+func (n *notion) searchTitles(ctx context.Context, q *drutil.Query, opts drutil.SearchOptions) (*drutil.SearchResults, error) {
+	opts.EditedAfter, opts.EditedBefore = q.After, q.Before
+	text := strings.Join(slices.Concat(q.Terms, q.Phrases, q.Title), " ")
+	results, err := n.SearchWithOptions(ctx, text, opts)
+	if err != nil {
+		return nil, err
+	}
+	if n.index != nil {
+		// the filters are declared as pushed down for the index, so apply them to the Search API results
+		results.Results = slices.DeleteFunc(results.Results, func(doc drutil.Document) bool {
+			return !q.Match(&doc, []string{drutil.FilterPhrase, drutil.FilterTitle})
+		})
+	}
+	return results, nil
+}
+
+// SearchWithOptions searches page and database titles, or only those of opts.Type. Paging, sorting and the type
+// filter use the Search API, while the date range is applied to the returned page, so it may hold fewer results than the limit.
+func (n *notion) SearchWithOptions(ctx context.Context, query string, opts drutil.SearchOptions) (*drutil.SearchResults, error) {
 	client, err := n.getClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get notion client: %w", err)
 	}
-	if query == "" {
-		return nil, fmt.Errorf("query cannot be empty")
+
+	req := &notionapi.SearchRequest{
+		Query:       query,
+		StartCursor: notionapi.Cursor(opts.Cursor),
+		PageSize:    opts.Limit,
+	}
+	if opts.Type != "" {
+		req.Filter = notionapi.SearchFilter{Value: opts.Type, Property: "object"}
+	}
+	switch opts.Sort {
+	case drutil.SortLastEditedDesc:
+		req.Sort = &notionapi.SortObject{Timestamp: notionapi.TimestampLastEdited, Direction: notionapi.SortOrderDESC}
+	case drutil.SortLastEditedAsc:
+		req.Sort = &notionapi.SortObject{Timestamp: notionapi.TimestampLastEdited, Direction: notionapi.SortOrderASC}
 	}
 
-	resp, err := client.Search.Do(ctx, &notionapi.SearchRequest{
-		Query: query,
-		Filter: notionapi.SearchFilter{
-			Value:    "page",
-			Property: "object",
-		},
-	})
+	resp, err := client.Search.Do(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("search api: %w", err)
 	}
 
-	var documents []drutil.Document
+	results := &drutil.SearchResults{}
+	if resp.HasMore {
+		results.NextCursor = resp.NextCursor.String()
+	}
 	for _, res := range resp.Results {
-		switch res.GetObject() {
-		case notionapi.ObjectTypePage:
-			documents = append(documents, pageToDocument(res.(*notionapi.Page)))
+		switch res := res.(type) {
+		case *notionapi.Page:
+			if opts.InRange(res.LastEditedTime) {
+				results.Results = append(results.Results, pageToDocument(ctx, res))
+			}
+		case *notionapi.Database:
+			if opts.InRange(res.LastEditedTime) {
+				results.Results = append(results.Results, databaseToDocument(res))
+			}
 		default:
-			slog.Info("ignoring unsupported object type", "type", res.GetObject())
-			continue
+			mcputil.Logger(ctx).Info("ignoring unsupported object type", "type", res.GetObject())
+		}
+	}
+	return results, nil
+}
+
+// CompleteDocumentID returns the IDs of pages and databases whose title matches value
+func (n *notion) CompleteDocumentID(ctx context.Context, value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	documents, err := n.Search(ctx, value)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(documents))
+	for _, doc := range documents {
+		ids = append(ids, doc.ID)
+	}
+	return ids, nil
+}
+
+// ListDocuments returns the most recently edited pages and databases
+func (n *notion) ListDocuments(ctx context.Context) ([]drutil.Document, error) {
+	results, err := n.SearchWithOptions(ctx, "", drutil.SearchOptions{
+		Limit: recentPages,
+		Sort:  drutil.SortLastEditedDesc,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results.Results, nil
+}
+
+// DocumentVersion returns the last edited time of the page or database
+func (n *notion) DocumentVersion(ctx context.Context, id string) (string, error) {
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get notion client: %w", err)
+	}
+	page, err := client.Page.Get(ctx, notionapi.PageID(id))
+	if isDatabaseError(err) {
+		db, dbErr := client.Database.Get(ctx, notionapi.DatabaseID(id))
+		if dbErr == nil {
+			return db.LastEditedTime.String(), nil
 		}
+		if !isDatabaseError(dbErr) {
+			return "", fmt.Errorf("get database: %w", dbErr)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("get page: %w", err)
 	}
-	return documents, nil
+	return page.LastEditedTime.String(), nil
 }
 
 func (n *notion) Fetch(ctx context.Context, id string) (*drutil.Document, error) {
+	return n.fetch(ctx, id, 0)
+}
+
+// fetch fetches a page with its child pages inlined up to depth levels below it, or the rows of a database
+func (n *notion) fetch(ctx context.Context, id string, depth int) (*drutil.Document, error) {
 	client, err := n.getClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get notion client: %w", err)
 	}
+	ctx = withNullNumbers(ctx)
 
-	// Fetch the page
+	// Fetch the page, or the rows of the database if the ID is not that of a page
 	page, err := client.Page.Get(ctx, notionapi.PageID(id))
+	if isDatabaseError(err) {
+		db, dbErr := client.Database.Get(ctx, notionapi.DatabaseID(id))
+		if dbErr == nil {
+			text, err := databaseText(ctx, client, db)
+			if err != nil {
+				return nil, fmt.Errorf("fetch database: %w", err)
+			}
+			doc := databaseToDocument(db)
+			doc.ID = id
+			doc.Text = text
+			return &doc, nil
+		}
+		if !isDatabaseError(dbErr) {
+			return nil, fmt.Errorf("get database: %w", dbErr)
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get page: %w", err)
 	}
 
-	// Get the title
-	title := getTitleText(page)
-
 	// Fetch all content blocks recursively
-	content, err := n.fetchPageContent(ctx, client, notionapi.BlockID(id))
+	f := &pageFetcher{client: client, comments: n.comments, depth: depth}
+	if depth > 0 {
+		f.subtree = &subtree{visited: map[string]bool{normalizeID(id): true}}
+	}
+	content, err := f.fetchPageContent(ctx, notionapi.BlockID(id))
 	if err != nil {
 		return nil, fmt.Errorf("fetch page content: %w", err)
 	}
+	if f.subtree != nil && f.subtree.skipped > 0 {
+		drutil.Warn(ctx, fmt.Sprintf("%d child pages were not inlined because the fetch reached its size limit", f.subtree.skipped))
+	}
 
-	return &drutil.Document{
-		ID:    id,
-		Title: title,
-		Text:  content,
-		URL:   &page.URL,
-	}, nil
+	// Properties are rendered as front matter, and comments as a last section
+	properties := f.pageProperties(ctx, page)
+	doc := pageToDocument(ctx, page)
+	doc.ID = id
+	doc.Metadata = propertyMetadata(properties)
+	doc.Text = joinBlocks(frontMatter(properties), content)
+	if n.comments {
+		doc.Text = joinBlocks(doc.Text, f.renderComments(ctx))
+	}
+	return &doc, nil
 }
 
-func pageToDocument(page *notionapi.Page) drutil.Document {
-	txt := getTitleText(page)
+func pageToDocument(ctx context.Context, page *notionapi.Page) drutil.Document {
+	txt := getTitleText(ctx, page)
 	return drutil.Document{
-		ID:    page.ID.String(),
-		Title: txt,
-		Text:  txt,
-		URL:   &page.URL,
+		ID:          page.ID.String(),
+		Title:       txt,
+		Text:        txt,
+		URL:         &page.URL,
+		Author:      userName(page.CreatedBy),
+		Created:     page.CreatedTime,
+		LastEdited:  page.LastEditedTime,
+		Parent:      parentID(page.Parent),
+		ContentType: string(notionapi.ObjectTypePage),
+		Tags:        pageTags(page),
 	}
 }
 
-func getTitleText(page *notionapi.Page) string {
-	title, ok := page.Properties[string(notionapi.PropertyTypeTitle)].(*notionapi.TitleProperty)
-	if !ok {
-		slog.Warn("page does not have a title property", "page_id", page.ID)
-		return ""
+func databaseToDocument(db *notionapi.Database) drutil.Document {
+	txt := richTextToPlain(db.Title)
+	return drutil.Document{
+		ID:          db.ID.String(),
+		Title:       txt,
+		Text:        txt,
+		URL:         &db.URL,
+		Author:      userName(db.CreatedBy),
+		Created:     db.CreatedTime,
+		LastEdited:  db.LastEditedTime,
+		Parent:      parentID(db.Parent),
+		ContentType: string(notionapi.ObjectTypeDatabase),
 	}
+}
 
-	if len(title.Title) == 0 {
-		return ""
+// userName returns the name of the user, or its ID if the integration cannot read user information
+func userName(u notionapi.User) string {
+	if u.Name != "" {
+		return u.Name
 	}
-	var b strings.Builder
-	for i, t := range title.Title {
-		if i > 0 {
-			b.WriteString(" ")
-		}
-		b.WriteString(t.PlainText)
-	}
-	return b.String()
+	return u.ID.String()
 }
 
-// fetchPageContent recursively fetches all blocks and extracts text content
-func (n *notion) fetchPageContent(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID) (string, error) {
-	var content strings.Builder
-
-	// Get all children blocks with pagination
-	cursor := ""
-	hasMore := true
-
-	for hasMore {
-		pagination := &notionapi.Pagination{}
-		if cursor != "" {
-			pagination.StartCursor = notionapi.Cursor(cursor)
-		}
-
-		response, err := client.Block.GetChildren(ctx, blockID, pagination)
-		if err != nil {
-			return "", fmt.Errorf("get block children: %w", err)
-		}
-
-		// Process each block
-		for _, block := range response.Results {
-			blockText := n.extractTextFromBlock(ctx, client, block)
-			if blockText != "" {
-				if content.Len() > 0 {
-					content.WriteString("\n")
-				}
-				content.WriteString(blockText)
-			}
-		}
-
-		hasMore = response.HasMore
-		cursor = response.NextCursor
+// parentID returns the parent as <type>:<id>, or workspace for top level pages
+func parentID(p notionapi.Parent) string {
+	switch p.Type {
+	case notionapi.ParentTypePageID:
+		return "page:" + p.PageID.String()
+	case notionapi.ParentTypeDatabaseID:
+		return "database:" + p.DatabaseID.String()
+	case notionapi.ParentTypeBlockID:
+		return "block:" + p.BlockID.String()
+	case notionapi.ParentTypeWorkspace:
+		return "workspace"
 	}
-
-	return content.String(), nil
+	return ""
 }
 
-// extractTextFromBlock extracts text content from a single block and its children
-func (n *notion) extractTextFromBlock(ctx context.Context, client *notionapi.Client, block notionapi.Block) string {
-	var text strings.Builder
-
-	switch b := block.(type) {
-	case *notionapi.ParagraphBlock:
-		text.WriteString(extractRichText(b.Paragraph.RichText))
-		if len(b.Paragraph.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.Paragraph.Children)
-			if childText != "" {
-				text.WriteString("\n" + childText)
-			}
-		}
-
-	case *notionapi.Heading1Block:
-		text.WriteString("# " + extractRichText(b.Heading1.RichText))
-
-	case *notionapi.Heading2Block:
-		text.WriteString("## " + extractRichText(b.Heading2.RichText))
-
-	case *notionapi.Heading3Block:
-		text.WriteString("### " + extractRichText(b.Heading3.RichText))
-
-	case *notionapi.BulletedListItemBlock:
-		text.WriteString("• " + extractRichText(b.BulletedListItem.RichText))
-		if len(b.BulletedListItem.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.BulletedListItem.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
-			}
-		}
-
-	case *notionapi.NumberedListItemBlock:
-		text.WriteString("1. " + extractRichText(b.NumberedListItem.RichText))
-		if len(b.NumberedListItem.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.NumberedListItem.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
-			}
-		}
-
-	case *notionapi.ToDoBlock:
-		checkbox := "☐"
-		if b.ToDo.Checked {
-			checkbox = "☑"
-		}
-		text.WriteString(checkbox + " " + extractRichText(b.ToDo.RichText))
-		if len(b.ToDo.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.ToDo.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
-			}
-		}
-
-	case *notionapi.ToggleBlock:
-		text.WriteString("▶ " + extractRichText(b.Toggle.RichText))
-		if len(b.Toggle.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.Toggle.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
+// pageTags returns the options of the select and multi-select properties of the page, in property name order
+func pageTags(page *notionapi.Page) []string {
+	var tags []string
+	for _, name := range slices.Sorted(maps.Keys(page.Properties)) {
+		switch p := page.Properties[name].(type) {
+		case *notionapi.MultiSelectProperty:
+			for _, o := range p.MultiSelect {
+				tags = append(tags, o.Name)
 			}
-		}
-
-	case *notionapi.CalloutBlock:
-		text.WriteString("💡 " + extractRichText(b.Callout.RichText))
-		if len(b.Callout.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.Callout.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
+		case *notionapi.SelectProperty:
+			if p.Select.Name != "" {
+				tags = append(tags, p.Select.Name)
 			}
 		}
+	}
+	return tags
+}
 
-	case *notionapi.QuoteBlock:
-		text.WriteString("> " + extractRichText(b.Quote.RichText))
-		if len(b.Quote.Children) > 0 {
-			childText := n.extractTextFromChildren(ctx, client, b.Quote.Children)
-			if childText != "" {
-				text.WriteString("\n" + indentText(childText))
-			}
-		}
-
-	case *notionapi.CodeBlock:
-		language := b.Code.Language
-		text.WriteString("```" + language + "\n" + extractRichText(b.Code.RichText) + "\n```")
-
-	case *notionapi.DividerBlock:
-		text.WriteString("---")
-
-	case *notionapi.TableBlock:
-		// For tables, we need to fetch table rows as children
-		if hasChildren := block.GetHasChildren(); hasChildren {
-			tableContent, err := n.fetchPageContent(ctx, client, block.GetID())
-			if err == nil && tableContent != "" {
-				text.WriteString(tableContent)
-			}
-		}
-
-	case *notionapi.TableRowBlock:
-		row := []string{}
-		for _, cell := range b.TableRow.Cells {
-			row = append(row, extractRichText(cell))
-		}
-		text.WriteString("| " + strings.Join(row, " | ") + " |")
-
-	case *notionapi.ChildPageBlock:
-		text.WriteString("📄 " + b.ChildPage.Title)
-
-	case *notionapi.BookmarkBlock:
-		text.WriteString("🔗 " + b.Bookmark.URL)
-		if len(b.Bookmark.Caption) > 0 {
-			text.WriteString(" - " + extractRichText(b.Bookmark.Caption))
-		}
-
-	case *notionapi.EmbedBlock:
-		text.WriteString("🔗 " + b.Embed.URL)
-
-	case *notionapi.ImageBlock:
-		imageText := "🖼 Image"
-		if b.Image.Type == notionapi.FileTypeExternal && b.Image.External != nil {
-			imageText += ": " + b.Image.External.URL
-		}
-		if len(b.Image.Caption) > 0 {
-			imageText += " - " + extractRichText(b.Image.Caption)
-		}
-		text.WriteString(imageText)
-
-	case *notionapi.VideoBlock:
-		videoText := "🎥 Video"
-		if b.Video.Type == notionapi.FileTypeExternal && b.Video.External != nil {
-			videoText += ": " + b.Video.External.URL
-		}
-		if len(b.Video.Caption) > 0 {
-			videoText += " - " + extractRichText(b.Video.Caption)
-		}
-		text.WriteString(videoText)
-
-	case *notionapi.FileBlock:
-		fileText := "📎 File"
-		if len(b.File.Caption) > 0 {
-			fileText += " - " + extractRichText(b.File.Caption)
-		}
-		text.WriteString(fileText)
-
-	default:
-		// For blocks with children but no specific text extraction
-		if hasChildren := block.GetHasChildren(); hasChildren {
-			childContent, err := n.fetchPageContent(ctx, client, block.GetID())
-			if err == nil && childContent != "" {
-				text.WriteString(childContent)
-			}
+// getTitleText returns the title of the page. Pages in databases name their title property after the database column.
+func getTitleText(ctx context.Context, page *notionapi.Page) string {
+	if title, ok := page.Properties[string(notionapi.PropertyTypeTitle)].(*notionapi.TitleProperty); ok {
+		return richTextToPlain(title.Title)
+	}
+	for _, p := range page.Properties {
+		if title, ok := p.(*notionapi.TitleProperty); ok {
+			return richTextToPlain(title.Title)
 		}
 	}
-
-	return text.String()
+	mcputil.Logger(ctx).Warn("page does not have a title property", "page_id", page.ID)
+	return ""
 }
 
-// extractTextFromChildren processes child blocks
-func (n *notion) extractTextFromChildren(ctx context.Context, client *notionapi.Client, children notionapi.Blocks) string {
-	var content strings.Builder
-	for _, child := range children {
-		childText := n.extractTextFromBlock(ctx, client, child)
-		if childText != "" {
-			if content.Len() > 0 {
-				content.WriteString("\n")
-			}
-			content.WriteString(childText)
+func richTextToPlain(text []notionapi.RichText) string {
+	var b strings.Builder
+	for i, t := range text {
+		if i > 0 {
+			b.WriteString(" ")
 		}
+		b.WriteString(t.PlainText)
 	}
-	return content.String()
+	return b.String()
 }
 
 // extractRichText extracts plain text from rich text array
@@ -358,14 +472,3 @@ func extractRichText(richText []notionapi.RichText) string {
 	}
 	return text.String()
 }
-
-// indentText adds indentation to text for nested content
-func indentText(text string) string {
-	lines := strings.Split(text, "\n")
-	for i, line := range lines {
-		if line != "" {
-			lines[i] = "  " + line
-		}
-	}
-	return strings.Join(lines, "\n")
-}
@@ -1,9 +1,23 @@
 package notion
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/mcputil"
 )
 
 func TestExtractRichText(t *testing.T) {
@@ -26,13 +40,149 @@ func TestExtractRichText(t *testing.T) {
 	}
 }
 
-func TestIndentText(t *testing.T) {
-	input := "Line 1\nLine 2\nLine 3"
-	expected := "  Line 1\n  Line 2\n  Line 3"
+func TestIndentLines(t *testing.T) {
+	input := "Line 1\nLine 2\n\nLine 3"
+	expected := "  Line 1\n  Line 2\n\n  Line 3"
 
-	result := indentText(input)
+	result := indentLines(input, "  ")
 
 	if result != expected {
 		t.Errorf("Expected %q, got %q", expected, result)
 	}
 }
+
+// rewriteTransport sends all requests to a test server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestFetchPageContentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// every block has a child block with more children, so the tree never ends
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"object":"list","has_more":false,"results":[{
+			"object":"block","id":"block-%d","type":"column_list","has_children":true,"column_list":{}
+		}]}`, n)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	var progress atomic.Int32
+	ctx = mcputil.WithProgressReporter(ctx, func(p, _ float64, _ string) {
+		progress.Store(int32(p))
+		if p == 10 {
+			cancel()
+		}
+	})
+
+	f := &pageFetcher{client: notionapi.NewClient("token", notionapi.WithHTTPClient(&http.Client{
+		Transport: rewriteTransport{target: target},
+	}))}
+
+	done := make(chan error)
+	go func() {
+		_, err := f.fetchPageContent(ctx, "root")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("fetch did not stop after the context was cancelled")
+	}
+
+	if n := requests.Load(); n != 10 {
+		t.Errorf("expected no requests after cancellation, got %d requests", n)
+	}
+	if p := progress.Load(); p != 10 {
+		t.Errorf("expected progress to stop at 10 blocks, got %d", p)
+	}
+}
+
+func TestSearchWithOptions(t *testing.T) {
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"object":"list","has_more":true,"next_cursor":"cursor-2","results":[
+			{"object":"page","id":"page-1","last_edited_time":"2025-03-01T00:00:00Z","url":"https://notion.so/page-1",
+			 "created_by":{"object":"user","id":"user-1"},"parent":{"type":"database_id","database_id":"db-1"},
+			 "properties":{"title":{"type":"title","title":[{"type":"text","plain_text":"Recent"}]},
+			   "Tags":{"type":"multi_select","multi_select":[{"name":"plan"},{"name":"q1"}]}}},
+			{"object":"page","id":"page-2","last_edited_time":"2024-03-01T00:00:00Z","url":"https://notion.so/page-2",
+			 "properties":{"title":{"type":"title","title":[{"type":"text","plain_text":"Old"}]}}}
+		]}`)
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	ctx := ctxutil.AuthorizationTokenFromRequest(context.Background(), req)
+
+	n := &notion{http: &http.Client{Transport: rewriteTransport{target: target}}}
+	results, err := n.SearchWithOptions(ctx, "plan", drutil.SearchOptions{
+		Limit:       2,
+		Cursor:      "cursor-1",
+		EditedAfter: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Type:        "page",
+		Sort:        drutil.SortLastEditedDesc,
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	expected := map[string]any{
+		"query":        "plan",
+		"start_cursor": "cursor-1",
+		"page_size":    float64(2),
+		"filter":       map[string]any{"value": "page", "property": "object"},
+		"sort":         map[string]any{"timestamp": "last_edited_time", "direction": "descending"},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("unexpected search request %v, expected %v", body, expected)
+	}
+	if len(results.Results) != 1 || results.Results[0].Title != "Recent" {
+		t.Errorf("expected only the page edited after the date, got %+v", results.Results)
+	}
+	if len(results.Results) == 1 {
+		doc := results.Results[0]
+		if doc.Author != "user-1" || doc.Parent != "database:db-1" || doc.ContentType != "page" ||
+			!doc.LastEdited.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) || !reflect.DeepEqual(doc.Tags, []string{"plan", "q1"}) {
+			t.Errorf("unexpected document metadata %+v", doc)
+		}
+	}
+	if results.NextCursor != "cursor-2" {
+		t.Errorf("expected next cursor cursor-2, got %q", results.NextCursor)
+	}
+}
+
+func TestNewProviderInvalidOptions(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"DEBUG_HTTP": "verbose"},
+		{"DEBUG_HTTP": "true", "DEBUG_HTTP_MAX_BODY": "all"},
+		{"COMMENTS": "maybe"},
+		{"BASE_URL": "localhost"},
+	} {
+		if _, err := NewProvider(context.Background(), env); err == nil {
+			t.Errorf("%v: expected an error", env)
+		}
+	}
+}
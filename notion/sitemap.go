@@ -0,0 +1,266 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	// defaultSitemapDepth is the number of levels of pages listed by the sitemap tool
+	defaultSitemapDepth = 3
+	// maxSitemapDepth is the maximum number of levels of pages listed by the sitemap tool
+	maxSitemapDepth = 10
+	// maxSitemapPages is the maximum number of pages and databases listed by the sitemap tool
+	maxSitemapPages = 500
+	// maxSitemapBlocks is the maximum number of blocks read to find the child pages under a root
+	maxSitemapBlocks = 5000
+	// maxSitemapSearchResults is the maximum number of Search API results read to map the workspace
+	maxSitemapSearchResults = 2000
+)
+
+type sitemapArgs struct {
+	RootID string `json:"root_id,omitempty" jsonschema:"The ID of the page to list the pages under, defaults to the whole workspace shared with the integration"`
+	Depth  int    `json:"depth,omitempty" jsonschema:"Number of levels of pages to list, defaults to 3 and cannot exceed 10"`
+}
+
+// sitemap lists pages and databases in depth-first order, each followed by its children
+type sitemap struct {
+	Pages     []sitemapPage `json:"pages"`
+	Truncated bool          `json:"truncated,omitempty" jsonschema:"Whether pages were left out because the sitemap reached its maximum size"`
+}
+
+type sitemapPage struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Type       string `json:"type" jsonschema:"page or database"`
+	URL        string `json:"url"`
+	LastEdited string `json:"last_edited,omitempty"`
+	ParentID   string `json:"parent_id,omitempty" jsonschema:"The ID of the parent page, empty at the top level"`
+	Depth      int    `json:"depth" jsonschema:"The level of the page, 1 at the top level"`
+}
+
+// addSitemapTool adds the sitemap tool to the server
+func (n *notion) addSitemapTool(server *mcp.Server) {
+	mcp.AddTool(server, &mcp.Tool{
+		Name: "sitemap",
+		Description: "List the hierarchy of Notion pages and databases under a page, or in the whole workspace, " +
+			"with their IDs, titles and last edit times. Database rows are not listed, use query_database for them",
+		Annotations: mcputil.ReadOnlyTool("Sitemap", true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args sitemapArgs) (*mcp.CallToolResult, *sitemap, error) {
+		sm, err := n.sitemap(mcputil.WithProgress(ctx, req), args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sitemap: %w", err)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: sm.markdown()}},
+		}, sm, nil
+	})
+}
+
+func (n *notion) sitemap(ctx context.Context, args sitemapArgs) (*sitemap, error) {
+	if args.Depth < 0 || args.Depth > maxSitemapDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", maxSitemapDepth)
+	}
+	depth := args.Depth
+	if depth == 0 {
+		depth = defaultSitemapDepth
+	}
+	if args.RootID == "" {
+		return n.workspaceSitemap(ctx, depth)
+	}
+
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get notion client: %w", err)
+	}
+	w := &sitemapWalker{
+		fetcher: &pageFetcher{client: client},
+		root:    notionapi.BlockID(args.RootID),
+		sitemap: &sitemap{},
+		visited: map[string]bool{normalizeID(args.RootID): true},
+		depth:   depth,
+	}
+	if err := w.walk(ctx, w.root, "", 1); err != nil {
+		return nil, err
+	}
+	return w.sitemap, nil
+}
+
+// sitemapWalker lists the child pages and databases under a page
+type sitemapWalker struct {
+	fetcher *pageFetcher
+	root    notionapi.BlockID
+	sitemap *sitemap
+	visited map[string]bool
+	depth   int
+}
+
+// walk lists the child pages and databases of a block at the given level, descending into the other
+// blocks that have children, such as columns and toggles, as they may contain pages too
+func (w *sitemapWalker) walk(ctx context.Context, id notionapi.BlockID, parent string, level int) error {
+	if w.fetcher.blocks >= maxSitemapBlocks {
+		w.sitemap.Truncated = true
+		return nil
+	}
+	blocks, err := w.fetcher.fetchChildren(ctx, id)
+	if err != nil {
+		if id == w.root {
+			return err
+		}
+		mcputil.Logger(ctx).Warn("failed to list child pages", "block_id", id, "error", err)
+		drutil.Warn(ctx, fmt.Sprintf("the children of %s could not be listed", id))
+		return nil
+	}
+	for _, block := range blocks {
+		if len(w.sitemap.Pages) >= maxSitemapPages {
+			w.sitemap.Truncated = true
+			return nil
+		}
+		page := sitemapPage{
+			ID:         block.GetID().String(),
+			URL:        notionURL(block.GetID().String()),
+			LastEdited: editedTime(block.GetLastEditedTime()),
+			ParentID:   parent,
+			Depth:      level,
+		}
+		switch b := block.(type) {
+		case *notionapi.ChildPageBlock:
+			if w.visited[normalizeID(page.ID)] {
+				continue
+			}
+			w.visited[normalizeID(page.ID)] = true
+			page.Title, page.Type = b.ChildPage.Title, string(notionapi.ObjectTypePage)
+			w.sitemap.Pages = append(w.sitemap.Pages, page)
+			if level < w.depth && b.HasChildren {
+				if err := w.walk(ctx, b.ID, page.ID, level+1); err != nil {
+					return err
+				}
+			}
+		case *notionapi.ChildDatabaseBlock:
+			page.Title, page.Type = b.ChildDatabase.Title, string(notionapi.ObjectTypeDatabase)
+			w.sitemap.Pages = append(w.sitemap.Pages, page)
+		default:
+			if block.GetHasChildren() {
+				if err := w.walk(ctx, block.GetID(), parent, level); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// only cancellation fails the walk once the root is read
+	return ctx.Err()
+}
+
+// workspaceSitemap lists the pages and databases shared with the integration through the Search API,
+// and nests them under their parents. Those whose parent is not shared are listed at the top level.
+func (n *notion) workspaceSitemap(ctx context.Context, depth int) (*sitemap, error) {
+	var docs []drutil.Document
+	sm := &sitemap{}
+	opts := drutil.SearchOptions{Limit: 100}
+	read := 0
+	for {
+		results, err := n.SearchWithOptions(ctx, "", opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range results.Results {
+			// database rows are left to query_database
+			if !strings.HasPrefix(doc.Parent, "database:") {
+				docs = append(docs, doc)
+			}
+		}
+		mcputil.ReportProgress(ctx, float64(len(docs)), 0, fmt.Sprintf("listed %d pages", len(docs)))
+		if results.NextCursor == "" {
+			break
+		}
+		if read += len(results.Results); read >= maxSitemapSearchResults {
+			sm.Truncated = true
+			break
+		}
+		opts.Cursor = results.NextCursor
+	}
+
+	ids := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		ids[normalizeID(doc.ID)] = true
+	}
+	var roots []drutil.Document
+	children := make(map[string][]drutil.Document)
+	for _, doc := range docs {
+		if _, id, ok := strings.Cut(doc.Parent, ":"); ok && ids[normalizeID(id)] {
+			children[normalizeID(id)] = append(children[normalizeID(id)], doc)
+		} else {
+			roots = append(roots, doc)
+		}
+	}
+
+	var add func(docs []drutil.Document, parent string, level int)
+	add = func(docs []drutil.Document, parent string, level int) {
+		for _, doc := range docs {
+			if len(sm.Pages) >= maxSitemapPages {
+				sm.Truncated = true
+				return
+			}
+			page := sitemapPage{
+				ID:         doc.ID,
+				Title:      doc.Title,
+				Type:       doc.ContentType,
+				LastEdited: editedTime(&doc.LastEdited),
+				ParentID:   parent,
+				Depth:      level,
+			}
+			if doc.URL != nil {
+				page.URL = *doc.URL
+			}
+			sm.Pages = append(sm.Pages, page)
+			if level < depth {
+				add(children[normalizeID(doc.ID)], doc.ID, level+1)
+			}
+		}
+	}
+	add(roots, "", 1)
+	return sm, nil
+}
+
+// editedTime formats a last edit time as RFC3339 in UTC, or empty if unknown
+func editedTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// markdown renders the sitemap as a nested list of links, with the IDs and last edit dates
+func (sm *sitemap) markdown() string {
+	if len(sm.Pages) == 0 {
+		return "No pages found"
+	}
+	var b strings.Builder
+	for _, p := range sm.Pages {
+		icon := "📄"
+		if p.Type == string(notionapi.ObjectTypeDatabase) {
+			icon = "🗃"
+		}
+		title := p.Title
+		if title == "" {
+			title = "Untitled"
+		}
+		fmt.Fprintf(&b, "%s- %s %s `%s`", strings.Repeat("  ", p.Depth-1), icon, markdownLink(escapeMarkdown(title), p.URL), p.ID)
+		if p.LastEdited != "" {
+			fmt.Fprintf(&b, " (edited %s)", p.LastEdited)
+		}
+		b.WriteString("\n")
+	}
+	if sm.Truncated {
+		b.WriteString("\nThe sitemap was truncated, pass a root_id or a smaller depth to see the rest\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
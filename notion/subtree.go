@@ -0,0 +1,114 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/drutil"
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+const (
+	// maxFetchDepth is the maximum number of levels of child pages inlined by a fetch
+	maxFetchDepth = 3
+	// maxSubtreeSize is the maximum total size in bytes of the child pages inlined by a fetch
+	maxSubtreeSize = 200_000
+	// maxSubtreePages is the maximum number of child pages inlined by a fetch
+	maxSubtreePages = 50
+)
+
+var _ drutil.SubtreeFetcher = (*notion)(nil)
+
+// subtree is the state shared by the fetchers of the pages of a subtree
+type subtree struct {
+	// visited holds the normalized IDs of the pages already inlined, or being inlined
+	visited map[string]bool
+	// size and pages are the total size and number of the inlined pages
+	size, pages int
+	// skipped is the number of child pages not inlined because the budget was reached
+	skipped int
+}
+
+func (n *notion) MaxFetchDepth() int {
+	return maxFetchDepth
+}
+
+// FetchSubtree fetches a page with its child pages inlined as sections, up to depth levels below it
+func (n *notion) FetchSubtree(ctx context.Context, id string, depth int) (*drutil.Document, error) {
+	if depth < 0 || depth > maxFetchDepth {
+		return nil, fmt.Errorf("depth must be between 0 and %d", maxFetchDepth)
+	}
+	return n.fetch(ctx, id, depth)
+}
+
+// inlineChildPage renders a child page as a section, with its own headings nested under the section
+// heading, when the depth of the fetch and the subtree budget allow it
+func (f *pageFetcher) inlineChildPage(ctx context.Context, b *notionapi.ChildPageBlock) (string, bool) {
+	if f.subtree == nil || f.level >= f.depth {
+		return "", false
+	}
+	id := b.ID.String()
+	key := normalizeID(id)
+	if f.subtree.visited[key] {
+		return "", false
+	}
+	if f.subtree.size >= maxSubtreeSize || f.subtree.pages >= maxSubtreePages {
+		f.subtree.skipped++
+		return "", false
+	}
+	f.subtree.visited[key] = true
+	f.subtree.pages++
+
+	child := &pageFetcher{
+		client:   f.client,
+		blocks:   f.blocks,
+		reported: f.reported,
+		links:    f.links,
+		users:    f.users,
+		depth:    f.depth,
+		level:    f.level + 1,
+		subtree:  f.subtree,
+	}
+	content, err := child.fetchPageContent(ctx, b.ID)
+	f.blocks, f.reported = child.blocks, child.reported
+	if err != nil {
+		mcputil.Logger(ctx).Warn("failed to fetch child page", "page_id", id, "error", err)
+		if ctx.Err() == nil {
+			drutil.Warn(ctx, fmt.Sprintf("the child page %s could not be inlined: %v", id, err))
+		}
+		return "", false
+	}
+	f.subtree.size += len(content)
+
+	heading := "# 📄 " + markdownLink(escapeMarkdown(b.ChildPage.Title), notionURL(id))
+	return joinBlocks(heading, demoteHeadings(content)), true
+}
+
+// demoteHeadings moves the ATX headings outside of code fences one level down, up to level 6
+func demoteHeadings(text string) string {
+	lines := strings.Split(text, "\n")
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || !strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if level < 6 && (len(trimmed) == level || trimmed[level] == ' ') {
+			lines[i] = line[:len(line)-len(trimmed)] + "#" + trimmed
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// normalizeID returns the ID without dashes in lower case, as Notion accepts both forms
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
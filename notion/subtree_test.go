@@ -0,0 +1,137 @@
+package notion
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newTreeServer serves the page tree p-1 > (p-2 > p-4, p-3), where p-2 also lists p-1 in a column,
+// and a database db-1 in p-3
+func newTreeServer(t *testing.T) *notion {
+	t.Helper()
+	childPage := func(id, title string, hasChildren bool) string {
+		return fmt.Sprintf(`{"object":"block","id":%q,"type":"child_page","has_children":%t,"last_edited_time":"2025-03-01T10:00:00.000Z","child_page":{"title":%q}}`,
+			id, hasChildren, title)
+	}
+	heading := func(text string) string {
+		return fmt.Sprintf(`{"object":"block","id":"h-%s","type":"heading_1","heading_1":{"rich_text":[{"type":"text","plain_text":%q}]}}`, text, text)
+	}
+	children := map[string][]string{
+		"p-1":  {heading("Intro"), childPage("p-2", "Design", true), childPage("p-3", "Notes", true)},
+		"p-2":  {heading("Goals"), `{"object":"block","id":"col","type":"column_list","has_children":true,"column_list":{}}`},
+		"col":  {childPage("p-1", "Home", true), childPage("p-4", "Details", false)},
+		"p-3":  {`{"object":"block","id":"db-1","type":"child_database","last_edited_time":"2025-03-02T10:00:00.000Z","child_database":{"title":"Tasks"}}`},
+		"p-4":  {},
+		"db-1": {},
+	}
+	files := map[string]string{
+		"pages/p-1.json": `{"object":"page","id":"p-1","url":"https://notion.so/p-1","parent":{"type":"workspace","workspace":true},
+			"properties":{"title":{"type":"title","title":[{"type":"text","plain_text":"Home"}]}}}`,
+		"pages/p-2.json": `{"object":"page","id":"p-2","url":"https://notion.so/p-2","last_edited_time":"2025-03-01T10:00:00.000Z","parent":{"type":"page_id","page_id":"p-1"},
+			"properties":{"title":{"type":"title","title":[{"type":"text","plain_text":"Design"}]}}}`,
+		"databases/db-1.json": `{"object":"database","id":"db-1","url":"https://notion.so/db-1","parent":{"type":"page_id","page_id":"p-2"},"title":[{"type":"text","plain_text":"Tasks"}]}`,
+		"pages/row-1.json": `{"object":"page","id":"row-1","url":"https://notion.so/row-1","parent":{"type":"database_id","database_id":"db-1"},
+			"properties":{"Name":{"type":"title","title":[{"type":"text","plain_text":"Task"}]}}}`,
+	}
+	for id, blocks := range children {
+		files["blocks/"+id+".json"] = "[" + strings.Join(blocks, ",") + "]"
+	}
+	_, n := newFixtureProvider(t, fixtures(files), nil)
+	return n
+}
+
+func TestFetchSubtree(t *testing.T) {
+	n := newTreeServer(t)
+
+	doc, err := n.FetchSubtree(testContext(), "p-1", 2)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	expected := strings.Join([]string{
+		"# Intro",
+		"",
+		"# 📄 [Design](https://www.notion.so/p2)",
+		"",
+		"## Goals",
+		"",
+		"📄 [Home](https://www.notion.so/p1)",
+		"",
+		"## 📄 [Details](https://www.notion.so/p4)",
+		"",
+		"# 📄 [Notes](https://www.notion.so/p3)",
+		"",
+		"🗃 [Tasks](https://www.notion.so/db1)",
+	}, "\n")
+	if doc.Text != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", doc.Text, expected)
+	}
+
+	// child pages are links without a depth
+	doc, err = n.Fetch(testContext(), "p-1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if strings.Contains(doc.Text, "Goals") || !strings.Contains(doc.Text, "📄 [Design](https://www.notion.so/p2)") {
+		t.Errorf("unexpected text:\n%s", doc.Text)
+	}
+
+	if _, err := n.FetchSubtree(testContext(), "p-1", maxFetchDepth+1); err == nil {
+		t.Error("expected an error for a depth over the maximum")
+	}
+}
+
+func TestDemoteHeadings(t *testing.T) {
+	input := "# Title\n\n```\n# comment\n```\n\n###### Deep\n\n#hashtag\n\n  ## Indented"
+	expected := "## Title\n\n```\n# comment\n```\n\n###### Deep\n\n#hashtag\n\n  ### Indented"
+	if got := demoteHeadings(input); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	n := newTreeServer(t)
+
+	sm, err := n.sitemap(testContext(), sitemapArgs{RootID: "p-1"})
+	if err != nil {
+		t.Fatalf("sitemap: %v", err)
+	}
+	expected := strings.Join([]string{
+		"- 📄 [Design](https://www.notion.so/p2) `p-2` (edited 2025-03-01T10:00:00Z)",
+		"  - 📄 [Details](https://www.notion.so/p4) `p-4` (edited 2025-03-01T10:00:00Z)",
+		"- 📄 [Notes](https://www.notion.so/p3) `p-3` (edited 2025-03-01T10:00:00Z)",
+		"  - 🗃 [Tasks](https://www.notion.so/db1) `db-1` (edited 2025-03-02T10:00:00Z)",
+	}, "\n")
+	if got := sm.markdown(); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+	if sm.Pages[1].ParentID != "p-2" || sm.Pages[1].Depth != 2 {
+		t.Errorf("unexpected page %+v", sm.Pages[1])
+	}
+
+	// the depth limits the levels walked
+	if sm, err := n.sitemap(testContext(), sitemapArgs{RootID: "p-1", Depth: 1}); err != nil || len(sm.Pages) != 2 {
+		t.Errorf("expected the top level pages, got %v %+v", err, sm)
+	}
+
+	if _, err := n.sitemap(testContext(), sitemapArgs{RootID: "missing"}); err == nil {
+		t.Error("expected an error for a missing root")
+	}
+}
+
+func TestWorkspaceSitemap(t *testing.T) {
+	n := newTreeServer(t)
+
+	sm, err := n.sitemap(testContext(), sitemapArgs{})
+	if err != nil {
+		t.Fatalf("sitemap: %v", err)
+	}
+	expected := strings.Join([]string{
+		"- 📄 [Home](https://notion.so/p-1) `p-1`",
+		"  - 📄 [Design](https://notion.so/p-2) `p-2` (edited 2025-03-01T10:00:00Z)",
+		"    - 🗃 [Tasks](https://notion.so/db-1) `db-1`",
+	}, "\n")
+	if got := sm.markdown(); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,458 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+// searchFilterTransport removes the empty filter that notionapi.SearchRequest always sends and the Search API
+// rejects, so that searches without a type return both pages and databases
+type searchFilterTransport struct {
+	base http.RoundTripper
+}
+
+func (t searchFilterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/search") || req.Body == nil {
+		return base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err == nil {
+		var filter struct{ Value, Property string }
+		if json.Unmarshal(fields["filter"], &filter) == nil && filter.Value == "" {
+			delete(fields, "filter")
+			if b, err := json.Marshal(fields); err == nil {
+				body = b
+			}
+		}
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return base.RoundTrip(req)
+}
+
+// baseURLTransport sends the requests to another base URL than the api.notion.com one of notionapi,
+// such as a proxy or a stand-in server in tests
+type baseURLTransport struct {
+	base http.RoundTripper
+	url  *url.URL
+}
+
+func (t baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.url.Scheme
+	req.URL.Host = t.url.Host
+	req.URL.Path = strings.TrimSuffix(t.url.Path, "/") + req.URL.Path
+	req.URL.RawPath = ""
+	req.Host = t.url.Host
+	return base.RoundTrip(req)
+}
+
+type nullNumbersKey struct{}
+
+// nullNumbers holds the number properties that are null in the pages returned by the API, that notionapi decodes
+// as 0, by page ID and property name
+type nullNumbers struct {
+	mu    sync.Mutex
+	props map[[2]string]bool
+}
+
+// withNullNumbers returns a context that records the null numbers of the pages fetched with it
+func withNullNumbers(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(nullNumbersKey{}).(*nullNumbers); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, nullNumbersKey{}, &nullNumbers{props: make(map[[2]string]bool)})
+}
+
+// isNullNumber returns whether the number, or number formula or rollup, property of the page was null
+func isNullNumber(ctx context.Context, pageID notionapi.ObjectID, name string) bool {
+	n, ok := ctx.Value(nullNumbersKey{}).(*nullNumbers)
+	if !ok {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.props[[2]string{normalizeID(pageID.String()), name}]
+}
+
+// nullNumberTransport records the null number properties of the pages in the responses,
+// for the requests whose context is from withNullNumbers
+type nullNumberTransport struct {
+	base http.RoundTripper
+}
+
+func (t nullNumberTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	n, ok := req.Context().Value(nullNumbersKey{}).(*nullNumbers)
+	resp, err := base.RoundTrip(req)
+	if !ok || err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	type page struct {
+		Object     string                     `json:"object"`
+		ID         string                     `json:"id"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var object struct {
+		page
+		Results []page `json:"results"`
+	}
+	if json.Unmarshal(body, &object) != nil {
+		return resp, nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, p := range append(object.Results, object.page) {
+		if p.Object != string(notionapi.ObjectTypePage) {
+			continue
+		}
+		for name, value := range p.Properties {
+			if nullNumber(value) {
+				n.props[[2]string{normalizeID(p.ID), name}] = true
+			}
+		}
+	}
+	return resp, nil
+}
+
+// nullNumber returns whether a property value is a null number, or a formula or rollup that evaluates to one
+func nullNumber(value json.RawMessage) bool {
+	type number struct {
+		Type   string   `json:"type"`
+		Number *float64 `json:"number"`
+	}
+	var p struct {
+		number
+		Formula *number `json:"formula"`
+		Rollup  *number `json:"rollup"`
+	}
+	if json.Unmarshal(value, &p) != nil {
+		return false
+	}
+	switch p.Type {
+	case "number":
+		return p.Number == nil
+	case "formula":
+		return p.Formula != nil && p.Formula.Type == "number" && p.Formula.Number == nil
+	case "rollup":
+		return p.Rollup != nil && p.Rollup.Type == "number" && p.Rollup.Number == nil
+	}
+	return false
+}
+
+const (
+	// requestsPerSecond is the average request rate Notion allows an integration
+	requestsPerSecond = 3
+	// requestBurst is the number of requests a token that was idle can send at once
+	requestBurst = 3
+	// maxAttempts is the number of times a rate limited or failed request is sent
+	maxAttempts = 5
+	// minBackoff and maxBackoff bound the exponential backoff between attempts
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// limiterIdleTime is the time after which the rate limiter of an unused token is dropped
+	limiterIdleTime = 10 * time.Minute
+	// backgroundRequestsPerSecond is the request rate of the background work of a token, such as index crawls
+	backgroundRequestsPerSecond = 1
+	// interactiveReserve is the number of requests of the budget of a token that background requests leave to
+	// the interactive ones, so that a crawl never delays a tool call
+	interactiveReserve = 2
+)
+
+type backgroundKey struct{}
+
+// withBackgroundRequests marks the requests sent with the context as background work, that has its own lower
+// request budget and only uses the budget of the token when the interactive requests leave it unused
+func withBackgroundRequests(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// retryTransport keeps the requests of each token under the Notion rate limit, and retries the requests that
+// are rate limited or fail with a server error, after their Retry-After delay or a jittered exponential backoff.
+// Server errors are only retried for requests that do not change the workspace.
+type retryTransport struct {
+	base http.RoundTripper
+	// limiters holds the rate limiter of each token, requests are not rate limited if nil
+	limiters *tokenLimiters
+	// backoff is the delay before the first retry, defaults to minBackoff
+	backoff time.Duration
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	backoff := t.backoff
+	if backoff == 0 {
+		backoff = minBackoff
+	}
+	lim := t.limiters.get(req.Header.Get("Authorization"))
+
+	ctx := req.Context()
+	wait := lim.wait
+	if background, _ := ctx.Value(backgroundKey{}).(bool); background {
+		wait = lim.waitBackground
+	}
+	for attempt := 1; ; attempt++ {
+		if err := wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if attempt == maxAttempts || !retryable(req, resp, err) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		// the jitter spreads the retries of concurrent requests
+		delay := min(backoff<<(attempt-1), maxBackoff)
+		delay = delay/2 + rand.N(delay/2+1)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				// the other requests of the token wait as well
+				lim.pause(delay)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		mcputil.Logger(ctx).Debug("retrying notion request", "path", req.URL.Path, "attempt", attempt, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// retryable returns whether the request can be sent again after its response or error
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		// rate limited requests were not processed
+		return true
+	}
+	readOnly := req.Method == http.MethodGet ||
+		req.Method == http.MethodPost && (strings.HasSuffix(req.URL.Path, "/search") || strings.HasSuffix(req.URL.Path, "/query"))
+	if !readOnly {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tokenLimiters holds a rate limiter per token, so that each user of the server has its own request budget
+type tokenLimiters struct {
+	mu       sync.Mutex
+	limiters map[[sha256.Size]byte]*limiter
+	pruned   time.Time
+}
+
+func newTokenLimiters() *tokenLimiters {
+	return &tokenLimiters{limiters: make(map[[sha256.Size]byte]*limiter)}
+}
+
+// get returns the rate limiter of the token, the tokens are only kept hashed
+func (l *tokenLimiters) get(token string) *limiter {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > limiterIdleTime {
+		l.pruned = now
+		maps.DeleteFunc(l.limiters, func(_ [sha256.Size]byte, lim *limiter) bool {
+			return lim.idle(now)
+		})
+	}
+	key := sha256.Sum256([]byte(token))
+	lim, ok := l.limiters[key]
+	if !ok {
+		lim = &limiter{
+			tokens:     requestBurst,
+			last:       now,
+			background: &limiter{tokens: 1, last: now},
+		}
+		l.limiters[key] = lim
+	}
+	return lim
+}
+
+// limiter is a token bucket refilled at requestsPerSecond, that can be paused when Notion rate limits the token
+type limiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	paused time.Time
+	// background is the bucket of the background requests of the token, refilled at backgroundRequestsPerSecond
+	background *limiter
+}
+
+// wait takes a request from the bucket, waiting until it has one or the pause is over
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(requestBurst, l.tokens+now.Sub(l.last).Seconds()*requestsPerSecond)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / requestsPerSecond * float64(time.Second))
+	}
+	delay = max(delay, l.paused.Sub(now))
+	l.mu.Unlock()
+	return sleep(ctx, delay)
+}
+
+// waitBackground waits for the background budget of the token, then takes a request from the bucket once it
+// holds more than the interactiveReserve, so that background requests yield to the interactive ones
+func (l *limiter) waitBackground(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	b := l.background
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(1, b.tokens+now.Sub(b.last).Seconds()*backgroundRequestsPerSecond)
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / backgroundRequestsPerSecond * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if err := sleep(ctx, delay); err != nil {
+		return err
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(requestBurst, l.tokens+now.Sub(l.last).Seconds()*requestsPerSecond)
+		l.last = now
+		delay := l.paused.Sub(now)
+		if missing := interactiveReserve + 1 - l.tokens; missing > 0 {
+			delay = max(delay, time.Duration(missing/requestsPerSecond*float64(time.Second)))
+		}
+		if delay <= 0 {
+			l.tokens--
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		l.mu.Unlock()
+		// the interactive requests may take the refilled budget first, in which case this waits again
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// pause delays the requests of the token by d
+func (l *limiter) pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
+
+// idle returns whether the bucket is full and not paused, so that it can be dropped
+func (l *limiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.last) > limiterIdleTime && now.After(l.paused)
+}
@@ -0,0 +1,166 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var attempts []string
+	status := map[string][]int{
+		"/v1/search":          {http.StatusTooManyRequests, http.StatusTooManyRequests},
+		"/v1/pages/page-1":    {http.StatusServiceUnavailable},
+		"/v1/blocks/block-1":  {http.StatusServiceUnavailable},
+		"/v1/users/forever-1": {http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		attempts = append(attempts, r.Method+" "+r.URL.Path+" "+string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if codes := status[r.URL.Path]; len(codes) > 0 {
+			status[r.URL.Path] = codes[1:]
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(codes[0])
+			io.WriteString(w, `{"object":"error","status":429,"code":"rate_limited","message":"slow down"}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/search":
+			io.WriteString(w, `{"object":"list","results":[],"has_more":false}`)
+		case "/v1/pages/page-1":
+			io.WriteString(w, `{"object":"page","id":"page-1","properties":{}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"object":"error","status":404,"code":"object_not_found","message":"not found"}`)
+		}
+	}))
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	n := &notion{http: &http.Client{Transport: rewriteTransport{target: target}}}
+	client, err := n.getClient(testContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// rate limited requests are sent again with their body
+	if _, err := client.Search.Do(ctx, &notionapi.SearchRequest{Query: "q"}); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(attempts) != 3 || attempts[0] != attempts[2] || !strings.Contains(attempts[2], `"query":"q"`) {
+		t.Errorf("unexpected attempts %q", attempts)
+	}
+
+	// server errors are retried for reads only
+	attempts = nil
+	if _, err := client.Page.Get(ctx, "page-1"); err != nil || len(attempts) != 2 {
+		t.Errorf("expected a retried read, got %v %q", err, attempts)
+	}
+	attempts = nil
+	if _, err := client.Block.Delete(ctx, "block-1"); err == nil || len(attempts) != 1 {
+		t.Errorf("expected a single delete attempt, got %v %q", err, attempts)
+	}
+
+	// retries are bounded
+	attempts = nil
+	var rateLimited *notionapi.RateLimitedError
+	if _, err := client.User.Get(ctx, "forever-1"); !errors.As(err, &rateLimited) || len(attempts) != maxAttempts {
+		t.Errorf("expected a rate limited error after %d attempts, got %v %q", maxAttempts, err, attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for input, expected := range map[string]time.Duration{
+		"0":  0,
+		"3":  3 * time.Second,
+		"-1": -1,
+		"":   -1,
+		"x":  -1,
+		time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat): 0,
+	} {
+		d, ok := parseRetryAfter(input)
+		if !ok {
+			d = -1
+		}
+		if d != expected {
+			t.Errorf("%q: got %v, expected %v", input, d, expected)
+		}
+	}
+}
+
+func TestTokenLimiters(t *testing.T) {
+	limiters := newTokenLimiters()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	later, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// a token can send a burst of requests, then waits for its budget to refill
+	lim := limiters.get("Bearer a")
+	for range requestBurst {
+		if err := lim.wait(ctx); err != nil {
+			t.Fatalf("expected a request of the burst, got %v", err)
+		}
+	}
+	if err := lim.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the budget to be spent, got %v", err)
+	}
+
+	// other tokens have their own budget, and the same token its paused one
+	if err := limiters.get("Bearer b").wait(later); err != nil {
+		t.Errorf("expected a separate budget, got %v", err)
+	}
+	limiters.get("Bearer b").pause(time.Minute)
+	if err := limiters.get("Bearer b").wait(later); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a paused token, got %v", err)
+	}
+}
+
+func TestBackgroundLimiter(t *testing.T) {
+	timeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	ctx := timeout()
+	// a background request leaves the reserve of the budget to the interactive requests
+	lim := newTokenLimiters().get("Bearer a")
+	if err := lim.waitBackground(ctx); err != nil {
+		t.Fatalf("expected a background request, got %v", err)
+	}
+	for range requestBurst - 1 {
+		if err := lim.wait(ctx); err != nil {
+			t.Fatalf("expected the reserved interactive requests, got %v", err)
+		}
+	}
+
+	// background requests have their own lower budget, even when the token one is full
+	ctx = timeout()
+	lim = newTokenLimiters().get("Bearer a")
+	if err := lim.waitBackground(ctx); err != nil {
+		t.Fatalf("expected a background request, got %v", err)
+	}
+	if err := lim.waitBackground(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the background budget to be spent, got %v", err)
+	}
+
+	// and wait while interactive requests use the budget
+	ctx = timeout()
+	lim = newTokenLimiters().get("Bearer a")
+	if err := lim.wait(ctx); err != nil {
+		t.Fatalf("expected an interactive request, got %v", err)
+	}
+	if err := lim.waitBackground(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the background request to yield, got %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+type createPageArgs struct {
+	ParentID     string            `json:"parent_id" jsonschema:"The ID of the parent page or database"`
+	Title        string            `json:"title" jsonschema:"The title of the new page"`
+	Properties   map[string]string `json:"properties,omitempty" jsonschema:"Property values by property name, only when the parent is a database. Values use the formats of update_page_properties"`
+	Content      string            `json:"content,omitempty" jsonschema:"The content of the page as Markdown"`
+	ConfirmToken string            `json:"confirm_token,omitempty" jsonschema:"Token returned by a previous call, once the user confirmed the operation"`
+}
+
+type appendContentArgs struct {
+	PageID       string `json:"page_id" jsonschema:"The ID of the page, or of a block that can have children such as a toggle"`
+	Content      string `json:"content" jsonschema:"The content to append as Markdown"`
+	ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"Token returned by a previous call, once the user confirmed the operation"`
+}
+
+type updatePropertiesArgs struct {
+	PageID       string            `json:"page_id" jsonschema:"The ID of the page, usually a row of a database"`
+	Properties   map[string]string `json:"properties" jsonschema:"New values by property name: text, a number, true or false for checkboxes, an option name for selects and statuses, comma separated option names for multi-selects, and YYYY-MM-DD or RFC 3339 dates, with an optional /end for date ranges"`
+	ConfirmToken string            `json:"confirm_token,omitempty" jsonschema:"Token returned by a previous call, once the user confirmed the operation"`
+}
+
+type addCommentArgs struct {
+	PageID       string `json:"page_id,omitempty" jsonschema:"The ID of the page to start a discussion on"`
+	DiscussionID string `json:"discussion_id,omitempty" jsonschema:"The ID of an existing discussion to reply to, instead of a page"`
+	Text         string `json:"text" jsonschema:"The comment, with inline Markdown formatting and links"`
+	ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"Token returned by a previous call, once the user confirmed the operation"`
+}
+
+// writeResult identifies the object a write tool created or updated
+type writeResult struct {
+	ID  string `json:"id"`
+	URL string `json:"url,omitempty"`
+}
+
+// addWriteTools adds the tools that modify the workspace. They are all annotated as destructive,
+// even those that only add content, so that a single policy on the annotation gates all the changes,
+// and they ask the user to confirm each call.
+func (n *notion) addWriteTools(server *mcp.Server) {
+	confirmer := mcputil.NewConfirmer()
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "create_page",
+		Description: "Create a Notion page under a parent page, or as a row of a database, with optional Markdown content",
+		Annotations: mcputil.WriteTool("Create page", true, false, true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args createPageArgs) (*mcp.CallToolResult, *writeResult, error) {
+		summary := fmt.Sprintf("Create the page %q under %s", args.Title, args.ParentID)
+		if result, ok := confirmer.Confirm(ctx, req, summary); !ok {
+			return result, nil, nil
+		}
+		page, err := n.createPage(ctx, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create page: %w", err)
+		}
+		return textResult("Created page %s", page.URL), page, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "append_content",
+		Description: "Append Markdown content to the end of a Notion page",
+		Annotations: mcputil.WriteTool("Append content", true, false, true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args appendContentArgs) (*mcp.CallToolResult, *writeResult, error) {
+		summary := fmt.Sprintf("Append to the page %s:\n\n%s", args.PageID, args.Content)
+		if result, ok := confirmer.Confirm(ctx, req, summary); !ok {
+			return result, nil, nil
+		}
+		count, err := n.appendContent(ctx, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("append content: %w", err)
+		}
+		return textResult("Appended %d blocks to %s", count, args.PageID), &writeResult{ID: args.PageID}, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "update_page_properties",
+		Description: "Update property values of a Notion page, such as the status or due date of a database row. Other properties are left unchanged",
+		Annotations: mcputil.WriteTool("Update page properties", true, true, true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args updatePropertiesArgs) (*mcp.CallToolResult, *writeResult, error) {
+		var changes []string
+		for _, name := range slices.Sorted(maps.Keys(args.Properties)) {
+			changes = append(changes, fmt.Sprintf("%s to %q", name, args.Properties[name]))
+		}
+		summary := fmt.Sprintf("Set %s on the page %s", strings.Join(changes, ", "), args.PageID)
+		if result, ok := confirmer.Confirm(ctx, req, summary); !ok {
+			return result, nil, nil
+		}
+		page, err := n.updateProperties(ctx, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("update page properties: %w", err)
+		}
+		return textResult("Updated page %s", page.URL), page, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "add_comment",
+		Description: "Comment on a Notion page, or reply to an existing discussion",
+		Annotations: mcputil.WriteTool("Add comment", true, false, true),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args addCommentArgs) (*mcp.CallToolResult, *writeResult, error) {
+		target := "the page " + args.PageID
+		if args.DiscussionID != "" {
+			target = "the discussion " + args.DiscussionID
+		}
+		if result, ok := confirmer.Confirm(ctx, req, fmt.Sprintf("Comment on %s: %s", target, args.Text)); !ok {
+			return result, nil, nil
+		}
+		comment, err := n.addComment(ctx, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("add comment: %w", err)
+		}
+		return textResult("Added comment %s", comment.ID), comment, nil
+	})
+}
+
+// createPage creates the page with the first blocks of its content, and appends the others
+func (n *notion) createPage(ctx context.Context, args createPageArgs) (*writeResult, error) {
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get notion client: %w", err)
+	}
+
+	req := &notionapi.PageCreateRequest{Properties: notionapi.Properties{}}
+	titleProperty := "title"
+	db, err := client.Database.Get(ctx, notionapi.DatabaseID(args.ParentID))
+	switch {
+	case err == nil:
+		req.Parent = notionapi.Parent{Type: notionapi.ParentTypeDatabaseID, DatabaseID: notionapi.DatabaseID(db.ID)}
+		types := make(map[string]string, len(db.Properties))
+		for name, config := range db.Properties {
+			types[name] = string(config.GetType())
+			if config.GetType() == notionapi.PropertyConfigTypeTitle {
+				titleProperty = name
+			}
+		}
+		if req.Properties, err = propertyValues(types, args.Properties); err != nil {
+			return nil, err
+		}
+	case isDatabaseError(err):
+		if len(args.Properties) > 0 {
+			return nil, fmt.Errorf("properties can only be set on pages of a database, %s is not a database", args.ParentID)
+		}
+		req.Parent = notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: notionapi.PageID(args.ParentID)}
+	default:
+		return nil, fmt.Errorf("get parent database: %w", err)
+	}
+	if args.Title != "" || req.Properties[titleProperty] == nil {
+		req.Properties[titleProperty] = notionapi.TitleProperty{Title: plainRichText(args.Title)}
+	}
+
+	blocks := markdownToBlocks(args.Content)
+	req.Children = blocks[:min(len(blocks), maxAppendBlocks)]
+	page, err := client.Page.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("create page api: %w", err)
+	}
+	if err := appendBlocks(ctx, client, notionapi.BlockID(page.ID), blocks[len(req.Children):]); err != nil {
+		return nil, fmt.Errorf("created page %s without all its content: %w", page.URL, err)
+	}
+	return &writeResult{ID: page.ID.String(), URL: page.URL}, nil
+}
+
+// appendContent appends the Markdown content, and returns the number of top level blocks it was converted to
+func (n *notion) appendContent(ctx context.Context, args appendContentArgs) (int, error) {
+	blocks := markdownToBlocks(args.Content)
+	if len(blocks) == 0 {
+		return 0, errors.New("content is empty")
+	}
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get notion client: %w", err)
+	}
+	if err := appendBlocks(ctx, client, notionapi.BlockID(args.PageID), blocks); err != nil {
+		return 0, err
+	}
+	return len(blocks), nil
+}
+
+// appendBlocks appends the blocks in requests of at most maxAppendBlocks blocks
+func appendBlocks(ctx context.Context, client *notionapi.Client, id notionapi.BlockID, blocks []notionapi.Block) error {
+	for start := 0; start < len(blocks); start += maxAppendBlocks {
+		end := min(start+maxAppendBlocks, len(blocks))
+		if _, err := client.Block.AppendChildren(ctx, id, &notionapi.AppendBlockChildrenRequest{
+			Children: blocks[start:end],
+		}); err != nil {
+			return fmt.Errorf("append block children api: %w", err)
+		}
+		mcputil.ReportProgress(ctx, float64(end), float64(len(blocks)), fmt.Sprintf("appended %d blocks", end))
+	}
+	return nil
+}
+
+// updateProperties converts the values after the current property types of the page, and updates them
+func (n *notion) updateProperties(ctx context.Context, args updatePropertiesArgs) (*writeResult, error) {
+	if len(args.Properties) == 0 {
+		return nil, errors.New("no properties to update")
+	}
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get notion client: %w", err)
+	}
+	page, err := client.Page.Get(ctx, notionapi.PageID(args.PageID))
+	if err != nil {
+		return nil, fmt.Errorf("get page: %w", err)
+	}
+	// the client always sends the archived field, which would restore the page
+	if page.Archived {
+		return nil, fmt.Errorf("page %s is archived", args.PageID)
+	}
+	types := make(map[string]string, len(page.Properties))
+	for name, p := range page.Properties {
+		types[name] = string(p.GetType())
+	}
+	properties, err := propertyValues(types, args.Properties)
+	if err != nil {
+		return nil, err
+	}
+	page, err = client.Page.Update(ctx, notionapi.PageID(args.PageID), &notionapi.PageUpdateRequest{Properties: properties})
+	if err != nil {
+		return nil, fmt.Errorf("update page api: %w", err)
+	}
+	return &writeResult{ID: page.ID.String(), URL: page.URL}, nil
+}
+
+func (n *notion) addComment(ctx context.Context, args addCommentArgs) (*writeResult, error) {
+	if (args.PageID == "") == (args.DiscussionID == "") {
+		return nil, errors.New("exactly one of page_id and discussion_id is required")
+	}
+	if strings.TrimSpace(args.Text) == "" {
+		return nil, errors.New("text is empty")
+	}
+	client, err := n.getClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get notion client: %w", err)
+	}
+	req := &notionapi.CommentCreateRequest{
+		DiscussionID: notionapi.DiscussionID(args.DiscussionID),
+		RichText:     markdownRichText(args.Text),
+	}
+	if args.PageID != "" {
+		req.Parent = notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: notionapi.PageID(args.PageID)}
+	}
+	comment, err := client.Comment.Create(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("create comment api: %w", err)
+	}
+	return &writeResult{ID: comment.ID.String()}, nil
+}
+
+// propertyValues converts the values to the given property types, by property name
+func propertyValues(types, values map[string]string) (notionapi.Properties, error) {
+	properties := make(notionapi.Properties, len(values))
+	for name, value := range values {
+		typ, ok := types[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown property %q, expected one of %s", name, strings.Join(slices.Sorted(maps.Keys(types)), ", "))
+		}
+		p, err := propertyFromString(typ, value)
+		if err != nil {
+			return nil, fmt.Errorf("property %q: %w", name, err)
+		}
+		properties[name] = p
+	}
+	return properties, nil
+}
+
+// propertyFromString converts a value to a property of the type
+func propertyFromString(typ, value string) (notionapi.Property, error) {
+	switch notionapi.PropertyConfigType(typ) {
+	case notionapi.PropertyConfigTypeTitle:
+		return notionapi.TitleProperty{Title: plainRichText(value)}, nil
+	case notionapi.PropertyConfigTypeRichText:
+		return notionapi.RichTextProperty{RichText: plainRichText(value)}, nil
+	case notionapi.PropertyConfigTypeURL:
+		return notionapi.URLProperty{URL: value}, nil
+	case notionapi.PropertyConfigTypeEmail:
+		return notionapi.EmailProperty{Email: value}, nil
+	case notionapi.PropertyConfigTypePhoneNumber:
+		return notionapi.PhoneNumberProperty{PhoneNumber: value}, nil
+	case notionapi.PropertyConfigTypeNumber:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return notionapi.NumberProperty{Number: v}, nil
+	case notionapi.PropertyConfigTypeCheckbox:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkbox value %q, expected true or false", value)
+		}
+		return notionapi.CheckboxProperty{Checkbox: v}, nil
+	case notionapi.PropertyConfigTypeSelect, notionapi.PropertyConfigStatus:
+		if value == "" {
+			return nil, fmt.Errorf("an option name is required")
+		}
+		if typ == string(notionapi.PropertyConfigStatus) {
+			return notionapi.StatusProperty{Status: notionapi.Option{Name: value}}, nil
+		}
+		return notionapi.SelectProperty{Select: notionapi.Option{Name: value}}, nil
+	case notionapi.PropertyConfigTypeMultiSelect:
+		options := []notionapi.Option{}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				options = append(options, notionapi.Option{Name: name})
+			}
+		}
+		return notionapi.MultiSelectProperty{MultiSelect: options}, nil
+	case notionapi.PropertyConfigTypeDate:
+		start, end, _ := strings.Cut(value, "/")
+		dates := []string{start}
+		if end != "" {
+			dates = append(dates, end)
+		}
+		for _, d := range dates {
+			if _, err := time.Parse(time.DateOnly, d); err != nil {
+				if _, err := time.Parse(time.RFC3339, d); err != nil {
+					return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or an RFC 3339 time", d)
+				}
+			}
+		}
+		return dateProperty{start: start, end: end}, nil
+	}
+	return nil, fmt.Errorf("%s properties cannot be set", typ)
+}
+
+// dateProperty is a date property value. The Date type of the client always sends a time,
+// so dates without one would show as midnight UTC.
+type dateProperty struct {
+	start, end string
+}
+
+func (p dateProperty) GetID() string                   { return "" }
+func (p dateProperty) GetType() notionapi.PropertyType { return notionapi.PropertyTypeDate }
+
+func (p dateProperty) MarshalJSON() ([]byte, error) {
+	date := map[string]string{"start": p.start}
+	if p.end != "" {
+		date["end"] = p.end
+	}
+	return json.Marshal(map[string]any{"date": date})
+}
+
+func textResult(format string, args ...any) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf(format, args...)}},
+	}
+}
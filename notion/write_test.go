@@ -0,0 +1,357 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jomei/notionapi"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+	"github.com/pomerium/mcp-servers/notion/notiontest"
+)
+
+// describeBlocks summarizes the type, text and children of blocks, one per line
+func describeBlocks(t *testing.T, blocks []notionapi.Block, indent string) string {
+	t.Helper()
+	var lines []string
+	for _, block := range blocks {
+		data, err := json.Marshal(block)
+		if err != nil {
+			t.Fatalf("marshal block: %v", err)
+		}
+		var raw map[string]any
+		json.Unmarshal(data, &raw)
+		typ := raw["type"].(string)
+		content, _ := raw[typ].(map[string]any)
+		line := indent + typ
+		if text, ok := content["rich_text"].([]any); ok {
+			line += ": " + describeRichText(text)
+		}
+		if language, ok := content["language"]; ok {
+			line += " (" + language.(string) + ")"
+		}
+		if checked, ok := content["checked"]; ok {
+			line += fmt.Sprintf(" checked=%v", checked)
+		}
+		if expression, ok := content["expression"]; ok {
+			line += ": " + expression.(string)
+		}
+		if cells, ok := content["cells"].([]any); ok {
+			var texts []string
+			for _, cell := range cells {
+				texts = append(texts, describeRichText(cell.([]any)))
+			}
+			line += ": " + strings.Join(texts, " | ")
+		}
+		if header, ok := content["has_column_header"]; ok {
+			line += fmt.Sprintf(" header=%v", header)
+		}
+		lines = append(lines, line)
+
+		var children []notionapi.Block
+		switch b := block.(type) {
+		case *notionapi.BulletedListItemBlock:
+			children = b.BulletedListItem.Children
+		case *notionapi.NumberedListItemBlock:
+			children = b.NumberedListItem.Children
+		case *notionapi.ToDoBlock:
+			children = b.ToDo.Children
+		case *notionapi.TableBlock:
+			children = b.Table.Children
+		}
+		if len(children) > 0 {
+			lines = append(lines, describeBlocks(t, children, indent+"  "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeRichText writes annotated runs as [b,i,s,c,link]text
+func describeRichText(runs []any) string {
+	var b strings.Builder
+	for _, r := range runs {
+		run := r.(map[string]any)
+		text := run["text"].(map[string]any)
+		var styles []string
+		if annotations, ok := run["annotations"].(map[string]any); ok {
+			for _, s := range []struct{ key, short string }{{"bold", "b"}, {"italic", "i"}, {"strikethrough", "s"}, {"code", "c"}} {
+				if annotations[s.key] == true {
+					styles = append(styles, s.short)
+				}
+			}
+		}
+		if link, ok := text["link"].(map[string]any); ok {
+			styles = append(styles, "link="+link["url"].(string))
+		}
+		if len(styles) > 0 {
+			b.WriteString("[" + strings.Join(styles, ",") + "]")
+		}
+		b.WriteString(text["content"].(string))
+	}
+	return b.String()
+}
+
+func TestMarkdownToBlocks(t *testing.T) {
+	input := strings.Join([]string{
+		"# Weekly sync",
+		"",
+		"Notes from **Monday**, see [the plan](https://example.com/plan).",
+		"Second line",
+		"",
+		"1. First",
+		"2. Second",
+		"   - Nested",
+		"     - Deeper",
+		"       - Deepest",
+		"- [ ] Open task",
+		"- [x] Done task",
+		"",
+		"> Quoted",
+		"> text",
+		"",
+		"```go",
+		"func main() {}",
+		"```",
+		"",
+		"$$E = mc^2$$",
+		"",
+		"| Owner | Task \\| area |",
+		"| --- | --- |",
+		"| Ana | Docs<br>API |",
+		"",
+		"---",
+		"#### Small heading",
+	}, "\n")
+
+	expected := strings.Join([]string{
+		"heading_1: Weekly sync",
+		"paragraph: Notes from [b]Monday, see [link=https://example.com/plan]the plan.\nSecond line",
+		"numbered_list_item: First",
+		"numbered_list_item: Second",
+		"  bulleted_list_item: Nested",
+		"    bulleted_list_item: Deeper",
+		"    bulleted_list_item: Deepest",
+		"to_do: Open task checked=false",
+		"to_do: Done task checked=true",
+		"quote: Quoted\ntext",
+		"code: func main() {} (go)",
+		"equation: E = mc^2",
+		"table header=true",
+		"  table_row: Owner | Task | area",
+		"  table_row: Ana | Docs\nAPI",
+		"divider",
+		"heading_3: Small heading",
+	}, "\n")
+	if got := describeBlocks(t, markdownToBlocks(input), ""); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestMarkdownRichText(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain text":                    "plain text",
+		"**bold** and *italic*":         "[b]bold and [i]italic",
+		"***both*** ~~gone~~":           "[b,i]both [s]gone",
+		"run `go test` now":             "run [c]go test now",
+		"snake_case_name and _em_":      "snake_case_name and [i]em",
+		"2 * 3 * 4":                     "2 * 3 * 4",
+		`escaped \*stars\* and \[x\]`:   "escaped *stars* and [x]",
+		"[**bold link**](https://x.io)": "[b,link=https://x.io]bold link",
+		"unclosed **bold":               "unclosed **bold",
+		"[not a link] (x)":              "[not a link] (x)",
+	} {
+		runs, _ := json.Marshal(markdownRichText(input))
+		var raw []any
+		json.Unmarshal(runs, &raw)
+		if got := describeRichText(raw); got != expected {
+			t.Errorf("%q: got %q, expected %q", input, got, expected)
+		}
+	}
+
+	long := strings.Repeat("é", maxRichTextLength+10)
+	if runs := plainRichText(long); len(runs) != 2 || len([]rune(runs[0].Text.Content)) != maxRichTextLength {
+		t.Errorf("expected long text to be split, got %d runs", len(runs))
+	}
+}
+
+// newWriteServer serves the test database with a row, a page with a discussion and an archived page
+func newWriteServer(t *testing.T) (*notion, *notiontest.Server) {
+	t.Helper()
+	srv, n := newFixtureProvider(t, fixtures(map[string]string{
+		"databases/db-1.json": testDatabase,
+		"pages/row-1.json":    testRow("row-1", "Outage", 1),
+		"pages/page-1.json": `{"object":"page","id":"page-1","url":"https://notion.so/page-1","properties":{
+			"title":{"type":"title","title":[{"type":"text","plain_text":"Notes"}]}}}`,
+		"pages/archived.json": `{"object":"page","id":"archived","archived":true,"properties":{}}`,
+		"comments/page-1.json": `[{"object":"comment","id":"c-1","discussion_id":"discussion-1",
+			"rich_text":[{"type":"text","plain_text":"Thoughts?"}]}]`,
+	}), nil)
+	return n, srv
+}
+
+func TestCreatePage(t *testing.T) {
+	n, srv := newWriteServer(t)
+
+	var content []string
+	for i := range maxAppendBlocks + 50 {
+		content = append(content, fmt.Sprintf("Paragraph %d", i))
+	}
+	page, err := n.createPage(testContext(), createPageArgs{
+		ParentID:   "db-1",
+		Title:      "Outage",
+		Properties: map[string]string{"Severity": "3", "Tags": "api, db", "Date": "2025-03-01/2025-03-02", "Resolved": "false"},
+		Content:    strings.Join(content, "\n\n"),
+	})
+	if err != nil {
+		t.Fatalf("create page: %v", err)
+	}
+	if page.ID != "created-1" || page.URL != "https://www.notion.so/created1" {
+		t.Errorf("unexpected result %+v", page)
+	}
+
+	expected := []string{"GET /v1/databases/db-1", "POST /v1/pages", "PATCH /v1/blocks/created-1/children"}
+	if requests := srv.Requests(); !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("expected to get the database, create the page and append the rest, got %v", requests)
+	}
+	create := decodeBodies(t, srv.Bodies("POST /v1/pages"))[0]
+	if expected := map[string]any{"type": "database_id", "database_id": "db-1"}; !reflect.DeepEqual(create["parent"], expected) {
+		t.Errorf("unexpected parent %v", create["parent"])
+	}
+	properties := create["properties"].(map[string]any)
+	for name, expected := range map[string]string{
+		"Name":     `{"title":[{"text":{"content":"Outage"},"type":"text"}]}`,
+		"Severity": `{"number":3}`,
+		"Tags":     `{"multi_select":[{"name":"api"},{"name":"db"}]}`,
+		"Date":     `{"date":{"end":"2025-03-02","start":"2025-03-01"}}`,
+		"Resolved": `{"checkbox":false}`,
+	} {
+		if got, _ := json.Marshal(properties[name]); string(got) != expected {
+			t.Errorf("property %s: got %s, expected %s", name, got, expected)
+		}
+	}
+	if children := create["children"].([]any); len(children) != maxAppendBlocks {
+		t.Errorf("expected the first %d blocks in the create request, got %d", maxAppendBlocks, len(children))
+	}
+	if appended := decodeBodies(t, srv.Bodies("PATCH /v1/blocks/created-1/children"))[0]; len(appended["children"].([]any)) != 50 {
+		t.Errorf("expected the remaining 50 blocks to be appended, got %d", len(appended["children"].([]any)))
+	}
+}
+
+func TestCreateSubpage(t *testing.T) {
+	n, srv := newWriteServer(t)
+
+	if _, err := n.createPage(testContext(), createPageArgs{ParentID: "page-1", Title: "Notes", Properties: map[string]string{"Status": "Done"}}); err == nil {
+		t.Error("expected properties to be rejected for a page parent")
+	}
+	if _, err := n.createPage(testContext(), createPageArgs{ParentID: "page-1", Title: "Notes"}); err != nil {
+		t.Fatalf("create page: %v", err)
+	}
+	creates := decodeBodies(t, srv.Bodies("POST /v1/pages"))
+	if len(creates) != 1 {
+		t.Fatalf("expected a single create request, got %d", len(creates))
+	}
+	create := creates[0]
+	if expected := map[string]any{"type": "page_id", "page_id": "page-1"}; !reflect.DeepEqual(create["parent"], expected) {
+		t.Errorf("unexpected parent %v", create["parent"])
+	}
+	if _, ok := create["properties"].(map[string]any)["title"]; !ok {
+		t.Errorf("expected a title property, got %v", create["properties"])
+	}
+}
+
+func TestUpdateProperties(t *testing.T) {
+	n, srv := newWriteServer(t)
+
+	for _, properties := range []map[string]string{
+		{"Missing": "x"},
+		{"Severity": "high"},
+		{"Date": "tomorrow"},
+		{"Status": ""},
+		{},
+	} {
+		if _, err := n.updateProperties(testContext(), updatePropertiesArgs{PageID: "row-1", Properties: properties}); err == nil {
+			t.Errorf("expected an error for %v", properties)
+		}
+	}
+	if _, err := n.updateProperties(testContext(), updatePropertiesArgs{PageID: "archived", Properties: map[string]string{"title": "x"}}); err == nil {
+		t.Error("expected an error for an archived page")
+	}
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, http.MethodPatch+" ") {
+			t.Fatalf("expected invalid updates not to be sent, got %s", r)
+		}
+	}
+
+	if _, err := n.updateProperties(testContext(), updatePropertiesArgs{
+		PageID:     "row-1",
+		Properties: map[string]string{"Status": "In progress", "Date": "2025-03-01T10:00:00Z"},
+	}); err != nil {
+		t.Fatalf("update properties: %v", err)
+	}
+	updates := decodeBodies(t, srv.Bodies("PATCH /v1/pages/row-1"))
+	if len(updates) != 1 {
+		t.Fatalf("expected a single update, got %d", len(updates))
+	}
+	got, _ := json.Marshal(updates[0]["properties"])
+	if expected := `{"Date":{"date":{"start":"2025-03-01T10:00:00Z"}},"Status":{"status":{"name":"In progress"}}}`; string(got) != expected {
+		t.Errorf("unexpected update %s", got)
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	n, srv := newWriteServer(t)
+
+	if _, err := n.addComment(testContext(), addCommentArgs{Text: "hi"}); err == nil {
+		t.Error("expected an error without page or discussion")
+	}
+	comment, err := n.addComment(testContext(), addCommentArgs{DiscussionID: "discussion-1", Text: "Looks **good**"})
+	if err != nil {
+		t.Fatalf("add comment: %v", err)
+	}
+	if comment.ID != "comment-1" {
+		t.Errorf("unexpected result %+v", comment)
+	}
+	body := decodeBodies(t, srv.Bodies("POST /v1/comments"))[0]
+	if body["discussion_id"] != "discussion-1" || describeRichText(body["rich_text"].([]any)) != "Looks [b]good" {
+		t.Errorf("unexpected comment request %v", body)
+	}
+}
+
+func TestWriteToolsConfirmation(t *testing.T) {
+	ctx := context.Background()
+	n, srv := newWriteServer(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	n.addWriteTools(server)
+
+	session := mcputiltest.Connect(ctx, t, server, nil)
+
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if len(tools.Tools) != 4 {
+		t.Fatalf("expected 4 write tools, got %d", len(tools.Tools))
+	}
+	for _, tool := range tools.Tools {
+		if a := tool.Annotations; a == nil || a.ReadOnlyHint || a.DestructiveHint == nil || !*a.DestructiveHint {
+			t.Errorf("expected %s to be annotated as destructive", tool.Name)
+		}
+	}
+
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "append_content", Arguments: map[string]any{"page_id": "page-1", "content": "Hello"}})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Confirmation required") || !strings.Contains(text, "Hello") {
+		t.Errorf("expected a confirmation request, got %q", text)
+	}
+	if requests := srv.Requests(); len(requests) != 0 {
+		t.Errorf("expected no request before confirmation, got %v", requests)
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/federated"
+	"github.com/pomerium/mcp-servers/mcputil"
 	"github.com/pomerium/mcp-servers/notion"
 	"github.com/pomerium/mcp-servers/sqlite"
 	"github.com/pomerium/mcp-servers/whoami"
@@ -21,28 +24,44 @@ type contextKey string
 
 const httpRequestKey contextKey = "http_request"
 
+// builders maps the server name, that is also its path and environment variable prefix, to its constructor
+var builders = map[string]func(
+	ctx context.Context,
+	env map[string]string,
+) (*mcp.Server, error){
+	"federated": federated.NewServer,
+	"notion":    notion.NewServer,
+	"sqlite":    sqlite.NewServer,
+	"whoami":    whoami.NewServer,
+}
+
 func BuildHandlers(ctx context.Context) http.Handler {
 	mux := http.NewServeMux()
 
-	for name, builder := range map[string]func(
-		ctx context.Context,
-		env map[string]string,
-	) (*mcp.Server, error){
-		"notion": notion.NewServer,
-		"sqlite": sqlite.NewServer,
-		"whoami": whoami.NewServer,
-	} {
+	for name, builder := range builders {
 		v, err := sdk.New(&sdk.Options{})
 		if err != nil {
 			slog.Error("Failed to create SDK verifier", "name", name, "error", err)
 			continue
 		}
 
-		mcpServer, err := builder(ctx, getEnvByPrefix(strings.ToUpper(name)+"_"))
+		env := getEnvByPrefix(strings.ToUpper(name) + "_")
+		mcpServer, err := builder(ctx, env)
 		if err != nil {
 			slog.Error("Not enabling", "name", name, "error", err)
 			continue
 		}
+		mcputil.ApplyToolOptions(mcpServer, mcputil.ToolOptionsFromEnv(env))
+		mcpServer.AddReceivingMiddleware(mcputil.NewLogForwarder(name).Middleware)
+		// Apply context transformations from Pomerium SDK
+		credentials := ctxutil.Combine(
+			ctxutil.AuthorizationTokenFromRequest,
+			ctxutil.NewVerifier(v).IdentityFromRequest,
+		)
+		isStateful := stateful(env)
+		if isStateful {
+			mcpServer.AddReceivingMiddleware(requestCredentials(credentials))
+		}
 		slog.Info("Enabled", "name", name)
 
 		// Create a streamable HTTP handler
@@ -51,18 +70,14 @@ func BuildHandlers(ctx context.Context) http.Handler {
 			// This will be done through a wrapper in the transport layer
 			return mcpServer
 		}, &mcp.StreamableHTTPOptions{
-			Stateless: true,
+			Stateless: !isStateful,
 		})
 
 		// Wrap the handler to add authentication context
 		wrappedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Add the HTTP request to the context so tool handlers can access it
 			ctx := context.WithValue(r.Context(), httpRequestKey, r)
-			// Apply context transformations from Pomerium SDK
-			ctx = ctxutil.Combine(
-				ctxutil.AuthorizationTokenFromRequest,
-				ctxutil.NewVerifier(v).IdentityFromRequest,
-			)(ctx, r)
+			ctx = credentials(ctx, r)
 			r = r.WithContext(ctx)
 			httpHandler.ServeHTTP(w, r)
 		})
@@ -72,3 +87,18 @@ func BuildHandlers(ctx context.Context) http.Handler {
 
 	return mux
 }
+
+// requestCredentials is a receiving middleware that derives the token and identity of every request from its
+// own HTTP headers. Handlers of stateful sessions are called with the context of the request that initialized
+// the session, whose credentials may belong to another user, or have expired.
+func requestCredentials(credentials func(ctx context.Context, r *http.Request) context.Context) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			ctx = ctxutil.WithoutCredentials(ctx)
+			if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+				ctx = credentials(ctx, &http.Request{Method: http.MethodPost, URL: &url.URL{}, Header: extra.Header})
+			}
+			return next(ctx, method, req)
+		}
+	}
+}
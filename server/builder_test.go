@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/ctxutil"
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+func TestToolAnnotations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	envs := map[string]map[string]string{
+		"federated": {"BACKENDS": "notion,sqlite", "SQLITE_DB_FILE": filepath.Join(t.TempDir(), "federated.db")},
+		"sqlite":    {"DB_FILE": filepath.Join(t.TempDir(), "test.db")},
+	}
+
+	for name, builder := range builders {
+		t.Run(name, func(t *testing.T) {
+			mcpServer, err := builder(ctx, envs[name])
+			if err != nil {
+				t.Fatalf("build server: %v", err)
+			}
+
+			session := mcputiltest.Connect(ctx, t, mcpServer, nil)
+
+			list, err := session.ListTools(ctx, nil)
+			if err != nil {
+				t.Fatalf("list tools: %v", err)
+			}
+			if len(list.Tools) == 0 {
+				t.Fatal("expected at least one tool")
+			}
+			for _, tool := range list.Tools {
+				a := tool.Annotations
+				switch {
+				case a == nil:
+					t.Errorf("tool %s has no annotations", tool.Name)
+				case a.Title == "":
+					t.Errorf("tool %s has no title", tool.Name)
+				case a.DestructiveHint == nil:
+					t.Errorf("tool %s does not declare destructiveHint", tool.Name)
+				case a.OpenWorldHint == nil:
+					t.Errorf("tool %s does not declare openWorldHint", tool.Name)
+				case a.ReadOnlyHint && *a.DestructiveHint:
+					t.Errorf("tool %s is both read-only and destructive", tool.Name)
+				}
+			}
+		})
+	}
+}
+
+// tokenTransport sets the bearer token of the requests to the current value of token
+type tokenTransport struct {
+	token *atomic.Value
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token.Load().(string))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRequestCredentials(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mcpServer := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "0.0.1"}, nil)
+	mcp.AddTool(mcpServer, &mcp.Tool{Name: "token"}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		token, err := ctxutil.AuthorizationTokenFromContext(ctx)
+		if err != nil {
+			token = "none"
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: token}}}, nil, nil
+	})
+	mcpServer.AddReceivingMiddleware(requestCredentials(ctxutil.AuthorizationTokenFromRequest))
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return mcpServer }, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(ctxutil.AuthorizationTokenFromRequest(r.Context(), r)))
+	}))
+	defer srv.Close()
+
+	var token atomic.Value
+	token.Store("initializer")
+	client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "0.0.1"}, nil)
+	session, err := client.Connect(ctx, &mcp.StreamableClientTransport{
+		Endpoint:   srv.URL,
+		HTTPClient: &http.Client{Transport: tokenTransport{&token}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+
+	// every request of the stateful session is handled with its own token
+	token.Store("caller")
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "token"})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if text := result.Content[0].(*mcp.TextContent).Text; text != "caller" {
+		t.Errorf("expected the token of the request, got %q", text)
+	}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -20,3 +22,18 @@ func getEnvByPrefix(prefix string) map[string]string {
 
 	return result
 }
+
+// stateful reports whether the server keeps MCP sessions across HTTP requests, as set by STATEFUL.
+// Stateless servers cannot send requests or notifications to clients outside of a request,
+// such as elicitation, sampling or resource updates.
+func stateful(env map[string]string) bool {
+	v, ok := env["STATEFUL"]
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("ignoring invalid boolean", "key", "STATEFUL", "value", v)
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil"
+)
+
+// completeHandler completes the table_name and column_name arguments of the explore_table prompt from sqlite_schema.
+// Column names are restricted to the table_name argument when it was already resolved.
+func (ds *DatabaseService) completeHandler(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	if ref := req.Params.Ref; ref == nil || ref.Type != "ref/prompt" || ref.Name != exploreTablePrompt {
+		return mcputil.CompletionResult(nil), nil
+	}
+
+	var table string
+	if req.Params.Context != nil {
+		table = req.Params.Context.Arguments["table_name"]
+	}
+
+	var values []string
+	var err error
+	switch req.Params.Argument.Name {
+	case "table_name":
+		values, err = ds.completeTableNames(ctx, req.Params.Argument.Value)
+	case "column_name":
+		values, err = ds.completeColumnNames(ctx, table, req.Params.Argument.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("complete %s: %w", req.Params.Argument.Name, err)
+	}
+	return mcputil.CompletionResult(values), nil
+}
+
+func (ds *DatabaseService) completeTableNames(ctx context.Context, prefix string) ([]string, error) {
+	return ds.queryStrings(ctx, `SELECT name FROM sqlite_schema
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' AND name LIKE ? ESCAPE '\'
+		ORDER BY name`, likePrefix(prefix))
+}
+
+func (ds *DatabaseService) completeColumnNames(ctx context.Context, table, prefix string) ([]string, error) {
+	return ds.queryStrings(ctx, `SELECT DISTINCT c.name FROM sqlite_schema AS s, pragma_table_info(s.name) AS c
+		WHERE s.type IN ('table', 'view') AND s.name NOT LIKE 'sqlite_%' AND (? = '' OR s.name = ?) AND c.name LIKE ? ESCAPE '\'
+		ORDER BY c.name`, table, table, likePrefix(prefix))
+}
+
+func (ds *DatabaseService) queryStrings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := ds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards, for use with ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePrefix returns a LIKE pattern matching strings starting with prefix
+func likePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+func TestComplete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE customers (id INTEGER PRIMARY KEY, name TEXT, country TEXT)",
+		"CREATE TABLE customer_notes (id INTEGER PRIMARY KEY, note TEXT)",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER, total REAL)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	mcpServer, err := NewServer(ctx, map[string]string{"DB_FILE": dbFile})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	session := mcputiltest.Connect(ctx, t, mcpServer, nil)
+
+	tests := []struct {
+		name     string
+		argument string
+		value    string
+		context  map[string]string
+		expected []string
+	}{
+		{"all tables", "table_name", "", nil, []string{"customer_notes", "customers", "orders"}},
+		{"table prefix", "table_name", "cust", nil, []string{"customer_notes", "customers"}},
+		{"underscore is literal", "table_name", "customer_", nil, []string{"customer_notes"}},
+		{"no match", "table_name", "x", nil, nil},
+		{"columns of table", "column_name", "", map[string]string{"table_name": "orders"}, []string{"customer_id", "id", "total"}},
+		{"columns of all tables", "column_name", "n", nil, []string{"name", "note"}},
+		{"unknown argument", "query", "SELECT", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := &mcp.CompleteParams{
+				Ref:      &mcp.CompleteReference{Type: "ref/prompt", Name: "explore_table"},
+				Argument: mcp.CompleteParamsArgument{Name: tt.argument, Value: tt.value},
+			}
+			if tt.context != nil {
+				params.Context = &mcp.CompleteContext{Arguments: tt.context}
+			}
+			res, err := session.Complete(ctx, params)
+			if err != nil {
+				t.Fatalf("complete: %v", err)
+			}
+			if !slices.Equal(res.Completion.Values, tt.expected) && len(res.Completion.Values)+len(tt.expected) > 0 {
+				t.Errorf("expected %q, got %q", tt.expected, res.Completion.Values)
+			}
+		})
+	}
+
+	// other prompts and resources have no table_name argument to complete
+	res, err := session.Complete(ctx, &mcp.CompleteParams{
+		Ref:      &mcp.CompleteReference{Type: "ref/resource", URI: "sqlite://table/{table_name}"},
+		Argument: mcp.CompleteParamsArgument{Name: "table_name", Value: "cust"},
+	})
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if len(res.Completion.Values) != 0 {
+		t.Errorf("expected no completion outside of the prompt, got %q", res.Completion.Values)
+	}
+
+	prompt, err := session.GetPrompt(ctx, &mcp.GetPromptParams{
+		Name:      "explore_table",
+		Arguments: map[string]string{"table_name": "orders", "column_name": "total"},
+	})
+	if err != nil {
+		t.Fatalf("get prompt: %v", err)
+	}
+	if text := prompt.Messages[0].Content.(*mcp.TextContent).Text; !strings.Contains(text, `column "total" of the table "orders"`) {
+		t.Errorf("unexpected prompt %q", text)
+	}
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pomerium/mcp-servers/drutil"
+)
+
+// maxDocumentResults is the maximum number of rows returned by a document search
+const maxDocumentResults = 20
+
+// NewDocumentProvider opens the DB_FILE database and serves its rows as drutil documents,
+// for use in the federated server. The database is closed when ctx is done.
+func NewDocumentProvider(ctx context.Context, env map[string]string) (drutil.Provider, error) {
+	ds, err := NewDatabaseService(env["DB_FILE"])
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		ds.Close()
+	}()
+	return &documents{ds: ds}, nil
+}
+
+// documents serves table rows as documents with the ID <table>/<rowid>
+type documents struct {
+	ds *DatabaseService
+}
+
+func (d *documents) GetSearchSyntax() string {
+	return "search table rows whose text columns contain every word of the query"
+}
+
+func (d *documents) Search(ctx context.Context, query string) ([]drutil.Document, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("query cannot be empty")
+	}
+	tables, err := d.ds.queryStrings(ctx, `SELECT name FROM sqlite_schema
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND sql NOT LIKE '%WITHOUT ROWID%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+
+	var results []drutil.Document
+	for _, table := range tables {
+		columns, err := d.ds.queryStrings(ctx, `SELECT name FROM pragma_table_info(?)
+			WHERE type = '' OR type LIKE '%CHAR%' OR type LIKE '%CLOB%' OR type LIKE '%TEXT%'`, table)
+		if err != nil {
+			return nil, fmt.Errorf("list columns of %s: %w", table, err)
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		// every word must be found in one of the text columns
+		var where []string
+		var args []any
+		for _, word := range words {
+			var match []string
+			for _, column := range columns {
+				match = append(match, quoteIdentifier(column)+` LIKE ? ESCAPE '\'`)
+				args = append(args, "%"+likeEscaper.Replace(word)+"%")
+			}
+			where = append(where, "("+strings.Join(match, " OR ")+")")
+		}
+		args = append(args, maxDocumentResults-len(results))
+		query := fmt.Sprintf("SELECT rowid, * FROM %s WHERE %s LIMIT ?",
+			quoteIdentifier(table), strings.Join(where, " AND "))
+
+		docs, err := d.queryDocuments(ctx, table, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("search %s: %w", table, err)
+		}
+		results = append(results, docs...)
+		if len(results) >= maxDocumentResults {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (d *documents) Fetch(ctx context.Context, id string) (*drutil.Document, error) {
+	table, rowid, ok := strings.Cut(id, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid document id %q, expected <table>/<rowid>", id)
+	}
+	if _, err := strconv.ParseInt(rowid, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid rowid %q", rowid)
+	}
+	tables, err := d.ds.queryStrings(ctx, `SELECT name FROM sqlite_schema WHERE type = 'table' AND name = ?`, table)
+	if err != nil {
+		return nil, fmt.Errorf("find table: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("table %q not found", table)
+	}
+
+	docs, err := d.queryDocuments(ctx, table,
+		fmt.Sprintf("SELECT rowid, * FROM %s WHERE rowid = ?", quoteIdentifier(table)), rowid)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", id, err)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("row %s not found", id)
+	}
+	return &docs[0], nil
+}
+
+// queryDocuments runs a query selecting the rowid followed by the columns of the table,
+// and renders every row as a document with a "column: value" line per column
+func (d *documents) queryDocuments(ctx context.Context, table, query string, args ...any) ([]drutil.Document, error) {
+	rows, err := d.ds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var docs []drutil.Document
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		var text strings.Builder
+		for i, column := range columns[1:] {
+			fmt.Fprintf(&text, "%s: %s\n", column, formatValue(values[i+1]))
+		}
+		rowid := formatValue(values[0])
+		docs = append(docs, drutil.Document{
+			ID:          table + "/" + rowid,
+			Title:       fmt.Sprintf("%s #%s", table, rowid),
+			Text:        text.String(),
+			Metadata:    map[string]string{"table": table},
+			ContentType: "row",
+		})
+	}
+	return docs, rows.Err()
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pomerium/mcp-servers/drutil/drutiltest"
+)
+
+func TestDocuments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := NewDocumentProvider(ctx, map[string]string{"DB_FILE": filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("new document provider: %v", err)
+	}
+	db := p.(*documents).ds.db
+	for _, stmt := range []string{
+		`CREATE TABLE "my notes" (title TEXT, body VARCHAR(100), views INTEGER)`,
+		`INSERT INTO "my notes" VALUES ('Launch plan', 'ship 100% of it', 3), ('Retro', 'plan the next launch', 1), ('Other', 'nothing', 2)`,
+		`CREATE TABLE counts (n INTEGER)`,
+		`INSERT INTO counts VALUES (1)`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	for query, expected := range map[string][]string{
+		"launch plan": {"my notes/1", "my notes/2"},
+		"100%":        {"my notes/1"},
+		"_":           nil,
+		"nothing":     {"my notes/3"},
+	} {
+		results, err := p.Search(ctx, query)
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		var ids []string
+		for _, doc := range results {
+			ids = append(ids, doc.ID)
+		}
+		if len(ids) != len(expected) || (len(ids) > 0 && ids[0] != expected[0]) {
+			t.Errorf("search %q: got %v, expected %v", query, ids, expected)
+		}
+	}
+
+	doc, err := p.Fetch(ctx, "my notes/2")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if expected := "title: Retro\nbody: plan the next launch\nviews: 1\n"; doc.Text != expected {
+		t.Errorf("got text %q, expected %q", doc.Text, expected)
+	}
+	for _, id := range []string{"my notes/9", "missing/1", "my notes/x", "my notes"} {
+		if _, err := p.Fetch(ctx, id); err == nil {
+			t.Errorf("expected an error fetching %q", id)
+		}
+	}
+}
+
+func TestDocumentsConformance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := NewDocumentProvider(ctx, map[string]string{"DB_FILE": filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("new document provider: %v", err)
+	}
+	if _, err := p.(*documents).ds.db.ExecContext(ctx, `CREATE TABLE notes (title TEXT);
+		INSERT INTO notes VALUES ('launch plan'), ('launch retro');`); err != nil {
+		t.Fatal(err)
+	}
+	drutiltest.Run(t, p, drutiltest.Config{Query: "launch", MissingID: "notes/100"})
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// exploreTablePrompt is the name of the prompt that explores a table, whose arguments are completed
+const exploreTablePrompt = "explore_table"
+
+// addPrompts adds the prompts of the server
+func addPrompts(server *mcp.Server) {
+	server.AddPrompt(&mcp.Prompt{
+		Name:        exploreTablePrompt,
+		Title:       "Explore table",
+		Description: "Describe a table and sample its rows, or summarize the values of one of its columns",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "table_name", Description: "Name of the table to explore", Required: true},
+			{Name: "column_name", Description: "Name of a column to summarize the values of"},
+		},
+	}, exploreTable)
+}
+
+func exploreTable(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	table := req.Params.Arguments["table_name"]
+	if table == "" {
+		return nil, fmt.Errorf("table_name is required")
+	}
+	text := fmt.Sprintf("Describe the table %q with the describe_table tool, then show a sample of its rows with the read_query tool.", table)
+	if column := req.Params.Arguments["column_name"]; column != "" {
+		text = fmt.Sprintf("Describe the column %q of the table %q with the describe_table tool, "+
+			"then summarize its distinct values and how often they occur with the read_query tool.", column, table)
+	}
+	return &mcp.GetPromptResult{
+		Description: "Explore the table " + table,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: text}},
+		},
+	}, nil
+}
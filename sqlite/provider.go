@@ -10,6 +10,8 @@ import (
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	_ "modernc.org/sqlite" // SQLite driver
+
+	"github.com/pomerium/mcp-servers/mcputil"
 )
 
 // DatabaseService holds the database connection.
@@ -65,7 +67,7 @@ func (ds *DatabaseService) readQueryHandler(ctx context.Context, query string) (
 	// --- Execute Query ---
 	rows, err := ds.db.QueryContext(ctx, query)
 	if err != nil {
-		log.Printf("Error executing query: %v, Query: %s", err, query)
+		mcputil.Logger(ctx).Error("error executing query", "error", err, "query", query)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error executing query: %v", err)},
@@ -76,7 +78,7 @@ func (ds *DatabaseService) readQueryHandler(ctx context.Context, query string) (
 	defer rows.Close()
 
 	// --- Process Results ---
-	return processRows(rows) // Use helper function
+	return processRows(ctx, rows) // Use helper function
 }
 
 // listTablesHandler lists all user tables in the database.
@@ -84,7 +86,7 @@ func (ds *DatabaseService) listTablesHandler(ctx context.Context) (*mcp.CallTool
 	query := "SELECT name FROM sqlite_schema WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name;"
 	rows, err := ds.db.QueryContext(ctx, query)
 	if err != nil {
-		log.Printf("Error listing tables: %v", err)
+		mcputil.Logger(ctx).Error("error listing tables", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error listing tables: %v", err)},
@@ -98,7 +100,7 @@ func (ds *DatabaseService) listTablesHandler(ctx context.Context) (*mcp.CallTool
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			log.Printf("Error scanning table name: %v", err)
+			mcputil.Logger(ctx).Error("error scanning table name", "error", err)
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
 					&mcp.TextContent{Text: fmt.Sprintf("Error reading table name: %v", err)},
@@ -110,7 +112,7 @@ func (ds *DatabaseService) listTablesHandler(ctx context.Context) (*mcp.CallTool
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating table list: %v", err)
+		mcputil.Logger(ctx).Error("error iterating table list", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error iterating through table list: %v", err)},
@@ -122,7 +124,7 @@ func (ds *DatabaseService) listTablesHandler(ctx context.Context) (*mcp.CallTool
 	// Format result as JSON array string
 	resultJSON, err := json.MarshalIndent(tables, "", "  ")
 	if err != nil {
-		log.Printf("Error marshalling table list to JSON: %v", err)
+		mcputil.Logger(ctx).Error("error marshalling table list to JSON", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error formatting table list: %v", err)},
@@ -157,7 +159,7 @@ func (ds *DatabaseService) describeTableHandler(ctx context.Context, tableName s
 
 	rows, err := ds.db.QueryContext(ctx, query)
 	if err != nil {
-		log.Printf("Error describing table %s: %v", tableName, err)
+		mcputil.Logger(ctx).Error("error describing table", "table", tableName, "error", err)
 		// Check if the error is because the table doesn't exist
 		// Note: The specific error message might vary depending on the driver/SQLite version
 		if strings.Contains(err.Error(), "no such table") || strings.Contains(err.Error(), "unable to use function") {
@@ -176,7 +178,17 @@ func (ds *DatabaseService) describeTableHandler(ctx context.Context, tableName s
 		}, nil
 	}
 	defer rows.Close()
-	return processRows(rows) // Use helper function to format PRAGMA results
+	return processRows(ctx, rows) // Use helper function to format PRAGMA results
+}
+
+// updateSummary describes an update for the user to confirm it. The clauses are written by the model,
+// so they are shown verbatim rather than run before the user agreed.
+func updateSummary(tableName, setClause, whereClause string) string {
+	rows := "all rows"
+	if whereClause != "" {
+		rows = "the rows where " + whereClause
+	}
+	return fmt.Sprintf("will update %s of table %q, setting %s", rows, tableName, setClause)
 }
 
 // updateHandler is a fake update handler that does nothing but accepts parameters.
@@ -188,11 +200,15 @@ func (ds *DatabaseService) updateHandler(_, _, _ string) (*mcp.CallToolResult, e
 	}, nil
 }
 
+// progressInterval is the number of rows scanned between progress notifications.
+const progressInterval = 1000
+
 // processRows is a helper function to process sql.Rows into a CallToolResult.
-func processRows(rows *sql.Rows) (*mcp.CallToolResult, error) {
+// Scanning stops if ctx is cancelled, as the driver interrupts the running statement.
+func processRows(ctx context.Context, rows *sql.Rows) (*mcp.CallToolResult, error) {
 	columns, err := rows.Columns()
 	if err != nil {
-		log.Printf("Error getting columns: %v", err)
+		mcputil.Logger(ctx).Error("error getting columns", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error getting result columns: %v", err)},
@@ -202,7 +218,7 @@ func processRows(rows *sql.Rows) (*mcp.CallToolResult, error) {
 	}
 	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
-		log.Printf("Error getting column types: %v", err)
+		mcputil.Logger(ctx).Error("error getting column types", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error getting result column types: %v", err)},
@@ -220,7 +236,7 @@ func processRows(rows *sql.Rows) (*mcp.CallToolResult, error) {
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			log.Printf("Error scanning row: %v", err)
+			mcputil.Logger(ctx).Error("error scanning row", "error", err)
 			return &mcp.CallToolResult{
 				Content: []mcp.Content{
 					&mcp.TextContent{Text: fmt.Sprintf("Error reading result row: %v", err)},
@@ -263,10 +279,13 @@ func processRows(rows *sql.Rows) (*mcp.CallToolResult, error) {
 			}
 		}
 		results = append(results, rowMap)
+		if len(results)%progressInterval == 0 {
+			mcputil.ReportProgress(ctx, float64(len(results)), 0, fmt.Sprintf("scanned %d rows", len(results)))
+		}
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating rows: %v", err)
+		mcputil.Logger(ctx).Error("error iterating rows", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error iterating through results: %v", err)},
@@ -278,7 +297,7 @@ func processRows(rows *sql.Rows) (*mcp.CallToolResult, error) {
 	// --- Format Output ---
 	resultJSON, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
-		log.Printf("Error marshalling results to JSON: %v", err)
+		mcputil.Logger(ctx).Error("error marshalling results to JSON", "error", err)
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: fmt.Sprintf("Error formatting results: %v", err)},
@@ -318,13 +337,16 @@ func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error)
 	}()
 
 	// Create MCP Server
+	opts := mcputil.ServerOptionsFromEnv(env)
+	opts.CompletionHandler = dbService.completeHandler
 	mcpServer := mcp.NewServer(
 		&mcp.Implementation{
 			Name:    "sqlite-readonly",
 			Version: "1.0.0",
 		},
-		nil,
+		opts,
 	)
+	addPrompts(mcpServer)
 
 	// Define tool argument types
 	type readQueryArgs struct {
@@ -334,17 +356,19 @@ func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error)
 		TableName string `json:"table_name" jsonschema:"Name of the table to describe"`
 	}
 	type updateArgs struct {
-		TableName   string `json:"table_name" jsonschema:"Name of the table to update"`
-		SetClause   string `json:"set_clause" jsonschema:"SET clause for the update (e.g. 'name=John, age=30')"`
-		WhereClause string `json:"where_clause" jsonschema:"WHERE clause to filter which records to update (e.g. 'id=1')"`
+		TableName    string `json:"table_name" jsonschema:"Name of the table to update"`
+		SetClause    string `json:"set_clause" jsonschema:"SET clause for the update (e.g. 'name=John, age=30')"`
+		WhereClause  string `json:"where_clause" jsonschema:"WHERE clause to filter which records to update (e.g. 'id=1')"`
+		ConfirmToken string `json:"confirm_token,omitempty" jsonschema:"Token returned by a previous call, once the user confirmed the update"`
 	}
 
 	// Add read_query tool
 	mcp.AddTool(mcpServer, &mcp.Tool{
 		Name:        "read_query",
 		Description: "Execute a read-only SELECT query on the SQLite database",
-	}, func(ctx context.Context, _ *mcp.CallToolRequest, args readQueryArgs) (*mcp.CallToolResult, any, error) {
-		result, err := dbService.readQueryHandler(ctx, args.Query)
+		Annotations: mcputil.ReadOnlyTool("Run read-only query", false),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args readQueryArgs) (*mcp.CallToolResult, any, error) {
+		result, err := dbService.readQueryHandler(mcputil.WithProgress(ctx, req), args.Query)
 		return result, nil, err
 	})
 
@@ -352,6 +376,7 @@ func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error)
 	mcp.AddTool(mcpServer, &mcp.Tool{
 		Name:        "list_tables",
 		Description: "List all user tables in the SQLite database",
+		Annotations: mcputil.ReadOnlyTool("List tables", false),
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
 		result, err := dbService.listTablesHandler(ctx)
 		return result, nil, err
@@ -361,16 +386,24 @@ func NewServer(ctx context.Context, env map[string]string) (*mcp.Server, error)
 	mcp.AddTool(mcpServer, &mcp.Tool{
 		Name:        "describe_table",
 		Description: "Get the schema information (columns, types) for a specific table",
+		Annotations: mcputil.ReadOnlyTool("Describe table", false),
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, args describeTableArgs) (*mcp.CallToolResult, any, error) {
 		result, err := dbService.describeTableHandler(ctx, args.TableName)
 		return result, nil, err
 	})
 
 	// Add update tool (fake, does nothing - only to demonstrate tool blocking by PPL)
+	// It still asks the user for confirmation, as a real destructive tool would
+	confirmer := mcputil.NewConfirmer()
 	mcp.AddTool(mcpServer, &mcp.Tool{
 		Name:        "update",
 		Description: "Update records in a table",
-	}, func(_ context.Context, _ *mcp.CallToolRequest, args updateArgs) (*mcp.CallToolResult, any, error) {
+		Annotations: mcputil.WriteTool("Update records", true, false, false),
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args updateArgs) (*mcp.CallToolResult, any, error) {
+		summary := updateSummary(args.TableName, args.SetClause, args.WhereClause)
+		if result, ok := confirmer.Confirm(ctx, req, summary); !ok {
+			return result, nil, nil
+		}
 		result, err := dbService.updateHandler(args.TableName, args.SetClause, args.WhereClause)
 		return result, nil, err
 	})
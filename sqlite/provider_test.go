@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/pomerium/mcp-servers/mcputil/mcputiltest"
+)
+
+// infiniteQuery never finishes unless interrupted
+const infiniteQuery = "SELECT count(*) FROM (WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT x FROM c)"
+
+func newTestServer(ctx context.Context, t *testing.T) *mcp.Server {
+	t.Helper()
+
+	mcpServer, err := NewServer(ctx, map[string]string{"DB_FILE": filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	return mcpServer
+}
+
+func TestReadQueryCancel(t *testing.T) {
+	dbService, err := NewDatabaseService(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbService.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan *mcp.CallToolResult)
+	go func() {
+		result, _ := dbService.readQueryHandler(ctx, infiniteQuery)
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		if !result.IsError {
+			t.Error("expected cancelled query to return an error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("query was not interrupted by context cancellation")
+	}
+}
+
+func TestReadQueryCancelNotification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mcpServer := newTestServer(ctx, t)
+	handled := make(chan struct{})
+	mcpServer.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			res, err := next(ctx, method, req)
+			if method == "tools/call" {
+				close(handled)
+			}
+			return res, err
+		}
+	})
+	session := mcputiltest.Connect(ctx, t, mcpServer, nil)
+
+	callCtx, cancelCall := context.WithCancel(ctx)
+	go func() {
+		_, _ = session.CallTool(callCtx, &mcp.CallToolParams{
+			Name:      "read_query",
+			Arguments: map[string]any{"query": infiniteQuery},
+		})
+	}()
+	time.Sleep(200 * time.Millisecond)
+	// cancelling the call sends notifications/cancelled to the server
+	cancelCall()
+
+	select {
+	case <-handled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("server kept running the query after the client cancelled the request")
+	}
+}
+
+func TestReadQueryProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var progress []float64
+
+	session := mcputiltest.Connect(ctx, t, newTestServer(ctx, t), &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			mu.Lock()
+			defer mu.Unlock()
+			if req.Params.ProgressToken == "query" {
+				progress = append(progress, req.Params.Progress)
+			}
+		},
+	})
+
+	params := &mcp.CallToolParams{
+		Meta: mcp.Meta{"progressToken": "query"},
+		Name: "read_query",
+		Arguments: map[string]any{
+			"query": "SELECT x FROM (WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c LIMIT 2500) SELECT x FROM c)",
+		},
+	}
+	result, err := session.CallTool(ctx, params)
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error result: %v", result.Content)
+	}
+
+	// notifications are delivered asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(progress)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) != 2 || progress[0] != 1000 || progress[1] != 2000 {
+		t.Errorf("expected progress [1000 2000], got %v", progress)
+	}
+}
+
+func TestUpdateConfirmation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session := mcputiltest.Connect(ctx, t, newTestServer(ctx, t), nil)
+	// the where clause is only shown to the user, a query that never finishes is not run
+	where := "id IN (" + infiniteQuery + ")"
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "update",
+		Arguments: map[string]any{"table_name": "orders", "set_clause": "total=0", "where_clause": where},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	text := result.Content[0].(*mcp.TextContent).Text
+	if !strings.Contains(text, `will update the rows where `+where+` of table "orders", setting total=0`) || !strings.Contains(text, "confirm_token") {
+		t.Errorf("unexpected confirmation %q", text)
+	}
+}
@@ -9,19 +9,20 @@ import (
 	"github.com/pomerium/mcp-servers/mcputil"
 )
 
-func NewServer(_ context.Context, _ map[string]string) (*mcp.Server, error) {
+func NewServer(_ context.Context, env map[string]string) (*mcp.Server, error) {
 	mcpServer := mcp.NewServer(
 		&mcp.Implementation{
 			Name:    "pomerium-whoami",
 			Version: "1.0.0",
 		},
-		nil,
+		mcputil.ServerOptionsFromEnv(env),
 	)
 
 	// Define the tool handler using AddTool
 	mcp.AddTool(mcpServer, &mcp.Tool{
 		Name:        "whoami",
 		Description: "Returns the identity of the user making the request",
+		Annotations: mcputil.ReadOnlyTool("Who am I", false),
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
 		identity, ok := ctxutil.IdentityFromContext(ctx)
 		if !ok {